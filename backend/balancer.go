@@ -0,0 +1,180 @@
+/*
+ * @Author: yujiaxun
+ * @Date: 2026-10-19 19:10:08
+ * @LastEditTime: 2026-10-19 19:10:08
+ * @Description: 在同一个服务的多个实例之间选择
+ */
+
+package backend
+
+import (
+	"fmt"
+	"hash/crc32"
+	"math"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+)
+
+// Instance 服务的一个实例
+type Instance struct {
+	Addr      string
+	pool      *Pool
+	breaker   *Breaker
+	closeChan chan bool
+	sessions  int64 //绑定在这个实例上的会话数
+}
+
+// Pending 已经转发但还没有写到后端的消息数
+func (ins *Instance) Pending() int {
+	return ins.pool.Pending()
+}
+
+// Sessions 绑定在这个实例上的会话数
+func (ins *Instance) Sessions() int {
+	return int(atomic.LoadInt64(&ins.sessions))
+}
+
+// Balancer 为新会话选择实例, 选中后会话会一直绑定在这个实例上
+type Balancer interface {
+	// 健康的实例增减时调用, instances按Addr排序
+	Update(instances []*Instance)
+	// key为用户id, 没有登录时为会话id
+	Pick(key string) *Instance
+}
+
+const (
+	BalanceRoundRobin   = "roundrobin"
+	BalanceLeastPending = "leastpending"
+	BalanceHash         = "hash"
+)
+
+func NewBalancer(name string) (Balancer, error) {
+	switch name {
+	case "", BalanceRoundRobin:
+		return new(RoundRobin), nil
+	case BalanceLeastPending:
+		return new(LeastPending), nil
+	case BalanceHash:
+		return NewConsistentHash(0, 0), nil
+	}
+	return nil, fmt.Errorf("unknown balancer %q", name)
+}
+
+type RoundRobin struct {
+	sync.Mutex
+	instances []*Instance
+	next      int
+}
+
+func (b *RoundRobin) Update(instances []*Instance) {
+	b.Lock()
+	b.instances = instances
+	b.Unlock()
+}
+
+func (b *RoundRobin) Pick(key string) *Instance {
+	b.Lock()
+	defer b.Unlock()
+	if len(b.instances) == 0 {
+		return nil
+	}
+	b.next = (b.next + 1) % len(b.instances)
+	return b.instances[b.next]
+}
+
+// LeastPending 选择待发送消息最少的实例, 相同时选会话最少的
+type LeastPending struct {
+	sync.Mutex
+	instances []*Instance
+}
+
+func (b *LeastPending) Update(instances []*Instance) {
+	b.Lock()
+	b.instances = instances
+	b.Unlock()
+}
+
+func (b *LeastPending) Pick(key string) *Instance {
+	b.Lock()
+	defer b.Unlock()
+	var best *Instance
+	for _, ins := range b.instances {
+		if best == nil || ins.Pending() < best.Pending() ||
+			ins.Pending() == best.Pending() && ins.Sessions() < best.Sessions() {
+			best = ins
+		}
+	}
+	return best
+}
+
+type ringNode struct {
+	hash     uint32
+	instance *Instance
+}
+
+// ConsistentHash 带负载上限的一致性哈希
+// 每个实例的会话数不超过 平均值*LoadFactor, 超出时顺着哈希环找下一个实例
+type ConsistentHash struct {
+	sync.Mutex
+	replicas   int
+	loadFactor float64
+	ring       []ringNode
+	instances  []*Instance
+}
+
+func NewConsistentHash(replicas int, loadFactor float64) *ConsistentHash {
+	if replicas <= 0 {
+		replicas = 100
+	}
+	if loadFactor <= 1 {
+		loadFactor = 1.25
+	}
+	b := new(ConsistentHash)
+	b.replicas = replicas
+	b.loadFactor = loadFactor
+	return b
+}
+
+func (b *ConsistentHash) Update(instances []*Instance) {
+	ring := make([]ringNode, 0, len(instances)*b.replicas)
+	for _, ins := range instances {
+		for i := 0; i < b.replicas; i++ {
+			hash := crc32.ChecksumIEEE([]byte(ins.Addr + "#" + strconv.Itoa(i)))
+			ring = append(ring, ringNode{hash: hash, instance: ins})
+		}
+	}
+	sort.Slice(ring, func(i, j int) bool {
+		return ring[i].hash < ring[j].hash
+	})
+	b.Lock()
+	b.ring = ring
+	b.instances = instances
+	b.Unlock()
+}
+
+func (b *ConsistentHash) Pick(key string) *Instance {
+	b.Lock()
+	defer b.Unlock()
+	if len(b.ring) == 0 {
+		return nil
+	}
+	total := 1
+	for _, ins := range b.instances {
+		total += ins.Sessions()
+	}
+	limit := int(math.Ceil(float64(total) / float64(len(b.instances)) * b.loadFactor))
+
+	hash := crc32.ChecksumIEEE([]byte(key))
+	start := sort.Search(len(b.ring), func(i int) bool {
+		return b.ring[i].hash >= hash
+	})
+	for i := 0; i < len(b.ring); i++ {
+		ins := b.ring[(start+i)%len(b.ring)].instance
+		if ins.Sessions() < limit {
+			return ins
+		}
+	}
+	return b.ring[start%len(b.ring)].instance
+}
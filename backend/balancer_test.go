@@ -0,0 +1,112 @@
+/*
+ * @Author: yujiaxun
+ * @Date: 2026-10-19 20:15:32
+ * @LastEditTime: 2026-10-19 20:15:32
+ * @Description: xxx
+ */
+
+package backend_test
+
+import (
+	"fmt"
+	"test/backend"
+	"testing"
+)
+
+func newService(balancer backend.Balancer, addrs ...string) *backend.Service {
+	service := &backend.Service{
+		Name:     "battle",
+		Balancer: balancer,
+		Health:   backend.HealthConfig{Interval: -1},
+		NewPool: func(addr string, onError func(err error)) *backend.Pool {
+			//不启动连接池, 只测试实例的选择
+			return &backend.Pool{Addr: addr}
+		},
+	}
+	service.Update(addrs)
+	return service
+}
+
+func TestConsistentHashBoundedLoad(t *testing.T) {
+	service := newService(backend.NewConsistentHash(0, 0), "a:1", "b:1", "c:1")
+	loads := make(map[string]int)
+	for session := uint64(1); session <= 30; session++ {
+		service.Send("user1", &backend.Envelope{Session: session})
+		loads[service.Bound(session)]++
+	}
+	for addr, load := range loads {
+		if load > 13 {
+			t.Fatalf("instance %v load %v exceeds bound", addr, load)
+		}
+	}
+
+	//同一个会话一直绑定在同一个实例上
+	addr := service.Bound(1)
+	service.Send("user2", &backend.Envelope{Session: 1})
+	if service.Bound(1) != addr {
+		t.Fatalf("session moved from %v to %v", addr, service.Bound(1))
+	}
+}
+
+func TestServiceRebalance(t *testing.T) {
+	var ev backend.RebalanceEvent
+	service := newService(new(backend.RoundRobin), "a:1", "b:1")
+	service.OnRebalance = func(e backend.RebalanceEvent) {
+		ev = e
+	}
+	for session := uint64(1); session <= 4; session++ {
+		service.Send("", &backend.Envelope{Session: session})
+	}
+
+	service.Update([]string{"a:1", "c:1"})
+	if len(ev.Joined) != 1 || ev.Joined[0] != "c:1" || len(ev.Left) != 1 || ev.Left[0] != "b:1" {
+		t.Fatalf("unexpected event %+v", ev)
+	}
+	if len(ev.Unbound) != 2 {
+		t.Fatalf("unbound %v sessions, want 2", len(ev.Unbound))
+	}
+	for _, session := range ev.Unbound {
+		if service.Bound(session) != "" {
+			t.Fatalf("session %v still bound", session)
+		}
+	}
+}
+
+func TestServiceRebind(t *testing.T) {
+	//按会话id选择的实例不会因为登录而改变
+	service := newService(new(backend.RoundRobin), "a:1", "b:1")
+	service.Send("1", &backend.Envelope{Session: 1})
+	addr := service.Bound(1)
+	service.Rebind(1, "user1")
+	if service.Bound(1) != addr {
+		t.Fatalf("roundrobin session moved from %v to %v", addr, service.Bound(1))
+	}
+
+	service = newService(backend.NewConsistentHash(0, 0), "a:1", "b:1", "c:1")
+	service.Send("1", &backend.Envelope{Session: 1})
+	addr = service.Bound(1)
+	//找一个和会话id落在不同实例上的用户id
+	var userID, want string
+	for i := 0; i < 100 && want == ""; i++ {
+		key := fmt.Sprintf("user%v", i)
+		service.Send(key, &backend.Envelope{Session: 100})
+		if bound := service.Bound(100); bound != addr {
+			userID, want = key, bound
+		}
+		service.Unbind(100)
+	}
+	if want == "" {
+		t.Fatal("no user id hashed to another instance")
+	}
+	service.Rebind(1, userID)
+	if service.Bound(1) != want {
+		t.Fatalf("session bound to %v after login, want %v", service.Bound(1), want)
+	}
+	total := 0
+	for _, ins := range service.Instances() {
+		total += ins.Sessions()
+	}
+	if total != 1 {
+		t.Fatalf("total sessions %v after rebind", total)
+	}
+}
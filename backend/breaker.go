@@ -0,0 +1,103 @@
+/*
+ * @Author: yujiaxun
+ * @Date: 2026-10-19 22:05:13
+ * @LastEditTime: 2026-10-19 22:05:13
+ * @Description: 熔断器
+ */
+
+package backend
+
+import (
+	"sync"
+	"time"
+)
+
+type BreakerState int
+
+const (
+	BreakerClosed   BreakerState = iota //正常
+	BreakerOpen                         //熔断, 不再转发
+	BreakerHalfOpen                     //熔断超时后, 等待探测结果
+)
+
+func (state BreakerState) String() string {
+	switch state {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+// Breaker 连续失败FailThreshold次后熔断, OpenTimeout后进入半开状态
+// 半开时成功一次恢复, 失败一次重新熔断
+type Breaker struct {
+	FailThreshold int
+	OpenTimeout   time.Duration
+	OnStateChange func(from, to BreakerState)
+
+	mutex    sync.Mutex
+	state    BreakerState
+	failures int
+	openedAt time.Time
+}
+
+func NewBreaker(failThreshold int, openTimeout time.Duration) *Breaker {
+	b := new(Breaker)
+	b.FailThreshold = failThreshold
+	b.OpenTimeout = openTimeout
+	return b
+}
+
+func (b *Breaker) State() BreakerState {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.state
+}
+
+// Probe 是否需要探测, 熔断超时后进入半开状态
+func (b *Breaker) Probe() bool {
+	b.mutex.Lock()
+	from := b.state
+	if b.state == BreakerOpen && time.Since(b.openedAt) >= b.OpenTimeout {
+		b.state = BreakerHalfOpen
+	}
+	to := b.state
+	b.mutex.Unlock()
+	b.changed(from, to)
+	return to != BreakerOpen
+}
+
+func (b *Breaker) Success() {
+	b.mutex.Lock()
+	from := b.state
+	b.failures = 0
+	if b.state == BreakerHalfOpen {
+		b.state = BreakerClosed
+	}
+	to := b.state
+	b.mutex.Unlock()
+	b.changed(from, to)
+}
+
+func (b *Breaker) Failure() {
+	b.mutex.Lock()
+	from := b.state
+	b.failures++
+	if b.state == BreakerHalfOpen || b.state == BreakerClosed && b.failures >= b.FailThreshold {
+		b.state = BreakerOpen
+		b.openedAt = time.Now()
+	}
+	to := b.state
+	b.mutex.Unlock()
+	b.changed(from, to)
+}
+
+func (b *Breaker) changed(from, to BreakerState) {
+	if from != to && b.OnStateChange != nil {
+		b.OnStateChange(from, to)
+	}
+}
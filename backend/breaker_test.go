@@ -0,0 +1,58 @@
+/*
+ * @Author: yujiaxun
+ * @Date: 2026-10-19 22:40:12
+ * @LastEditTime: 2026-10-19 22:40:12
+ * @Description: xxx
+ */
+
+package backend_test
+
+import (
+	"test/backend"
+	"testing"
+	"time"
+)
+
+func TestBreaker(t *testing.T) {
+	b := backend.NewBreaker(2, 20*time.Millisecond)
+	var changes []backend.BreakerState
+	b.OnStateChange = func(from, to backend.BreakerState) {
+		changes = append(changes, to)
+	}
+
+	b.Failure()
+	b.Success()
+	b.Failure()
+	if b.State() != backend.BreakerClosed {
+		t.Fatalf("got %v, want closed", b.State())
+	}
+	b.Failure()
+	if b.State() != backend.BreakerOpen || b.Probe() {
+		t.Fatalf("got %v, want open", b.State())
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	if !b.Probe() || b.State() != backend.BreakerHalfOpen {
+		t.Fatalf("got %v, want half-open", b.State())
+	}
+	b.Failure()
+	if b.State() != backend.BreakerOpen {
+		t.Fatalf("got %v, want open", b.State())
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	b.Probe()
+	b.Success()
+	if b.State() != backend.BreakerClosed {
+		t.Fatalf("got %v, want closed", b.State())
+	}
+	want := []backend.BreakerState{backend.BreakerOpen, backend.BreakerHalfOpen, backend.BreakerOpen, backend.BreakerHalfOpen, backend.BreakerClosed}
+	if len(changes) != len(want) {
+		t.Fatalf("got changes %v, want %v", changes, want)
+	}
+	for i := range want {
+		if changes[i] != want[i] {
+			t.Fatalf("got changes %v, want %v", changes, want)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+/*
+ * @Author: yujiaxun
+ * @Date: 2026-10-19 16:20:33
+ * @LastEditTime: 2026-10-19 16:20:33
+ * @Description: 网关和后端之间的消息信封
+ */
+
+package backend
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// 在tcp上用network.MsgParser分帧, 每帧是一个信封
+// --------------------------------
+// | kind(1) | session(8) | data |
+// --------------------------------
+const (
+	KindForward byte = 1 //网关->后端: 客户端发来的消息
+	KindDeliver byte = 2 //后端->网关: 发给session的消息
+	KindClose   byte = 3 //网关->后端: 会话已经关闭; 后端->网关: 踢掉会话, data为原因
+	KindPing    byte = 4 //网关->后端: 健康检查, session为序号
+	KindPong    byte = 5 //后端->网关: 原样返回ping的session
+
+	envelopeHeadLen = 9
+)
+
+var errBadEnvelope = errors.New("bad envelope")
+
+type Envelope struct {
+	Kind    byte
+	Session uint64
+	Data    []byte
+}
+
+func (env *Envelope) head() []byte {
+	head := make([]byte, envelopeHeadLen)
+	head[0] = env.Kind
+	binary.BigEndian.PutUint64(head[1:], env.Session)
+	return head
+}
+
+func decodeEnvelope(b []byte) (*Envelope, error) {
+	if len(b) < envelopeHeadLen {
+		return nil, errBadEnvelope
+	}
+	env := new(Envelope)
+	env.Kind = b[0]
+	env.Session = binary.BigEndian.Uint64(b[1:])
+	env.Data = b[envelopeHeadLen:]
+	return env, nil
+}
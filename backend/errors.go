@@ -0,0 +1,52 @@
+/*
+ * @Author: yujiaxun
+ * @Date: 2026-10-19 21:50:26
+ * @LastEditTime: 2026-10-19 21:50:26
+ * @Description: 转发错误和返回给客户端的错误码
+ */
+
+package backend
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrUnavailable = errors.New("backend is unavailable") //没有健康的实例
+	ErrBusy        = errors.New("backend is busy")        //写队列满了
+	errPingTimeout = errors.New("ping timeout")
+)
+
+// UnknownServiceError 路由到的服务没有配置
+type UnknownServiceError struct {
+	Service string
+}
+
+func (e *UnknownServiceError) Error() string {
+	return fmt.Sprintf("unknown backend service %q", e.Service)
+}
+
+// 转发失败时返回给客户端的错误码
+const (
+	CodeUnroutable     = 1 //路由表里没有这条消息
+	CodeUnknownService = 2 //服务没有配置
+	CodeUnavailable    = 3 //后端不可用, 可以稍后重试
+	CodeBusy           = 4 //后端繁忙, 可以稍后重试
+)
+
+// ErrorCode 返回错误码, retryable表示客户端可以稍后重试
+func ErrorCode(err error) (code int, retryable bool) {
+	var unroutable *UnroutableError
+	var unknown *UnknownServiceError
+	switch {
+	case errors.As(err, &unroutable):
+		return CodeUnroutable, false
+	case errors.As(err, &unknown):
+		return CodeUnknownService, false
+	case errors.Is(err, ErrBusy):
+		return CodeBusy, true
+	default:
+		return CodeUnavailable, true
+	}
+}
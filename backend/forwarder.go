@@ -0,0 +1,205 @@
+/*
+ * @Author: yujiaxun
+ * @Date: 2026-10-19 17:02:51
+ * @LastEditTime: 2026-10-19 21:10:44
+ * @Description: 把客户端的消息转发到后端逻辑服务器
+ */
+
+package backend
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"test/discovery"
+	"test/logger"
+	"test/network"
+)
+
+type Forwarder struct {
+	Services        map[string][]string //服务名 -> 实例地址, 设置了Discovery时不使用
+	Discovery       discovery.Provider  //服务发现, 实例变化时自动更新
+	Balancers       map[string]string   //服务名 -> 负载均衡方式, 默认roundrobin
+	Router          *Router
+	ConnNum         int
+	PendingWriteNum int
+	MaxMsgLen       uint32                              //客户端消息的最大长度, 不含信封头, 默认4096
+	OnDeliver       func(session uint64, data []byte)   //后端发给session的消息
+	OnKick          func(session uint64, reason string) //后端要求踢掉session
+	OnRebalance     func(ev RebalanceEvent)
+	Health          HealthConfig
+
+	parser     *network.MsgParser
+	mutex      sync.RWMutex
+	applyMutex sync.Mutex //全量更新按顺序执行
+	services   map[string]*Service
+	active     map[string]bool //最近一次全量更新里的服务, 其他服务已经没有实例
+}
+
+func (f *Forwarder) Start() error {
+	if f.MaxMsgLen == 0 {
+		//和MsgParser的默认值一致
+		f.MaxMsgLen = 4096
+	}
+	f.parser = network.NewMsgParser()
+	f.parser.SetMsgLen(4, envelopeHeadLen, f.MaxMsgLen+envelopeHeadLen)
+	f.services = make(map[string]*Service)
+
+	services := f.Services
+	if f.Discovery != nil {
+		var err error
+		services, err = f.Discovery.Services()
+		if err != nil {
+			return err
+		}
+	}
+	if err := f.apply(services); err != nil {
+		f.Close()
+		return err
+	}
+	if f.Discovery != nil {
+		return f.Discovery.Watch(func(services map[string][]string) {
+			if err := f.apply(services); err != nil {
+				logger.Error("apply discovery error: %v", err)
+			}
+		})
+	}
+	return nil
+}
+
+// apply 按照全量的服务列表更新实例, 列表里没有的服务清空实例
+// Update会等待旧连接池关闭并回调OnRebalance, 在锁外执行, 不阻塞转发
+func (f *Forwarder) apply(services map[string][]string) error {
+	f.applyMutex.Lock()
+	defer f.applyMutex.Unlock()
+	type update struct {
+		service *Service
+		addrs   []string
+	}
+	var updates []update
+	f.mutex.Lock()
+	active := make(map[string]bool, len(services))
+	for name, addrs := range services {
+		service, ok := f.services[name]
+		if !ok {
+			balancer, err := NewBalancer(f.Balancers[name])
+			if err != nil {
+				f.mutex.Unlock()
+				return fmt.Errorf("service %v: %v", name, err)
+			}
+			service = new(Service)
+			service.Name = name
+			service.Balancer = balancer
+			service.NewPool = f.newPool
+			service.Health = f.Health
+			service.OnRebalance = f.OnRebalance
+			f.services[name] = service
+		}
+		updates = append(updates, update{service, addrs})
+		active[name] = true
+	}
+	f.active = active
+	for name, service := range f.services {
+		if _, ok := services[name]; !ok {
+			updates = append(updates, update{service, nil})
+		}
+	}
+	f.mutex.Unlock()
+	for _, u := range updates {
+		u.service.Update(u.addrs)
+	}
+	return nil
+}
+
+func (f *Forwarder) newPool(addr string, onError func(err error)) *Pool {
+	pool := new(Pool)
+	pool.Addr = addr
+	pool.ConnNum = f.ConnNum
+	pool.PendingWriteNum = f.PendingWriteNum
+	pool.Parser = f.parser
+	pool.OnEnvelope = f.onEnvelope
+	pool.OnError = onError
+	pool.Start()
+	return pool
+}
+
+func (f *Forwarder) Close() {
+	if f.Discovery != nil {
+		f.Discovery.Close()
+	}
+	f.mutex.RLock()
+	defer f.mutex.RUnlock()
+	for _, service := range f.services {
+		service.Close()
+	}
+}
+
+// Service 按名字找到服务, 可以用来查看实例
+func (f *Forwarder) Service(name string) *Service {
+	f.mutex.RLock()
+	defer f.mutex.RUnlock()
+	return f.services[name]
+}
+
+// Ready 每个服务都有可用的实例时返回nil, 否则返回第一个不可用的服务
+// 服务发现里已经去掉的服务不检查
+func (f *Forwarder) Ready() error {
+	f.mutex.RLock()
+	names := make([]string, 0, len(f.active))
+	for name := range f.active {
+		names = append(names, name)
+	}
+	f.mutex.RUnlock()
+	sort.Strings(names)
+	for _, name := range names {
+		if !f.Service(name).Ready() {
+			return fmt.Errorf("service %v has no reachable instance", name)
+		}
+	}
+	return nil
+}
+
+// Forward 按路由键找到服务并转发客户端消息, hashKey用来选择实例, 一般是用户id
+func (f *Forwarder) Forward(session uint64, hashKey string, key string, data []byte) error {
+	name, err := f.Router.Route(key)
+	if err != nil {
+		return err
+	}
+	service := f.Service(name)
+	if service == nil {
+		return &UnknownServiceError{Service: name}
+	}
+	return service.Send(hashKey, &Envelope{Kind: KindForward, Session: session, Data: data})
+}
+
+// SessionLogin 会话登录, 按用户id选择实例的服务重新绑定
+func (f *Forwarder) SessionLogin(session uint64, userID string) {
+	f.mutex.RLock()
+	defer f.mutex.RUnlock()
+	for _, service := range f.services {
+		service.Rebind(session, userID)
+	}
+}
+
+// SessionClosed 通知会话绑定的实例会话已经关闭
+func (f *Forwarder) SessionClosed(session uint64) {
+	f.mutex.RLock()
+	defer f.mutex.RUnlock()
+	for _, service := range f.services {
+		service.Unbind(session)
+	}
+}
+
+func (f *Forwarder) onEnvelope(env *Envelope) {
+	switch env.Kind {
+	case KindDeliver:
+		if f.OnDeliver != nil {
+			f.OnDeliver(env.Session, env.Data)
+		}
+	case KindClose:
+		if f.OnKick != nil {
+			f.OnKick(env.Session, string(env.Data))
+		}
+	}
+}
@@ -0,0 +1,160 @@
+/*
+ * @Author: yujiaxun
+ * @Date: 2026-10-20 19:02:13
+ * @LastEditTime: 2026-10-20 19:02:13
+ * @Description: xxx
+ */
+
+package backend_test
+
+import (
+	"net"
+	"sync"
+	"test/backend"
+	"test/network"
+	"testing"
+	"time"
+)
+
+// acceptAll 只接受连接的后端
+func acceptAll(t *testing.T) net.Listener {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+	return ln
+}
+
+func waitForwarderReady(t *testing.T, f *backend.Forwarder) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for f.Ready() != nil {
+		if time.Now().After(deadline) {
+			t.Fatalf("forwarder not ready: %v", f.Ready())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestForwarderReady(t *testing.T) {
+	ln := acceptAll(t)
+
+	router, _ := backend.NewRouter(&backend.RouteConfig{Default: "battle"})
+	f := &backend.Forwarder{
+		Services: map[string][]string{"battle": {ln.Addr().String()}},
+		Router:   router,
+		Health:   backend.HealthConfig{Interval: -1},
+	}
+	if err := f.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	waitForwarderReady(t, f)
+
+	//服务下没有实例
+	f.Service("battle").Update(nil)
+	if f.Ready() == nil {
+		t.Fatal("service without instance should not be ready")
+	}
+}
+
+// staticProvider 手动触发变化的服务发现
+type staticProvider struct {
+	mutex    sync.Mutex
+	services map[string][]string
+	onChange func(services map[string][]string)
+}
+
+func (p *staticProvider) Services() (map[string][]string, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.services, nil
+}
+
+func (p *staticProvider) Watch(onChange func(services map[string][]string)) error {
+	p.mutex.Lock()
+	p.onChange = onChange
+	p.mutex.Unlock()
+	return nil
+}
+
+func (p *staticProvider) Close() {}
+
+func (p *staticProvider) set(services map[string][]string) {
+	p.mutex.Lock()
+	p.services = services
+	onChange := p.onChange
+	p.mutex.Unlock()
+	onChange(services)
+}
+
+func TestForwarderReadyRemovedService(t *testing.T) {
+	addr := acceptAll(t).Addr().String()
+	provider := &staticProvider{services: map[string][]string{"battle": {addr}, "chat": {addr}}}
+	router, _ := backend.NewRouter(&backend.RouteConfig{Default: "battle"})
+	f := &backend.Forwarder{Discovery: provider, Router: router, Health: backend.HealthConfig{Interval: -1}}
+	if err := f.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	waitForwarderReady(t, f)
+
+	//服务发现里去掉的服务不影响ready
+	provider.set(map[string][]string{"battle": {addr}})
+	if err := f.Ready(); err != nil {
+		t.Fatalf("removed service makes forwarder not ready: %v", err)
+	}
+	if n := len(f.Service("chat").Instances()); n != 0 {
+		t.Fatalf("removed service has %v instances", n)
+	}
+
+	//还在服务发现里但没有实例时不ready
+	provider.set(map[string][]string{"battle": {addr}, "chat": nil})
+	if f.Ready() == nil {
+		t.Fatal("service without instance should not be ready")
+	}
+}
+
+func TestForwarderDefaultMsgLen(t *testing.T) {
+	parser := network.NewMsgParser()
+	parser.SetMsgLen(4, 9, 4096+9)
+	b := startEchoParser(t, "127.0.0.1:0", parser)
+
+	router, _ := backend.NewRouter(&backend.RouteConfig{Default: "battle"})
+	delivered := make(chan []byte, 1)
+	//没有设置MaxMsgLen, 使用默认值
+	f := &backend.Forwarder{
+		Services:  map[string][]string{"battle": {b.ln.Addr().String()}},
+		Router:    router,
+		OnDeliver: func(session uint64, data []byte) { delivered <- data },
+	}
+	if err := f.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	waitForwarderReady(t, f)
+
+	data := make([]byte, 4096)
+	data[0] = 'x'
+	if err := f.Forward(1, "", "", data); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case got := <-delivered:
+		if len(got) != len(data) || got[0] != 'x' {
+			t.Fatalf("got %v bytes", len(got))
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("message not delivered")
+	}
+}
@@ -0,0 +1,96 @@
+/*
+ * @Author: yujiaxun
+ * @Date: 2026-10-19 22:31:48
+ * @LastEditTime: 2026-10-19 22:31:48
+ * @Description: 后端实例的健康检查
+ */
+
+package backend
+
+import (
+	"errors"
+	"time"
+
+	"test/logger"
+)
+
+// HealthConfig 健康检查和熔断的配置, Interval大于0时才检查和熔断
+// 开启后后端必须对KindPing回复session相同的KindPong, 否则连续FailThreshold次超时后熔断
+type HealthConfig struct {
+	Interval      time.Duration //主动探测的间隔, 0表示关闭
+	Timeout       time.Duration //等待pong的时间, 默认2秒
+	FailThreshold int           //连续失败多少次后熔断, 默认3
+	OpenTimeout   time.Duration //熔断多久后半开探测, 默认10秒
+}
+
+func (cfg *HealthConfig) setDefaults() {
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 2 * time.Second
+	}
+	if cfg.FailThreshold <= 0 {
+		cfg.FailThreshold = 3
+	}
+	if cfg.OpenTimeout <= 0 {
+		cfg.OpenTimeout = 10 * time.Second
+	}
+}
+
+// Healthy 熔断器关闭时才会有新会话绑定到这个实例
+func (ins *Instance) Healthy() bool {
+	return ins.breaker == nil || ins.breaker.State() == BreakerClosed
+}
+
+// State 熔断器的状态
+func (ins *Instance) State() BreakerState {
+	if ins.breaker == nil {
+		return BreakerClosed
+	}
+	return ins.breaker.State()
+}
+
+func (ins *Instance) send(env *Envelope) error {
+	err := ins.pool.Send(env)
+	if err != nil {
+		ins.onError(err)
+	}
+	return err
+}
+
+// onError 发送或者连接出错时记一次失败, 写队列满只是本地积压, 不算实例不健康
+func (ins *Instance) onError(err error) {
+	if errors.Is(err, ErrBusy) {
+		return
+	}
+	if ins.breaker != nil {
+		ins.breaker.Failure()
+	}
+}
+
+// checkHealth 定时ping, 熔断时等OpenTimeout后再探测
+func (ins *Instance) checkHealth(cfg HealthConfig) {
+	ticker := time.NewTicker(cfg.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ins.closeChan:
+			return
+		case <-ticker.C:
+		}
+		if !ins.breaker.Probe() {
+			continue
+		}
+		if err := ins.pool.Ping(cfg.Timeout); err != nil {
+			logger.Debug("backend %v ping error: %v", ins.Addr, err)
+			ins.breaker.Failure()
+		} else {
+			ins.breaker.Success()
+		}
+	}
+}
+
+func (ins *Instance) stop() {
+	if ins.closeChan != nil {
+		close(ins.closeChan)
+	}
+	ins.pool.Close()
+}
@@ -0,0 +1,79 @@
+/*
+ * @Author: yujiaxun
+ * @Date: 2026-10-22 19:05:43
+ * @LastEditTime: 2026-10-22 19:05:43
+ * @Description: xxx
+ */
+
+package backend_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"test/backend"
+)
+
+// healthService 连到不回复pong也不读数据的后端
+func healthService(t *testing.T, health backend.HealthConfig, pendingWriteNum int) *backend.Service {
+	ln := acceptAll(t)
+	service := &backend.Service{
+		Name:     "battle",
+		Balancer: new(backend.RoundRobin),
+		Health:   health,
+		NewPool: func(addr string, onError func(err error)) *backend.Pool {
+			pool := &backend.Pool{Addr: addr, PendingWriteNum: pendingWriteNum, OnError: onError}
+			pool.Start()
+			return pool
+		},
+	}
+	service.Update([]string{ln.Addr().String()})
+	t.Cleanup(service.Close)
+	deadline := time.Now().Add(time.Second)
+	for !service.Ready() {
+		if time.Now().After(deadline) {
+			t.Fatal("service not ready")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return service
+}
+
+func TestHealthOptIn(t *testing.T) {
+	//默认不探测, 不回复pong的后端一直可用
+	service := healthService(t, backend.HealthConfig{}, 0)
+	time.Sleep(100 * time.Millisecond)
+	if ins := service.Instances()[0]; !ins.Healthy() {
+		t.Fatalf("instance %v state %v without health check", ins.Addr, ins.State())
+	}
+
+	service = healthService(t, backend.HealthConfig{Interval: 20 * time.Millisecond, Timeout: 10 * time.Millisecond, FailThreshold: 1, OpenTimeout: time.Minute}, 0)
+	deadline := time.Now().Add(time.Second)
+	for service.Instances()[0].Healthy() {
+		if time.Now().After(deadline) {
+			t.Fatal("breaker not open without pong")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestHealthIgnoreBusy(t *testing.T) {
+	service := healthService(t, backend.HealthConfig{Interval: time.Hour, FailThreshold: 1}, 1)
+	data := make([]byte, 4000)
+	for i := 0; ; i++ {
+		err := service.Send("", &backend.Envelope{Kind: backend.KindForward, Session: 1, Data: data})
+		if errors.Is(err, backend.ErrBusy) {
+			break
+		}
+		if err != nil {
+			t.Fatalf("send %v error: %v", i, err)
+		}
+		if i > 100000 {
+			t.Fatal("write queue never full")
+		}
+	}
+	if ins := service.Instances()[0]; !ins.Healthy() {
+		t.Fatalf("instance %v state %v after ErrBusy", ins.Addr, ins.State())
+	}
+}
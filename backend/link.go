@@ -0,0 +1,106 @@
+/*
+ * @Author: yujiaxun
+ * @Date: 2026-10-19 16:31:09
+ * @LastEditTime: 2026-10-19 16:31:09
+ * @Description: 到后端的一条tcp连接
+ */
+
+package backend
+
+import (
+	"net"
+	"sync"
+	"time"
+
+	"test/logger"
+	"test/network"
+)
+
+type link struct {
+	sync.Mutex
+	conn         net.Conn
+	parser       *network.MsgParser
+	writeChan    chan *Envelope
+	writeTimeout time.Duration
+	closeFlag    bool
+	onError      func(err error)
+}
+
+func newLink(conn net.Conn, pendingWriteNum int, parser *network.MsgParser) *link {
+	l := new(link)
+	l.conn = conn
+	l.parser = parser
+	l.writeChan = make(chan *Envelope, pendingWriteNum)
+	return l
+}
+
+func (l *link) writePump() {
+	defer l.close()
+	for env := range l.writeChan {
+		if env == nil {
+			return
+		}
+		if l.writeTimeout > 0 {
+			l.conn.SetWriteDeadline(time.Now().Add(l.writeTimeout))
+		}
+		if err := l.parser.Write(l.conn, env.head(), env.Data); err != nil {
+			logger.Debug("backend %v write fail, err %v", l.conn.RemoteAddr(), err)
+			l.fail(err)
+			return
+		}
+	}
+}
+
+func (l *link) fail(err error) {
+	l.Lock()
+	closeFlag := l.closeFlag
+	l.Unlock()
+	//主动关闭时不算失败
+	if !closeFlag && l.onError != nil {
+		l.onError(err)
+	}
+}
+
+// readPump 读取后端发来的信封, 返回时连接已经关闭
+func (l *link) readPump(onEnvelope func(env *Envelope)) {
+	defer l.close()
+	for {
+		data, err := l.parser.Read(l.conn)
+		if err != nil {
+			logger.Debug("backend %v read fail, err %v", l.conn.RemoteAddr(), err)
+			l.fail(err)
+			return
+		}
+		env, err := decodeEnvelope(data)
+		if err != nil {
+			logger.Error("backend %v send bad envelope", l.conn.RemoteAddr())
+			return
+		}
+		onEnvelope(env)
+	}
+}
+
+func (l *link) send(env *Envelope) error {
+	l.Lock()
+	defer l.Unlock()
+	if l.closeFlag {
+		return ErrUnavailable
+	}
+	select {
+	case l.writeChan <- env:
+		return nil
+	default:
+		return ErrBusy
+	}
+}
+
+func (l *link) close() {
+	l.Lock()
+	defer l.Unlock()
+	if l.closeFlag {
+		return
+	}
+	l.closeFlag = true
+	l.conn.Close()
+	close(l.writeChan)
+}
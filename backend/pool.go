@@ -0,0 +1,228 @@
+/*
+ * @Author: yujiaxun
+ * @Date: 2026-10-19 16:45:27
+ * @LastEditTime: 2026-10-19 16:45:27
+ * @Description: 到同一个后端地址的连接池, 断线后自动重连
+ */
+
+package backend
+
+import (
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"test/logger"
+	"test/network"
+)
+
+type Pool struct {
+	Addr            string
+	ConnNum         int
+	PendingWriteNum int
+	DialTimeout     time.Duration
+	RetryInterval   time.Duration //断线后重连的间隔
+	WriteTimeout    time.Duration
+	Parser          *network.MsgParser
+	OnEnvelope      func(env *Envelope) //收到后端发来的信封, 在连接的读协程里调用
+	OnError         func(err error)     //连接失败或者读写出错
+
+	sync.Mutex
+	links     []*link //每个槽位当前的连接, nil表示还没连上
+	closeFlag bool
+	closeChan chan bool
+	wg        sync.WaitGroup
+	lastPing  uint64
+	pings     map[uint64]chan bool //等待pong的ping
+}
+
+func (pool *Pool) init() {
+	if pool.ConnNum <= 0 {
+		pool.ConnNum = 1
+		logger.Release("invalid ConnNum, reset to %v", pool.ConnNum)
+	}
+	if pool.PendingWriteNum <= 0 {
+		pool.PendingWriteNum = 100
+		logger.Release("invalid PendingWriteNum, reset to %v", pool.PendingWriteNum)
+	}
+	if pool.DialTimeout <= 0 {
+		pool.DialTimeout = 3 * time.Second
+	}
+	if pool.RetryInterval <= 0 {
+		pool.RetryInterval = 3 * time.Second
+	}
+	if pool.WriteTimeout <= 0 {
+		pool.WriteTimeout = 10 * time.Second
+	}
+	if pool.Parser == nil {
+		pool.Parser = network.NewMsgParser()
+	}
+	pool.links = make([]*link, pool.ConnNum)
+	pool.closeChan = make(chan bool)
+	pool.pings = make(map[uint64]chan bool)
+}
+
+func (pool *Pool) Start() {
+	pool.init()
+	for i := 0; i < pool.ConnNum; i++ {
+		pool.wg.Add(1)
+		go pool.keepLink(i)
+	}
+}
+
+// keepLink 维持第i个槽位的连接
+func (pool *Pool) keepLink(i int) {
+	defer pool.wg.Done()
+	for {
+		conn, err := net.DialTimeout("tcp", pool.Addr, pool.DialTimeout)
+		if err == nil {
+			l := newLink(conn, pool.PendingWriteNum, pool.Parser)
+			l.writeTimeout = pool.WriteTimeout
+			l.onError = pool.onError
+			if !pool.setLink(i, l) {
+				l.close()
+				return
+			}
+			logger.Debug("backend %v link %v connected", pool.Addr, i)
+			go l.writePump()
+			l.readPump(pool.onEnvelope)
+			pool.setLink(i, nil)
+			logger.Debug("backend %v link %v disconnected", pool.Addr, i)
+		} else {
+			logger.Debug("connect to backend %v error: %v", pool.Addr, err)
+			pool.onError(err)
+		}
+
+		select {
+		case <-pool.closeChan:
+			return
+		case <-time.After(pool.RetryInterval):
+		}
+	}
+}
+
+func (pool *Pool) setLink(i int, l *link) bool {
+	pool.Lock()
+	defer pool.Unlock()
+	if pool.closeFlag && l != nil {
+		return false
+	}
+	pool.links[i] = l
+	return true
+}
+
+func (pool *Pool) onEnvelope(env *Envelope) {
+	if env.Kind == KindPong {
+		pool.Lock()
+		ch := pool.pings[env.Session]
+		pool.Unlock()
+		if ch != nil {
+			select {
+			case ch <- true:
+			default:
+			}
+		}
+		return
+	}
+	if pool.OnEnvelope != nil {
+		pool.OnEnvelope(env)
+	}
+}
+
+func (pool *Pool) onError(err error) {
+	if pool.OnError != nil {
+		pool.OnError(err)
+	}
+}
+
+// Ping 发送ping并等待后端返回pong
+func (pool *Pool) Ping(timeout time.Duration) error {
+	seq := atomic.AddUint64(&pool.lastPing, 1)
+	ch := make(chan bool, 1)
+	pool.Lock()
+	pool.pings[seq] = ch
+	pool.Unlock()
+	defer func() {
+		pool.Lock()
+		delete(pool.pings, seq)
+		pool.Unlock()
+	}()
+
+	if err := pool.Send(&Envelope{Kind: KindPing, Session: seq}); err != nil {
+		return err
+	}
+	select {
+	case <-ch:
+		return nil
+	case <-time.After(timeout):
+		return errPingTimeout
+	}
+}
+
+// Send 同一个session总是优先走同一条连接, 保证消息的顺序
+func (pool *Pool) Send(env *Envelope) error {
+	pool.Lock()
+	if pool.closeFlag {
+		pool.Unlock()
+		return ErrUnavailable
+	}
+	var l *link
+	n := uint64(len(pool.links))
+	for i := uint64(0); i < n && l == nil; i++ {
+		l = pool.links[(env.Session+i)%n]
+	}
+	pool.Unlock()
+	if l == nil {
+		return ErrUnavailable
+	}
+	return l.send(env)
+}
+
+// Ready 是否有可用的连接
+func (pool *Pool) Ready() bool {
+	pool.Lock()
+	defer pool.Unlock()
+	for _, l := range pool.links {
+		if l != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// Pending 还在写队列里的消息数
+func (pool *Pool) Pending() int {
+	pool.Lock()
+	defer pool.Unlock()
+	n := 0
+	for _, l := range pool.links {
+		if l != nil {
+			n += len(l.writeChan)
+		}
+	}
+	return n
+}
+
+func (pool *Pool) Close() {
+	pool.Lock()
+	if pool.closeFlag {
+		pool.Unlock()
+		return
+	}
+	pool.closeFlag = true
+	links := pool.links
+	pool.Unlock()
+
+	if pool.closeChan == nil {
+		//还没有Start
+		return
+	}
+	close(pool.closeChan)
+	for _, l := range links {
+		if l != nil {
+			l.close()
+		}
+	}
+	pool.wg.Wait()
+}
@@ -0,0 +1,196 @@
+/*
+ * @Author: yujiaxun
+ * @Date: 2026-10-22 17:20:46
+ * @LastEditTime: 2026-10-22 17:20:46
+ * @Description: xxx
+ */
+
+package backend_test
+
+import (
+	"encoding/binary"
+	"net"
+	"sync"
+	"test/backend"
+	"test/network"
+	"testing"
+	"time"
+)
+
+// echoBackend 把收到的KindForward原样作为KindDeliver发回, 回应ping
+type echoBackend struct {
+	ln     net.Listener
+	parser *network.MsgParser
+	mutex  sync.Mutex
+	conns  []net.Conn
+}
+
+func startEcho(t *testing.T, addr string) *echoBackend {
+	return startEchoParser(t, addr, network.NewMsgParser())
+}
+
+// startEchoParser 用指定的分帧方式, 例如和Forwarder一样的4字节长度
+func startEchoParser(t *testing.T, addr string, parser *network.MsgParser) *echoBackend {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := &echoBackend{ln: ln, parser: parser}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			b.mutex.Lock()
+			b.conns = append(b.conns, conn)
+			b.mutex.Unlock()
+			go b.serve(conn)
+		}
+	}()
+	t.Cleanup(b.close)
+	return b
+}
+
+func (b *echoBackend) serve(conn net.Conn) {
+	parser := b.parser
+	for {
+		data, err := parser.Read(conn)
+		if err != nil {
+			return
+		}
+		switch data[0] {
+		case backend.KindForward:
+			data[0] = backend.KindDeliver
+		case backend.KindPing:
+			data[0] = backend.KindPong
+		default:
+			continue
+		}
+		parser.Write(conn, data)
+	}
+}
+
+// close 关闭监听和所有连接
+func (b *echoBackend) close() {
+	b.ln.Close()
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	for _, conn := range b.conns {
+		conn.Close()
+	}
+	b.conns = nil
+}
+
+func waitReady(t *testing.T, pool *backend.Pool, ready bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for pool.Ready() != ready {
+		if time.Now().After(deadline) {
+			t.Fatalf("pool ready is not %v", ready)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestPoolEnvelope(t *testing.T) {
+	b := startEcho(t, "127.0.0.1:0")
+	envs := make(chan *backend.Envelope, 4)
+	pool := &backend.Pool{
+		Addr:       b.ln.Addr().String(),
+		OnEnvelope: func(env *backend.Envelope) { envs <- env },
+	}
+	pool.Start()
+	defer pool.Close()
+	waitReady(t, pool, true)
+
+	//信封编码后由后端原样返回, 再解码
+	if err := pool.Send(&backend.Envelope{Kind: backend.KindForward, Session: 1<<40 + 7, Data: []byte("hello")}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case env := <-envs:
+		if env.Kind != backend.KindDeliver || env.Session != 1<<40+7 || string(env.Data) != "hello" {
+			t.Fatalf("got envelope %+v", env)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("no envelope")
+	}
+	//pong由Pool自己处理, 不交给OnEnvelope
+	if err := pool.Ping(time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if len(envs) != 0 {
+		t.Fatal("pong should not be delivered")
+	}
+}
+
+func TestPoolBadEnvelope(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	accepted := make(chan net.Conn, 4)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			accepted <- conn
+		}
+	}()
+	pool := &backend.Pool{Addr: ln.Addr().String(), RetryInterval: 20 * time.Millisecond}
+	pool.Start()
+	defer pool.Close()
+
+	conn := <-accepted
+	defer conn.Close()
+	//不到信封头的长度, 网关断开连接后重连
+	head := make([]byte, 2)
+	binary.BigEndian.PutUint16(head, 3)
+	conn.Write(append(head, 1, 2, 3))
+	select {
+	case conn = <-accepted:
+		conn.Close()
+	case <-time.After(2 * time.Second):
+		t.Fatal("pool does not reconnect after bad envelope")
+	}
+}
+
+func TestPoolReconnect(t *testing.T) {
+	b := startEcho(t, "127.0.0.1:0")
+	addr := b.ln.Addr().String()
+	envs := make(chan *backend.Envelope, 4)
+	pool := &backend.Pool{
+		Addr:          addr,
+		ConnNum:       2,
+		RetryInterval: 20 * time.Millisecond,
+		OnEnvelope:    func(env *backend.Envelope) { envs <- env },
+	}
+	pool.Start()
+	defer pool.Close()
+	waitReady(t, pool, true)
+
+	//后端重启期间不可用
+	b.close()
+	waitReady(t, pool, false)
+	if err := pool.Send(&backend.Envelope{Kind: backend.KindForward, Session: 1}); err != backend.ErrUnavailable {
+		t.Fatalf("send to closed backend: %v", err)
+	}
+
+	startEcho(t, addr)
+	waitReady(t, pool, true)
+	if err := pool.Send(&backend.Envelope{Kind: backend.KindForward, Session: 1, Data: []byte("again")}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case env := <-envs:
+		if string(env.Data) != "again" {
+			t.Fatalf("got envelope %+v", env)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("no envelope after reconnect")
+	}
+}
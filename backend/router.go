@@ -0,0 +1,191 @@
+/*
+ * @Author: yujiaxun
+ * @Date: 2026-10-19 17:40:12
+ * @LastEditTime: 2026-10-19 17:40:12
+ * @Description: 路由表, 把路由键映射到后端服务
+ */
+
+package backend
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"test/logger"
+)
+
+// UnroutableError 路由表里找不到路由键对应的服务
+type UnroutableError struct {
+	Key string
+}
+
+func (e *UnroutableError) Error() string {
+	return fmt.Sprintf("no route for key %q", e.Key)
+}
+
+// RouteRule 一条路由规则, Match可以是:
+//   - 精确的名字, 例如 login
+//   - 消息id的范围, 例如 1000-1999
+//   - 通配符, 例如 chat.* , 语法同path.Match
+type RouteRule struct {
+	Match   string `json:"match"`
+	Service string `json:"service"`
+}
+
+// RouteConfig 路由表的配置文件格式, 没有匹配的规则时使用Default
+type RouteConfig struct {
+	Routes  []RouteRule `json:"routes"`
+	Default string      `json:"default"`
+}
+
+type idRange struct {
+	min, max uint64
+	service  string
+}
+
+type routeTable struct {
+	exact    map[string]string
+	ranges   []idRange
+	patterns []RouteRule
+	def      string
+}
+
+func newRouteTable(conf *RouteConfig) (*routeTable, error) {
+	t := new(routeTable)
+	t.exact = make(map[string]string)
+	t.def = conf.Default
+	for _, rule := range conf.Routes {
+		if rule.Match == "" || rule.Service == "" {
+			return nil, fmt.Errorf("invalid route rule %+v", rule)
+		}
+		if r, ok, err := parseRange(rule.Match); err != nil {
+			return nil, err
+		} else if ok {
+			r.service = rule.Service
+			t.ranges = append(t.ranges, r)
+			continue
+		}
+		if strings.ContainsAny(rule.Match, "*?[") {
+			if _, err := path.Match(rule.Match, ""); err != nil {
+				return nil, fmt.Errorf("invalid route pattern %q: %v", rule.Match, err)
+			}
+			t.patterns = append(t.patterns, rule)
+			continue
+		}
+		if _, ok := t.exact[rule.Match]; ok {
+			return nil, fmt.Errorf("duplicate route %q", rule.Match)
+		}
+		t.exact[rule.Match] = rule.Service
+	}
+	return t, nil
+}
+
+// parseRange 解析 min-max 形式的id范围, 不是范围时ok为false
+func parseRange(match string) (r idRange, ok bool, err error) {
+	i := strings.IndexByte(match, '-')
+	if i <= 0 {
+		return r, false, nil
+	}
+	min, err1 := strconv.ParseUint(match[:i], 10, 64)
+	max, err2 := strconv.ParseUint(match[i+1:], 10, 64)
+	if err1 != nil || err2 != nil {
+		return r, false, nil
+	}
+	if min > max {
+		return r, false, fmt.Errorf("invalid route range %q", match)
+	}
+	return idRange{min: min, max: max}, true, nil
+}
+
+// lookup 精确匹配优先, 然后是id范围, 然后按顺序匹配通配符
+func (t *routeTable) lookup(key string) (string, bool) {
+	if service, ok := t.exact[key]; ok {
+		return service, true
+	}
+	if id, err := strconv.ParseUint(key, 10, 64); err == nil {
+		for _, r := range t.ranges {
+			if id >= r.min && id <= r.max {
+				return r.service, true
+			}
+		}
+	}
+	for _, rule := range t.patterns {
+		if ok, _ := path.Match(rule.Match, key); ok {
+			return rule.Service, true
+		}
+	}
+	if t.def != "" {
+		return t.def, true
+	}
+	return "", false
+}
+
+// Router 协程安全, 可以在运行时重新加载路由表
+type Router struct {
+	File  string //路由表文件, Reload时重新读取
+	table atomic.Value
+}
+
+func NewRouter(conf *RouteConfig) (*Router, error) {
+	r := new(Router)
+	if err := r.Set(conf); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// LoadRouter 从json文件加载路由表
+func LoadRouter(file string) (*Router, error) {
+	r := new(Router)
+	r.File = file
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Set 替换路由表, 配置有错时保留原来的路由表
+func (r *Router) Set(conf *RouteConfig) error {
+	t, err := newRouteTable(conf)
+	if err != nil {
+		return err
+	}
+	r.table.Store(t)
+	return nil
+}
+
+func (r *Router) Reload() error {
+	if r.File == "" {
+		return errors.New("router has no file")
+	}
+	data, err := os.ReadFile(r.File)
+	if err != nil {
+		return err
+	}
+	conf := new(RouteConfig)
+	if err := json.Unmarshal(data, conf); err != nil {
+		return fmt.Errorf("parse route file %v error: %v", r.File, err)
+	}
+	if err := r.Set(conf); err != nil {
+		return err
+	}
+	logger.Release("route table %v loaded, %v rules", r.File, len(conf.Routes))
+	return nil
+}
+
+// Route 返回路由键对应的服务名, 找不到时返回*UnroutableError
+func (r *Router) Route(key string) (string, error) {
+	t, _ := r.table.Load().(*routeTable)
+	if t != nil {
+		if service, ok := t.lookup(key); ok {
+			return service, nil
+		}
+	}
+	return "", &UnroutableError{Key: key}
+}
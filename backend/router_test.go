@@ -0,0 +1,76 @@
+/*
+ * @Author: yujiaxun
+ * @Date: 2026-10-19 18:20:45
+ * @LastEditTime: 2026-10-19 18:20:45
+ * @Description: xxx
+ */
+
+package backend_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"test/backend"
+	"testing"
+)
+
+func TestRouter(t *testing.T) {
+	router, err := backend.NewRouter(&backend.RouteConfig{
+		Routes: []backend.RouteRule{
+			{Match: "login", Service: "auth"},
+			{Match: "1000-1999", Service: "battle"},
+			{Match: "chat.*", Service: "chat"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := map[string]string{
+		"login":      "auth",
+		"1000":       "battle",
+		"1999":       "battle",
+		"chat.world": "chat",
+	}
+	for key, want := range cases {
+		service, err := router.Route(key)
+		if err != nil || service != want {
+			t.Fatalf("route %v got %v %v, want %v", key, service, err, want)
+		}
+	}
+
+	_, err = router.Route("2000")
+	var unroutable *backend.UnroutableError
+	if !errors.As(err, &unroutable) || unroutable.Key != "2000" {
+		t.Fatalf("got %v, want UnroutableError", err)
+	}
+}
+
+func TestRouterReload(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "routes.json")
+	os.WriteFile(file, []byte(`{"routes": [{"match": "login", "service": "auth"}]}`), 0644)
+	router, err := backend.LoadRouter(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if service, _ := router.Route("login"); service != "auth" {
+		t.Fatalf("got %v, want auth", service)
+	}
+
+	os.WriteFile(file, []byte(`{"routes": [{"match": "login", "service": "auth2"}]}`), 0644)
+	if err := router.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if service, _ := router.Route("login"); service != "auth2" {
+		t.Fatalf("got %v, want auth2", service)
+	}
+
+	//配置有错时保留原来的路由表
+	os.WriteFile(file, []byte(`{"routes": [{"match": "9-1", "service": "x"}]}`), 0644)
+	if err := router.Reload(); err == nil {
+		t.Fatal("reload bad config should fail")
+	}
+	if service, _ := router.Route("login"); service != "auth2" {
+		t.Fatalf("got %v, want auth2", service)
+	}
+}
@@ -0,0 +1,233 @@
+/*
+ * @Author: yujiaxun
+ * @Date: 2026-10-19 19:42:55
+ * @LastEditTime: 2026-10-19 19:42:55
+ * @Description: 后端服务, 管理实例和会话的绑定
+ */
+
+package backend
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"test/logger"
+)
+
+// RebalanceEvent 服务的实例增减, Unbound里的会话下次转发时会重新选择实例
+type RebalanceEvent struct {
+	Service string
+	Joined  []string
+	Left    []string
+	Unbound []uint64
+}
+
+type Service struct {
+	Name        string
+	Balancer    Balancer
+	NewPool     func(addr string, onError func(err error)) *Pool //创建并启动到实例的连接池
+	Health      HealthConfig
+	OnRebalance func(ev RebalanceEvent)
+
+	mutex     sync.Mutex
+	instances map[string]*Instance
+	sticky    map[uint64]*Instance //会话绑定的实例
+}
+
+func (s *Service) init() {
+	if s.instances == nil {
+		s.instances = make(map[string]*Instance)
+		s.sticky = make(map[uint64]*Instance)
+	}
+}
+
+// Update 设置服务的实例地址, 新增的实例建立连接, 去掉的实例断开连接并解除绑定
+func (s *Service) Update(addrs []string) {
+	s.mutex.Lock()
+	s.init()
+	ev := RebalanceEvent{Service: s.Name}
+	keep := make(map[string]bool, len(addrs))
+	for _, addr := range addrs {
+		keep[addr] = true
+		if _, ok := s.instances[addr]; !ok {
+			s.instances[addr] = s.newInstance(addr)
+			ev.Joined = append(ev.Joined, addr)
+		}
+	}
+	var left []*Instance
+	for addr, ins := range s.instances {
+		if !keep[addr] {
+			delete(s.instances, addr)
+			left = append(left, ins)
+			ev.Left = append(ev.Left, addr)
+		}
+	}
+	for session, ins := range s.sticky {
+		if !keep[ins.Addr] {
+			delete(s.sticky, session)
+			ev.Unbound = append(ev.Unbound, session)
+		}
+	}
+	s.Balancer.Update(s.healthyInstances())
+	s.mutex.Unlock()
+
+	for _, ins := range left {
+		ins.stop()
+	}
+	if len(ev.Joined) == 0 && len(ev.Left) == 0 {
+		return
+	}
+	logger.Release("service %v rebalance, joined %v, left %v, unbound %v sessions", s.Name, ev.Joined, ev.Left, len(ev.Unbound))
+	if s.OnRebalance != nil {
+		s.OnRebalance(ev)
+	}
+}
+
+func (s *Service) newInstance(addr string) *Instance {
+	ins := &Instance{Addr: addr}
+	if s.Health.Interval > 0 {
+		cfg := s.Health
+		cfg.setDefaults()
+		ins.breaker = NewBreaker(cfg.FailThreshold, cfg.OpenTimeout)
+		ins.breaker.OnStateChange = func(from, to BreakerState) {
+			logger.Release("service %v instance %v circuit %v -> %v", s.Name, addr, from, to)
+			s.refresh()
+		}
+		ins.closeChan = make(chan bool)
+		ins.pool = s.NewPool(addr, ins.onError)
+		go ins.checkHealth(cfg)
+	} else {
+		ins.pool = s.NewPool(addr, nil)
+	}
+	return ins
+}
+
+// refresh 实例的健康状态变化, 只把健康的实例交给Balancer
+func (s *Service) refresh() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.Balancer.Update(s.healthyInstances())
+}
+
+func (s *Service) healthyInstances() []*Instance {
+	instances := s.sortedInstances()
+	healthy := instances[:0]
+	for _, ins := range instances {
+		if ins.Healthy() {
+			healthy = append(healthy, ins)
+		}
+	}
+	return healthy
+}
+
+func (s *Service) sortedInstances() []*Instance {
+	instances := make([]*Instance, 0, len(s.instances))
+	for _, ins := range s.instances {
+		instances = append(instances, ins)
+	}
+	sort.Slice(instances, func(i, j int) bool {
+		return instances[i].Addr < instances[j].Addr
+	})
+	return instances
+}
+
+// Instances 当前的实例
+func (s *Service) Instances() []*Instance {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.sortedInstances()
+}
+
+// Ready 至少有一个实例健康并且已经连上
+func (s *Service) Ready() bool {
+	for _, ins := range s.Instances() {
+		if ins.Healthy() && ins.pool.Ready() {
+			return true
+		}
+	}
+	return false
+}
+
+// Bound 会话绑定的实例地址, 没有绑定时返回空
+func (s *Service) Bound(session uint64) string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if ins, ok := s.sticky[session]; ok {
+		return ins.Addr
+	}
+	return ""
+}
+
+// pick 返回会话绑定的实例, 还没有绑定时用Balancer选择一个
+func (s *Service) pick(session uint64, key string) *Instance {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.init()
+	if ins, ok := s.sticky[session]; ok {
+		if ins.Healthy() {
+			return ins
+		}
+		//绑定的实例熔断了, 换一个健康的实例
+		delete(s.sticky, session)
+		atomic.AddInt64(&ins.sessions, -1)
+	}
+	ins := s.Balancer.Pick(key)
+	if ins == nil {
+		return nil
+	}
+	s.sticky[session] = ins
+	atomic.AddInt64(&ins.sessions, 1)
+	return ins
+}
+
+func (s *Service) Send(key string, env *Envelope) error {
+	ins := s.pick(env.Session, key)
+	if ins == nil {
+		return ErrUnavailable
+	}
+	return ins.send(env)
+}
+
+// Rebind 会话登录后按用户id重新选择实例, 只对按key选择的ConsistentHash生效
+// 登录之前按会话id绑定, 选中的实例不同时通知原来的实例会话已经关闭
+func (s *Service) Rebind(session uint64, key string) {
+	s.mutex.Lock()
+	old, ok := s.sticky[session]
+	if _, hash := s.Balancer.(*ConsistentHash); !ok || !hash {
+		s.mutex.Unlock()
+		return
+	}
+	ins := s.Balancer.Pick(key)
+	if ins == nil || ins == old {
+		s.mutex.Unlock()
+		return
+	}
+	s.sticky[session] = ins
+	atomic.AddInt64(&ins.sessions, 1)
+	atomic.AddInt64(&old.sessions, -1)
+	s.mutex.Unlock()
+	old.pool.Send(&Envelope{Kind: KindClose, Session: session})
+}
+
+// Unbind 会话关闭, 通知绑定的实例并解除绑定
+func (s *Service) Unbind(session uint64) {
+	s.mutex.Lock()
+	ins, ok := s.sticky[session]
+	delete(s.sticky, session)
+	s.mutex.Unlock()
+	if !ok {
+		return
+	}
+	atomic.AddInt64(&ins.sessions, -1)
+	ins.pool.Send(&Envelope{Kind: KindClose, Session: session})
+}
+
+func (s *Service) Close() {
+	s.mutex.Lock()
+	instances := s.sortedInstances()
+	s.mutex.Unlock()
+	for _, ins := range instances {
+		ins.stop()
+	}
+}
@@ -0,0 +1,129 @@
+/*
+ * @Author: yujiaxun
+ * @Date: 2026-10-19 23:02:36
+ * @LastEditTime: 2026-10-19 23:02:36
+ * @Description: 网关节点之间的消息总线
+ */
+
+package cluster
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+)
+
+const (
+	KindUser     byte = 1 //发给用户, Key为用户id, Data为编码好的消息
+	KindRoom     byte = 2 //房间广播, Key为房间名, Data为编码好的消息
+	KindOnline   byte = 3 //用户在From节点上线, Key为用户id
+	KindOffline  byte = 4 //用户在From节点下线, Key为用户id
+	KindSync     byte = 5 //请求From节点发送所有在线用户
+	KindNodeUp   byte = 6 //总线产生: 可以给From节点发消息了
+	KindNodeDown byte = 7 //总线产生: From节点断开
+	KindUsers    byte = 8 //From节点上在线的一批用户, Data由EncodeUsers编码, 同步时使用
+)
+
+// Message 在网关节点之间传递的消息
+type Message struct {
+	Kind byte
+	From string //发出消息的节点, 由总线填写
+	To   string //目标节点, 为空时广播给其他所有节点
+	Key  string
+	Data []byte
+}
+
+// Bus 消息总线, 同一个进程内用Hub, 多个进程之间用Mesh
+type Bus interface {
+	NodeID() string
+	// Start 加入总线, handler在总线的协程里调用, 需要自己保证并发安全
+	Start(handler func(msg *Message)) error
+	// Send 发给msg.To节点, To为空时广播, 不保证送达
+	Send(msg *Message) error
+	Close()
+}
+
+var (
+	ErrUnknownNode = errors.New("unknown node")
+	ErrNodeDown    = errors.New("node is down")
+	ErrBusBusy     = errors.New("bus is busy")
+	ErrBusClosed   = errors.New("bus is closed")
+	errBadMessage  = errors.New("bad cluster message")
+)
+
+// encodeHead 编码消息头, 格式为
+// kind(1) + len(From)(1) + From + len(To)(1) + To + len(Key)(2) + Key, 后面跟着Data
+func encodeHead(msg *Message) ([]byte, error) {
+	if len(msg.From) > math.MaxUint8 || len(msg.To) > math.MaxUint8 || len(msg.Key) > math.MaxUint16 {
+		return nil, errBadMessage
+	}
+	head := make([]byte, 5+len(msg.From)+len(msg.To)+len(msg.Key))
+	head[0] = msg.Kind
+	i := 1
+	head[i] = byte(len(msg.From))
+	i += 1 + copy(head[i+1:], msg.From)
+	head[i] = byte(len(msg.To))
+	i += 1 + copy(head[i+1:], msg.To)
+	binary.BigEndian.PutUint16(head[i:], uint16(len(msg.Key)))
+	copy(head[i+2:], msg.Key)
+	return head, nil
+}
+
+func decodeMessage(b []byte) (*Message, error) {
+	if len(b) < 5 {
+		return nil, errBadMessage
+	}
+	msg := new(Message)
+	msg.Kind = b[0]
+	i := 1
+	n := int(b[i])
+	if len(b) < i+1+n+1 {
+		return nil, errBadMessage
+	}
+	msg.From = string(b[i+1 : i+1+n])
+	i += 1 + n
+	n = int(b[i])
+	if len(b) < i+1+n+2 {
+		return nil, errBadMessage
+	}
+	msg.To = string(b[i+1 : i+1+n])
+	i += 1 + n
+	n = int(binary.BigEndian.Uint16(b[i:]))
+	if len(b) < i+2+n {
+		return nil, errBadMessage
+	}
+	msg.Key = string(b[i+2 : i+2+n])
+	msg.Data = b[i+2+n:]
+	return msg, nil
+}
+
+// EncodeUsers 编码KindUsers的Data, 每个用户id前面带2字节的长度
+func EncodeUsers(users []string) []byte {
+	n := 0
+	for _, userID := range users {
+		n += 2 + len(userID)
+	}
+	data := make([]byte, n)
+	i := 0
+	for _, userID := range users {
+		binary.BigEndian.PutUint16(data[i:], uint16(len(userID)))
+		i += 2 + copy(data[i+2:], userID)
+	}
+	return data
+}
+
+func DecodeUsers(data []byte) ([]string, error) {
+	var users []string
+	for len(data) > 0 {
+		if len(data) < 2 {
+			return nil, errBadMessage
+		}
+		n := int(binary.BigEndian.Uint16(data))
+		if len(data) < 2+n {
+			return nil, errBadMessage
+		}
+		users = append(users, string(data[2:2+n]))
+		data = data[2+n:]
+	}
+	return users, nil
+}
@@ -0,0 +1,174 @@
+/*
+ * @Author: yujiaxun
+ * @Date: 2026-10-20 00:12:09
+ * @LastEditTime: 2026-10-20 00:12:09
+ * @Description: xxx
+ */
+
+package cluster_test
+
+import (
+	"io"
+	"net"
+	"reflect"
+	"test/cluster"
+	"testing"
+	"time"
+)
+
+func recv(t *testing.T, ch chan *cluster.Message, kind byte) *cluster.Message {
+	t.Helper()
+	timeout := time.After(3 * time.Second)
+	for {
+		select {
+		case msg := <-ch:
+			if msg.Kind == kind {
+				return msg
+			}
+		case <-timeout:
+			t.Fatalf("wait message kind %v timeout", kind)
+		}
+	}
+}
+
+func TestHub(t *testing.T) {
+	hub := cluster.NewHub()
+	a, b := hub.Node("a"), hub.Node("b")
+	chA, chB := make(chan *cluster.Message, 10), make(chan *cluster.Message, 10)
+	a.Start(func(msg *cluster.Message) { chA <- msg })
+	b.Start(func(msg *cluster.Message) { chB <- msg })
+	if msg := recv(t, chA, cluster.KindNodeUp); msg.From != "b" {
+		t.Fatalf("got node up from %v, want b", msg.From)
+	}
+
+	a.Send(&cluster.Message{Kind: cluster.KindUser, To: "b", Key: "u1", Data: []byte("hi")})
+	msg := recv(t, chB, cluster.KindUser)
+	if msg.From != "a" || msg.Key != "u1" || string(msg.Data) != "hi" {
+		t.Fatalf("got %+v", msg)
+	}
+	if err := a.Send(&cluster.Message{Kind: cluster.KindUser, To: "c"}); err != cluster.ErrUnknownNode {
+		t.Fatalf("got %v, want ErrUnknownNode", err)
+	}
+
+	b.Close()
+	if msg := recv(t, chA, cluster.KindNodeDown); msg.From != "b" {
+		t.Fatalf("got node down from %v, want b", msg.From)
+	}
+	a.Close()
+}
+
+func TestMesh(t *testing.T) {
+	a := &cluster.Mesh{ID: "a", Addr: "127.0.0.1:0", RetryInterval: 50 * time.Millisecond}
+	chA := make(chan *cluster.Message, 10)
+	if err := a.Start(func(msg *cluster.Message) { chA <- msg }); err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+	b := &cluster.Mesh{ID: "b", Addr: "127.0.0.1:0", Peers: map[string]string{"a": a.ListenAddr().String()}}
+	chB := make(chan *cluster.Message, 10)
+	if err := b.Start(func(msg *cluster.Message) { chB <- msg }); err != nil {
+		t.Fatal(err)
+	}
+	a.AddPeer("b", b.ListenAddr().String())
+	recv(t, chA, cluster.KindNodeUp)
+	recv(t, chB, cluster.KindNodeUp)
+
+	b.Send(&cluster.Message{Kind: cluster.KindRoom, Key: "room1", Data: []byte("hello")})
+	msg := recv(t, chA, cluster.KindRoom)
+	if msg.From != "b" || msg.To != "a" || msg.Key != "room1" || string(msg.Data) != "hello" {
+		t.Fatalf("got %+v", msg)
+	}
+
+	b.Close()
+	if msg := recv(t, chA, cluster.KindNodeDown); msg.From != "b" {
+		t.Fatalf("got node down from %v, want b", msg.From)
+	}
+	if err := a.Send(&cluster.Message{Kind: cluster.KindUser, To: "b"}); err != cluster.ErrNodeDown {
+		t.Fatalf("got %v, want ErrNodeDown", err)
+	}
+}
+
+func TestDirectory(t *testing.T) {
+	d := cluster.NewDirectory()
+	d.Add("u1", "b")
+	d.Add("u1", "a")
+	d.Add("u2", "b")
+	if nodes := d.Lookup("u1"); len(nodes) != 2 || nodes[0] != "a" || nodes[1] != "b" {
+		t.Fatalf("got %v, want [a b]", nodes)
+	}
+	d.RemoveNode("b")
+	if nodes := d.Lookup("u1"); len(nodes) != 1 || nodes[0] != "a" {
+		t.Fatalf("got %v, want [a]", nodes)
+	}
+	if nodes := d.Lookup("u2"); len(nodes) != 0 {
+		t.Fatalf("got %v, want []", nodes)
+	}
+	d.Remove("u1", "a")
+	if d.Count("a") != 0 {
+		t.Fatalf("got %v users on a, want 0", d.Count("a"))
+	}
+}
+
+func TestMeshAuth(t *testing.T) {
+	a := &cluster.Mesh{ID: "a", Addr: "127.0.0.1:0", Secret: "s3cret", RetryInterval: 50 * time.Millisecond}
+	chA := make(chan *cluster.Message, 10)
+	if err := a.Start(func(msg *cluster.Message) { chA <- msg }); err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+	addr := a.ListenAddr().String()
+
+	//没有认证的连接发的消息不处理
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.Write([]byte{0, 0, 0, 10, cluster.KindRoom, 0, 0, 0, 0, 'x', 'x', 'x', 'x', 'x'})
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := io.ReadAll(conn); err != nil {
+		t.Fatalf("unauthenticated conn should be closed, got %v", err)
+	}
+
+	//密钥不对的节点连不上
+	c := &cluster.Mesh{ID: "c", Addr: "127.0.0.1:0", Secret: "wrong", Peers: map[string]string{"a": addr}, RetryInterval: 50 * time.Millisecond}
+	chC := make(chan *cluster.Message, 10)
+	if err := c.Start(func(msg *cluster.Message) { chC <- msg }); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	b := &cluster.Mesh{ID: "b", Addr: "127.0.0.1:0", Secret: "s3cret", Peers: map[string]string{"a": addr}}
+	chB := make(chan *cluster.Message, 10)
+	if err := b.Start(func(msg *cluster.Message) { chB <- msg }); err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+	recv(t, chB, cluster.KindNodeUp)
+	b.Send(&cluster.Message{Kind: cluster.KindRoom, To: "a", Key: "room1"})
+	if msg := recv(t, chA, cluster.KindRoom); msg.From != "b" {
+		t.Fatalf("got %+v", msg)
+	}
+
+	select {
+	case msg := <-chC:
+		t.Fatalf("node with wrong secret got %+v", msg)
+	case <-time.After(200 * time.Millisecond):
+	}
+	select {
+	case msg := <-chA:
+		t.Fatalf("unexpected message %+v", msg)
+	default:
+	}
+}
+
+func TestEncodeUsers(t *testing.T) {
+	users := []string{"u1", "", "user-with-long-id"}
+	got, err := cluster.DecodeUsers(cluster.EncodeUsers(users))
+	if err != nil || !reflect.DeepEqual(got, users) {
+		t.Fatalf("got %v, %v", got, err)
+	}
+	if _, err := cluster.DecodeUsers([]byte{0, 5, 'a'}); err == nil {
+		t.Fatal("decode truncated data should fail")
+	}
+}
@@ -0,0 +1,86 @@
+/*
+ * @Author: yujiaxun
+ * @Date: 2026-10-19 23:26:40
+ * @LastEditTime: 2026-10-19 23:26:40
+ * @Description: 用户所在的网关节点
+ */
+
+package cluster
+
+import (
+	"sort"
+	"sync"
+)
+
+// Directory 记录其他节点上线的用户, 由KindOnline/KindOffline/KindNodeDown维护
+type Directory struct {
+	mutex sync.RWMutex
+	users map[string]map[string]bool //用户id -> 节点
+	nodes map[string]map[string]bool //节点 -> 用户id
+}
+
+func NewDirectory() *Directory {
+	d := new(Directory)
+	d.users = make(map[string]map[string]bool)
+	d.nodes = make(map[string]map[string]bool)
+	return d
+}
+
+func (d *Directory) Add(userID string, node string) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	add(d.users, userID, node)
+	add(d.nodes, node, userID)
+}
+
+func (d *Directory) Remove(userID string, node string) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	remove(d.users, userID, node)
+	remove(d.nodes, node, userID)
+}
+
+// RemoveNode 节点断开, 去掉这个节点上的所有用户
+func (d *Directory) RemoveNode(node string) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	for userID := range d.nodes[node] {
+		remove(d.users, userID, node)
+	}
+	delete(d.nodes, node)
+}
+
+// Lookup 用户所在的节点, 按节点id排序
+func (d *Directory) Lookup(userID string) []string {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+	nodes := make([]string, 0, len(d.users[userID]))
+	for node := range d.users[userID] {
+		nodes = append(nodes, node)
+	}
+	sort.Strings(nodes)
+	return nodes
+}
+
+// Count 节点上在线的用户数
+func (d *Directory) Count(node string) int {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+	return len(d.nodes[node])
+}
+
+func add(m map[string]map[string]bool, key string, value string) {
+	set, ok := m[key]
+	if !ok {
+		set = make(map[string]bool)
+		m[key] = set
+	}
+	set[value] = true
+}
+
+func remove(m map[string]map[string]bool, key string, value string) {
+	delete(m[key], value)
+	if len(m[key]) == 0 {
+		delete(m, key)
+	}
+}
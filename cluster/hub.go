@@ -0,0 +1,141 @@
+/*
+ * @Author: yujiaxun
+ * @Date: 2026-10-19 23:15:02
+ * @LastEditTime: 2026-10-19 23:15:02
+ * @Description: 进程内的消息总线
+ */
+
+package cluster
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Hub 同一个进程里的多个网关节点通过Hub互相发消息, 一般用于测试
+type Hub struct {
+	PendingNum int //每个节点待处理的消息数, 默认1024
+
+	mutex sync.Mutex
+	nodes map[string]*localBus
+}
+
+func NewHub() *Hub {
+	hub := new(Hub)
+	hub.nodes = make(map[string]*localBus)
+	return hub
+}
+
+// Node 返回节点id为id的总线, Start之后加入Hub
+func (hub *Hub) Node(id string) Bus {
+	return &localBus{hub: hub, id: id}
+}
+
+type localBus struct {
+	hub       *Hub
+	id        string
+	handler   func(msg *Message)
+	msgChan   chan *Message
+	closeChan chan bool
+	wg        sync.WaitGroup
+}
+
+func (b *localBus) NodeID() string {
+	return b.id
+}
+
+func (b *localBus) Start(handler func(msg *Message)) error {
+	pendingNum := b.hub.PendingNum
+	if pendingNum <= 0 {
+		pendingNum = 1024
+	}
+	b.handler = handler
+	b.msgChan = make(chan *Message, pendingNum)
+	b.closeChan = make(chan bool)
+
+	b.hub.mutex.Lock()
+	if _, ok := b.hub.nodes[b.id]; ok {
+		b.hub.mutex.Unlock()
+		return fmt.Errorf("node %v already in hub", b.id)
+	}
+	var others []*localBus
+	for _, other := range b.hub.nodes {
+		others = append(others, other)
+	}
+	b.hub.nodes[b.id] = b
+	b.hub.mutex.Unlock()
+
+	b.wg.Add(1)
+	go b.loop()
+	for _, other := range others {
+		other.post(&Message{Kind: KindNodeUp, From: b.id, To: other.id})
+		b.post(&Message{Kind: KindNodeUp, From: other.id, To: b.id})
+	}
+	return nil
+}
+
+func (b *localBus) loop() {
+	defer b.wg.Done()
+	for {
+		select {
+		case msg := <-b.msgChan:
+			b.handler(msg)
+		case <-b.closeChan:
+			return
+		}
+	}
+}
+
+func (b *localBus) post(msg *Message) error {
+	select {
+	case b.msgChan <- msg:
+		return nil
+	default:
+		return ErrBusBusy
+	}
+}
+
+func (b *localBus) Send(msg *Message) error {
+	b.hub.mutex.Lock()
+	defer b.hub.mutex.Unlock()
+	if b.hub.nodes[b.id] != b {
+		return ErrBusClosed
+	}
+	if msg.To != "" {
+		node, ok := b.hub.nodes[msg.To]
+		if !ok {
+			return ErrUnknownNode
+		}
+		m := *msg
+		m.From = b.id
+		return node.post(&m)
+	}
+	var err error
+	for id, node := range b.hub.nodes {
+		if id == b.id {
+			continue
+		}
+		m := *msg
+		m.From = b.id
+		if e := node.post(&m); e != nil {
+			err = e
+		}
+	}
+	return err
+}
+
+func (b *localBus) Close() {
+	b.hub.mutex.Lock()
+	if b.hub.nodes[b.id] != b {
+		b.hub.mutex.Unlock()
+		return
+	}
+	delete(b.hub.nodes, b.id)
+	for _, other := range b.hub.nodes {
+		other.post(&Message{Kind: KindNodeDown, From: b.id, To: other.id})
+	}
+	b.hub.mutex.Unlock()
+
+	close(b.closeChan)
+	b.wg.Wait()
+}
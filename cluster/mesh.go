@@ -0,0 +1,418 @@
+/*
+ * @Author: yujiaxun
+ * @Date: 2026-10-19 23:38:15
+ * @LastEditTime: 2026-10-19 23:38:15
+ * @Description: 网关节点之间的tcp全连接
+ */
+
+package cluster
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"test/logger"
+	"test/network"
+)
+
+// 设置了Secret时, 连进来的连接先握手: 接受方发送nonceLen字节的随机数,
+// 连接方回一条kindAuth消息, From为自己的节点id, Data为HMAC-SHA256(Secret, 随机数 + 节点id),
+// 接受方验证通过后回1个字节, 验证失败直接断开
+const (
+	kindAuth byte = 0x80
+	nonceLen      = 16
+)
+
+var errAuthFailed = errors.New("cluster auth failed")
+
+// Mesh 每个节点监听Addr, 并主动连接每个对端, 发消息只走自己连出去的连接
+// 连出去的连接建立时产生KindNodeUp, 断开时产生KindNodeDown
+type Mesh struct {
+	ID              string
+	Addr            string
+	Peers           map[string]string //节点id -> 地址, 不包括自己
+	Secret          string            //节点之间的共享密钥, 所有节点要一致, 为空时不认证, 只能用在可信的内网
+	PendingWriteNum int
+	MaxMsgLen       uint32
+	DialTimeout     time.Duration
+	RetryInterval   time.Duration
+	WriteTimeout    time.Duration
+
+	handler   func(msg *Message)
+	parser    *network.MsgParser
+	ln        net.Listener
+	mutex     sync.Mutex
+	peers     map[string]*peer
+	conns     map[net.Conn]bool //连进来的连接
+	closeFlag bool
+	wg        sync.WaitGroup
+}
+
+type peer struct {
+	id        string
+	addr      string
+	writeChan chan *Message
+	closeChan chan bool
+	conn      net.Conn //已经连上时不为nil
+}
+
+func (m *Mesh) NodeID() string {
+	return m.ID
+}
+
+func (m *Mesh) init() {
+	if m.PendingWriteNum <= 0 {
+		m.PendingWriteNum = 1024
+		logger.Release("invalid PendingWriteNum, reset to %v", m.PendingWriteNum)
+	}
+	if m.MaxMsgLen <= 0 {
+		m.MaxMsgLen = 1024 * 1024
+	}
+	if m.DialTimeout <= 0 {
+		m.DialTimeout = 3 * time.Second
+	}
+	if m.RetryInterval <= 0 {
+		m.RetryInterval = 3 * time.Second
+	}
+	if m.WriteTimeout <= 0 {
+		m.WriteTimeout = 10 * time.Second
+	}
+	m.parser = network.NewMsgParser()
+	m.parser.SetMsgLen(4, 5, m.MaxMsgLen)
+	m.peers = make(map[string]*peer)
+	m.conns = make(map[net.Conn]bool)
+}
+
+func (m *Mesh) Start(handler func(msg *Message)) error {
+	m.init()
+	m.handler = handler
+	ln, err := net.Listen("tcp", m.Addr)
+	if err != nil {
+		return err
+	}
+	m.ln = ln
+	m.wg.Add(1)
+	go m.accept()
+	for id, addr := range m.Peers {
+		m.AddPeer(id, addr)
+	}
+	return nil
+}
+
+// ListenAddr 实际监听的地址, Addr的端口为0时使用
+func (m *Mesh) ListenAddr() net.Addr {
+	return m.ln.Addr()
+}
+
+// AddPeer 运行时加入新节点, 已经存在时先断开旧的
+func (m *Mesh) AddPeer(id string, addr string) {
+	if id == m.ID {
+		return
+	}
+	m.RemovePeer(id)
+	p := &peer{
+		id:        id,
+		addr:      addr,
+		writeChan: make(chan *Message, m.PendingWriteNum),
+		closeChan: make(chan bool),
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.closeFlag {
+		return
+	}
+	m.peers[id] = p
+	m.wg.Add(1)
+	go m.keepPeer(p)
+}
+
+func (m *Mesh) RemovePeer(id string) {
+	m.mutex.Lock()
+	p, ok := m.peers[id]
+	delete(m.peers, id)
+	m.mutex.Unlock()
+	if ok {
+		m.closePeer(p)
+	}
+}
+
+func (m *Mesh) closePeer(p *peer) {
+	m.mutex.Lock()
+	conn := p.conn
+	m.mutex.Unlock()
+	close(p.closeChan)
+	if conn != nil {
+		conn.Close()
+	}
+}
+
+// keepPeer 维持到对端的连接, 断开后重连
+func (m *Mesh) keepPeer(p *peer) {
+	defer m.wg.Done()
+	for {
+		conn, err := net.DialTimeout("tcp", p.addr, m.DialTimeout)
+		if err == nil && m.Secret != "" {
+			if err = m.login(conn); err != nil {
+				conn.Close()
+			}
+		}
+		if err == nil {
+			m.mutex.Lock()
+			select {
+			case <-p.closeChan:
+				m.mutex.Unlock()
+				conn.Close()
+				return
+			default:
+			}
+			p.conn = conn
+			m.mutex.Unlock()
+
+			logger.Debug("cluster node %v connected", p.id)
+			//先开始发送再通知上层, 上层收到KindNodeUp后可能马上发很多消息
+			done := make(chan bool)
+			go func() {
+				m.writePeer(p, conn)
+				close(done)
+			}()
+			m.handler(&Message{Kind: KindNodeUp, From: p.id, To: m.ID})
+			<-done
+			conn.Close()
+			m.mutex.Lock()
+			p.conn = nil
+			m.mutex.Unlock()
+			logger.Debug("cluster node %v disconnected", p.id)
+			m.handler(&Message{Kind: KindNodeDown, From: p.id, To: m.ID})
+		} else {
+			logger.Debug("dial cluster node %v error: %v", p.id, err)
+		}
+
+		select {
+		case <-p.closeChan:
+			return
+		case <-time.After(m.RetryInterval):
+		}
+	}
+}
+
+func (m *Mesh) writePeer(p *peer, conn net.Conn) {
+	//对端不会在这条连接上发消息, 读到错误说明连接断了
+	done := make(chan bool)
+	go func() {
+		io.Copy(io.Discard, conn)
+		close(done)
+	}()
+	for {
+		select {
+		case msg := <-p.writeChan:
+			head, err := encodeHead(msg)
+			if err != nil {
+				logger.Error("encode cluster message error: %v", err)
+				continue
+			}
+			conn.SetWriteDeadline(time.Now().Add(m.WriteTimeout))
+			if err := m.parser.Write(conn, head, msg.Data); err != nil {
+				logger.Debug("write cluster node %v error: %v", p.id, err)
+				return
+			}
+		case <-done:
+			return
+		case <-p.closeChan:
+			return
+		}
+	}
+}
+
+func (m *Mesh) Send(msg *Message) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.closeFlag {
+		return ErrBusClosed
+	}
+	if msg.To != "" {
+		p, ok := m.peers[msg.To]
+		if !ok {
+			return ErrUnknownNode
+		}
+		return m.post(p, msg)
+	}
+	var err error
+	for _, p := range m.peers {
+		if e := m.post(p, msg); e != nil && e != ErrNodeDown {
+			err = e
+		}
+	}
+	return err
+}
+
+func (m *Mesh) post(p *peer, msg *Message) error {
+	if p.conn == nil {
+		return ErrNodeDown
+	}
+	out := *msg
+	out.From = m.ID
+	out.To = p.id
+	select {
+	case p.writeChan <- &out:
+		return nil
+	default:
+		return ErrBusBusy
+	}
+}
+
+func (m *Mesh) accept() {
+	defer m.wg.Done()
+	var tempDelay time.Duration
+	for {
+		conn, err := m.ln.Accept()
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Timeout() {
+				if tempDelay == 0 {
+					tempDelay = 5 * time.Millisecond
+				} else {
+					tempDelay *= 2
+				}
+				if max := 1 * time.Second; tempDelay > max {
+					tempDelay = max
+				}
+				time.Sleep(tempDelay)
+				continue
+			}
+			return
+		}
+		tempDelay = 0
+
+		m.mutex.Lock()
+		if m.closeFlag {
+			m.mutex.Unlock()
+			conn.Close()
+			return
+		}
+		m.conns[conn] = true
+		m.wg.Add(1)
+		m.mutex.Unlock()
+		go m.read(conn)
+	}
+}
+
+// read 读取对端连进来的连接上的消息
+func (m *Mesh) read(conn net.Conn) {
+	defer m.wg.Done()
+	defer func() {
+		m.mutex.Lock()
+		delete(m.conns, conn)
+		m.mutex.Unlock()
+		conn.Close()
+	}()
+	var from string //认证过的节点id
+	if m.Secret != "" {
+		var err error
+		if from, err = m.authenticate(conn); err != nil {
+			logger.Error("cluster connection from %v auth error: %v", conn.RemoteAddr(), err)
+			return
+		}
+	}
+	for {
+		data, err := m.parser.Read(conn)
+		if err != nil {
+			return
+		}
+		msg, err := decodeMessage(data)
+		if err != nil {
+			logger.Debug("decode cluster message from %v error: %v", conn.RemoteAddr(), err)
+			return
+		}
+		if msg.Kind == KindNodeUp || msg.Kind == KindNodeDown || msg.Kind == kindAuth {
+			continue
+		}
+		if from != "" && msg.From != from {
+			logger.Error("cluster node %v send message as %v", from, msg.From)
+			return
+		}
+		m.handler(msg)
+	}
+}
+
+func (m *Mesh) Close() {
+	m.mutex.Lock()
+	if m.closeFlag || m.ln == nil {
+		m.mutex.Unlock()
+		return
+	}
+	m.closeFlag = true
+	m.ln.Close()
+	for conn := range m.conns {
+		conn.Close()
+	}
+	peers := m.peers
+	m.peers = nil
+	m.mutex.Unlock()
+
+	for _, p := range peers {
+		m.closePeer(p)
+	}
+	m.wg.Wait()
+}
+
+// authenticate 接受方的握手, 返回对端的节点id
+func (m *Mesh) authenticate(conn net.Conn) (string, error) {
+	nonce := make([]byte, nonceLen)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	conn.SetDeadline(time.Now().Add(m.DialTimeout))
+	defer conn.SetDeadline(time.Time{})
+	if _, err := conn.Write(nonce); err != nil {
+		return "", err
+	}
+	data, err := m.parser.Read(conn)
+	if err != nil {
+		return "", err
+	}
+	msg, err := decodeMessage(data)
+	if err != nil {
+		return "", err
+	}
+	if msg.Kind != kindAuth || msg.From == "" || !hmac.Equal(msg.Data, m.sign(nonce, msg.From)) {
+		return "", errAuthFailed
+	}
+	if _, err := conn.Write([]byte{1}); err != nil {
+		return "", err
+	}
+	return msg.From, nil
+}
+
+// login 连接方的握手
+func (m *Mesh) login(conn net.Conn) error {
+	conn.SetDeadline(time.Now().Add(m.DialTimeout))
+	defer conn.SetDeadline(time.Time{})
+	nonce := make([]byte, nonceLen)
+	if _, err := io.ReadFull(conn, nonce); err != nil {
+		return err
+	}
+	head, err := encodeHead(&Message{Kind: kindAuth, From: m.ID})
+	if err != nil {
+		return err
+	}
+	if err := m.parser.Write(conn, head, m.sign(nonce, m.ID)); err != nil {
+		return err
+	}
+	ok := make([]byte, 1)
+	if _, err := io.ReadFull(conn, ok); err != nil {
+		return errAuthFailed
+	}
+	return nil
+}
+
+func (m *Mesh) sign(nonce []byte, id string) []byte {
+	mac := hmac.New(sha256.New, []byte(m.Secret))
+	mac.Write(nonce)
+	mac.Write([]byte(id))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,227 @@
+/*
+ * @Author: yujiaxun
+ * @Date: 2026-10-21 14:05:22
+ * @LastEditTime: 2026-10-21 14:05:22
+ * @Description: 独立运行的网关, 按配置文件启动
+ */
+
+package main
+
+// 用法:
+//
+//	gate -config gate.yaml [-addr :8880] [-admin 127.0.0.1:9090] [-log-level debug]
+//	gate -config gate.yaml -check         //只校验配置并打印生效的配置
+//
+// 信号:
+//
+//	SIGINT, SIGTERM  排空连接后退出
+//	SIGHUP           重新加载配置文件, 配置文件变化时也会自动重新加载, 见config.Reload
+//	SIGUSR2          server.hot_restart为true时热重启
+//
+// 退出码:
+//
+//	0  正常退出, 或者-h打印用法
+//	1  运行时出错, 例如监听失败
+//	2  参数或者配置错误
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"test/config"
+	"test/gate"
+	"test/logger"
+)
+
+const (
+	exitOK     = 0
+	exitError  = 1
+	exitConfig = 2
+)
+
+// errUnexpectedArgs 参数里有flag之外的内容
+var errUnexpectedArgs = errors.New("unexpected arguments")
+
+type options struct {
+	file     string
+	addr     string
+	admin    string
+	logLevel string
+	check    bool
+	watch    time.Duration
+}
+
+func main() {
+	os.Exit(run(os.Args[1:]))
+}
+
+func run(args []string) int {
+	opts, err := parseFlags(args)
+	if errors.Is(err, flag.ErrHelp) {
+		return exitOK
+	}
+	if err != nil {
+		return exitConfig
+	}
+	conf, err := loadConfig(opts)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitConfig
+	}
+	if opts.check {
+		fmt.Print(conf)
+		return exitOK
+	}
+
+	l, err := conf.NewLogger()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitConfig
+	}
+	logger.Export(l)
+	defer l.Close()
+	conf.Print()
+
+	g := conf.NewGate()
+	g.Processor = rawProcessor{}
+	g.Notice = func(text string) interface{} {
+		return []byte(text)
+	}
+	if len(g.Backends) == 0 {
+		logger.Release("no backend configured, client messages are dropped")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan bool)
+	var serveErr error
+	go func() {
+		serveErr = g.Serve(ctx)
+		close(done)
+	}()
+
+	fileChanged := make(chan bool, 1)
+	if opts.file != "" && opts.watch > 0 {
+		go watchFile(opts.file, opts.watch, fileChanged, done)
+	}
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	defer signal.Stop(c)
+	for {
+		select {
+		case <-done:
+			//启动失败, 或者热重启之后旧进程排空完成
+			return exitCode(serveErr)
+		case <-fileChanged:
+			logger.Release("config file %v changed, reload", opts.file)
+			conf = reload(g, conf, opts)
+		case sig := <-c:
+			if sig == syscall.SIGHUP {
+				logger.Release("receive SIGHUP, reload config")
+				conf = reload(g, conf, opts)
+				continue
+			}
+			logger.Release("receive signal %v, shutting down", sig)
+			cancel()
+			<-done
+			return exitCode(serveErr)
+		}
+	}
+}
+
+func exitCode(err error) int {
+	if err != nil {
+		logger.Error("gate exit: %v", err)
+		return exitError
+	}
+	logger.Release("gate exit")
+	return exitOK
+}
+
+func parseFlags(args []string) (*options, error) {
+	opts := new(options)
+	fs := flag.NewFlagSet("gate", flag.ContinueOnError)
+	fs.StringVar(&opts.file, "config", "", "config file, .json, .yaml or .toml")
+	fs.StringVar(&opts.addr, "addr", "", "websocket listen address, overrides server.addr")
+	fs.StringVar(&opts.admin, "admin", "", "admin listen address, overrides admin.addr")
+	fs.StringVar(&opts.logLevel, "log-level", "", "debug, release, error or fatal, overrides log.level")
+	fs.BoolVar(&opts.check, "check", false, "validate the config, print the effective config and exit")
+	fs.DurationVar(&opts.watch, "watch", 2*time.Second, "interval to check the config file for changes, 0 disables")
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if fs.NArg() > 0 {
+		fmt.Fprintf(os.Stderr, "unexpected arguments %v\n", fs.Args())
+		fs.Usage()
+		return nil, errUnexpectedArgs
+	}
+	return opts, nil
+}
+
+// loadConfig 默认值 < 配置文件 < 环境变量 < 命令行参数
+func loadConfig(opts *options) (*config.Config, error) {
+	conf, err := config.Parse(opts.file)
+	if err != nil {
+		return nil, err
+	}
+	if opts.addr != "" {
+		conf.Server.Addr = opts.addr
+	}
+	if opts.admin != "" {
+		conf.Admin.Addr = opts.admin
+	}
+	if opts.logLevel != "" {
+		conf.Log.Level = opts.logLevel
+	}
+	if err := conf.Validate(); err != nil {
+		return nil, err
+	}
+	return conf, nil
+}
+
+// reload 重新读取配置文件并应用可以热更新的部分, 出错时继续使用旧的配置
+func reload(g *gate.Gate, old *config.Config, opts *options) *config.Config {
+	conf, err := loadConfig(opts)
+	if err != nil {
+		logger.Error("reload config error: %v", err)
+		return old
+	}
+	config.Reload(g, old, conf)
+	return conf
+}
+
+// watchFile 定时检查配置文件的修改时间和大小, 变化时发送到c
+func watchFile(file string, interval time.Duration, c chan<- bool, closeChan <-chan bool) {
+	stat := func() (time.Time, int64) {
+		info, err := os.Stat(file)
+		if err != nil {
+			return time.Time{}, -1
+		}
+		return info.ModTime(), info.Size()
+	}
+	modTime, size := stat()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-closeChan:
+			return
+		case <-ticker.C:
+		}
+		t, n := stat()
+		if n < 0 || t.Equal(modTime) && n == size {
+			continue
+		}
+		modTime, size = t, n
+		select {
+		case c <- true:
+		default:
+		}
+	}
+}
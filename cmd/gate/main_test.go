@@ -0,0 +1,169 @@
+/*
+ * @Author: yujiaxun
+ * @Date: 2026-10-22 16:20:14
+ * @LastEditTime: 2026-10-22 16:20:14
+ * @Description: xxx
+ */
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"test/logger"
+)
+
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	file := filepath.Join(t.TempDir(), "gate.yaml")
+	if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func TestParseFlags(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want options
+		err  bool
+	}{
+		{"default", nil, options{watch: 2 * time.Second}, false},
+		{"all", []string{"-config", "gate.yaml", "-addr", ":8880", "-admin", "127.0.0.1:9090", "-log-level", "debug", "-check", "-watch", "0"},
+			options{file: "gate.yaml", addr: ":8880", admin: "127.0.0.1:9090", logLevel: "debug", check: true}, false},
+		{"unknown flag", []string{"-port", "8880"}, options{}, true},
+		{"bad duration", []string{"-watch", "soon"}, options{}, true},
+		{"extra args", []string{"-config", "gate.yaml", "extra"}, options{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts, err := parseFlags(tt.args)
+			if tt.err {
+				if err == nil {
+					t.Fatalf("parseFlags(%v) = %+v, want error", tt.args, opts)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if *opts != tt.want {
+				t.Fatalf("parseFlags(%v) = %+v, want %+v", tt.args, *opts, tt.want)
+			}
+		})
+	}
+
+	if _, err := parseFlags([]string{"-h"}); !errors.Is(err, flag.ErrHelp) {
+		t.Fatalf("-h error %v, want flag.ErrHelp", err)
+	}
+	if _, err := parseFlags([]string{"extra"}); !errors.Is(err, errUnexpectedArgs) {
+		t.Fatalf("extra args error %v, want errUnexpectedArgs", err)
+	}
+}
+
+func TestLoadConfigPrecedence(t *testing.T) {
+	file := writeConfig(t, "server:\n  addr: \":1000\"\nlog:\n  level: error\n")
+	tests := []struct {
+		name     string
+		env      string
+		flag     string
+		wantAddr string
+	}{
+		{"file", "", "", ":1000"},
+		{"env over file", ":2000", "", ":2000"},
+		{"flag over env", ":2000", ":3000", ":3000"},
+		{"flag over file", "", ":3000", ":3000"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.env != "" {
+				t.Setenv("GATE_SERVER_ADDR", tt.env)
+			}
+			conf, err := loadConfig(&options{file: file, addr: tt.flag})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if conf.Server.Addr != tt.wantAddr {
+				t.Fatalf("server.addr = %v, want %v", conf.Server.Addr, tt.wantAddr)
+			}
+			if conf.Log.Level != "error" {
+				t.Fatalf("log.level = %v, want error from file", conf.Log.Level)
+			}
+		})
+	}
+
+	t.Setenv("GATE_LOG_LEVEL", "release")
+	conf, err := loadConfig(&options{file: file, logLevel: "debug", admin: "127.0.0.1:9090"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if conf.Log.Level != "debug" || conf.Admin.Addr != "127.0.0.1:9090" {
+		t.Fatalf("log.level = %v, admin.addr = %v, want flag values", conf.Log.Level, conf.Admin.Addr)
+	}
+
+	if _, err := loadConfig(&options{file: file, logLevel: "verbose"}); err == nil {
+		t.Fatal("invalid log level from flag accepted")
+	}
+}
+
+func TestRunExitCode(t *testing.T) {
+	valid := writeConfig(t, "server:\n  addr: \"127.0.0.1:0\"\n")
+	invalid := writeConfig(t, "server:\n  addr: \"127.0.0.1:0\"\n  max_conn_num: -1\n")
+	missing := filepath.Join(t.TempDir(), "missing.yaml")
+
+	tests := []struct {
+		name string
+		args []string
+		want int
+	}{
+		{"help", []string{"-h"}, exitOK},
+		{"bad flag", []string{"-port", "8880"}, exitConfig},
+		{"extra args", []string{"-config", valid, "extra"}, exitConfig},
+		{"missing file", []string{"-config", missing, "-check"}, exitConfig},
+		{"invalid config", []string{"-config", invalid, "-check"}, exitConfig},
+		{"invalid flag value", []string{"-config", valid, "-addr", "8880", "-check"}, exitConfig},
+		{"check", []string{"-config", valid, "-check"}, exitOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := run(tt.args); got != tt.want {
+				t.Fatalf("run(%v) = %v, want %v", tt.args, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRunListenError(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	//run会替换并关闭全局logger, 结束后换回一个可用的
+	defer func() {
+		l, _ := logger.New("debug", "", log.LstdFlags)
+		logger.Export(l)
+	}()
+
+	file := writeConfig(t, "server:\n  addr: \""+ln.Addr().String()+"\"\n")
+	if got := run([]string{"-config", file, "-watch", "0"}); got != exitError {
+		t.Fatalf("run on a used port = %v, want %v", got, exitError)
+	}
+}
+
+func TestExitCode(t *testing.T) {
+	if got := exitCode(nil); got != exitOK {
+		t.Fatalf("exitCode(nil) = %v, want %v", got, exitOK)
+	}
+	if got := exitCode(errors.New("listen failed")); got != exitError {
+		t.Fatalf("exitCode(err) = %v, want %v", got, exitError)
+	}
+}
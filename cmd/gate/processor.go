@@ -0,0 +1,46 @@
+/*
+ * @Author: yujiaxun
+ * @Date: 2026-10-21 14:05:22
+ * @LastEditTime: 2026-10-21 14:05:22
+ * @Description: 不解析消息内容, 按消息头的id转发到后端
+ */
+
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"strconv"
+
+	"test/logger"
+)
+
+// rawProcessor 客户端消息的前2个字节是大端的消息id, 用十进制的id作为路由键转发
+// 路由表里可以用 "1000-1999" 这样的范围把一段消息id转发到一个服务
+type rawProcessor struct{}
+
+func (rawProcessor) Unmarshal(data []byte) (interface{}, error) {
+	return data, nil
+}
+
+func (rawProcessor) Marshal(msg interface{}) ([]byte, error) {
+	data, ok := msg.([]byte)
+	if !ok {
+		return nil, errors.New("raw processor only marshals []byte")
+	}
+	return data, nil
+}
+
+func (rawProcessor) RouteKey(msg interface{}) (string, bool) {
+	data := msg.([]byte)
+	if len(data) < 2 {
+		return "", true
+	}
+	return strconv.Itoa(int(binary.BigEndian.Uint16(data))), true
+}
+
+// Route 没有配置后端时才会调用, 消息直接丢弃
+func (rawProcessor) Route(msg interface{}, userData interface{}) error {
+	logger.Debug("no backend, drop message")
+	return nil
+}
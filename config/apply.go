@@ -0,0 +1,125 @@
+/*
+ * @Author: yujiaxun
+ * @Date: 2026-10-21 11:46:19
+ * @LastEditTime: 2026-10-21 11:46:19
+ * @Description: 把配置转成Gate, WSServer和Logger
+ */
+
+package config
+
+import (
+	"log"
+	"strings"
+	"time"
+
+	"test/gate"
+	"test/logger"
+	"test/network"
+)
+
+// NewGate 按配置创建Gate, Processor, Notice这些只能在代码里设置的字段由调用方填上
+func (c *Config) NewGate() *gate.Gate {
+	g := new(gate.Gate)
+	s := &c.Server
+	g.WSAddr = s.Addr
+	g.MaxConnNum = s.MaxConnNum
+	g.PendingWriteNum = s.PendingWriteNum
+	g.PendingReadNum = s.PendingReadNum
+	g.MaxMsgLen = s.MaxMsgLen
+	g.HTTPTimeout = time.Duration(s.HTTPTimeout)
+	g.PongWait = time.Duration(s.PongWait)
+	g.HttpsFlag = s.HTTPS
+	g.CertFile = s.CertFile
+	g.KeyFile = s.KeyFile
+	g.DrainTimeout = time.Duration(s.DrainTimeout)
+	g.DrainNotice = s.DrainNotice
+	g.HotRestart = s.HotRestart
+	g.RestartTimeout = time.Duration(s.RestartTimeout)
+
+	g.MaxConnPerIP = c.Limit.MaxConnPerIP
+	g.UpgradePerSec = c.Limit.UpgradePerSec
+	g.UpgradeBurst = c.Limit.UpgradeBurst
+	g.AllowedOrigins = s.AllowedOrigins
+	g.BanList = c.newBanList()
+	g.ConnRateLimit = c.Limit.Conn.RateLimit()
+	g.IPRateLimit = c.Limit.IP.RateLimit()
+
+	ss := &c.Session
+	g.ResumeWait = time.Duration(ss.ResumeWait)
+	g.ReplayBufferNum = ss.ReplayBufferNum
+	g.AckTimeout = time.Duration(ss.AckTimeout)
+	g.LoginPolicy = loginPolicies[ss.LoginPolicy]
+	g.MaxUserSessions = ss.MaxUserSessions
+
+	g.Backends = c.Backend.Services
+	g.Balancers = c.Backend.Balancers
+	g.BackendConnNum = c.Backend.ConnNum
+	g.RouteFile = c.Backend.RouteFile
+
+	g.AdminAddr = c.Admin.Addr
+	g.AdminToken = c.Admin.Token
+	return g
+}
+
+// NewWSServer 不使用Gate, 直接使用WSServer时按配置创建, NewAgent由调用方设置
+func (c *Config) NewWSServer() *network.WSServer {
+	s := &c.Server
+	server := new(network.WSServer)
+	server.Addr = s.Addr
+	server.MaxConnNum = s.MaxConnNum
+	server.PendingWriteNum = s.PendingWriteNum
+	server.PendingReadNum = s.PendingReadNum
+	server.ReadBufferSize = int(s.MaxMsgLen)
+	server.WriteBufferSize = int(s.MaxMsgLen)
+	server.HTTPTimeout = time.Duration(s.HTTPTimeout)
+	server.PongWait = time.Duration(s.PongWait)
+	server.HttpsFlag = s.HTTPS
+	server.CertFile = s.CertFile
+	server.KeyFile = s.KeyFile
+	server.DrainTimeout = time.Duration(s.DrainTimeout)
+	server.MaxConnPerIP = c.Limit.MaxConnPerIP
+	server.UpgradePerSec = c.Limit.UpgradePerSec
+	server.UpgradeBurst = c.Limit.UpgradeBurst
+	server.AllowedOrigins = s.AllowedOrigins
+	server.BanList = c.newBanList()
+	server.ConnRateLimit = c.Limit.Conn.RateLimit()
+	server.IPRateLimit = c.Limit.IP.RateLimit()
+	return server
+}
+
+func (c *Config) newBanList() *network.BanList {
+	list := network.NewBanList()
+	for _, ip := range c.Limit.Bans {
+		list.Ban(ip, 0, banReason)
+	}
+	return list
+}
+
+func (c *Config) NewLogger() (*logger.Logger, error) {
+	return logger.New(strings.ToLower(c.Log.Level), c.Log.Path, log.LstdFlags)
+}
+
+// RateLimit 没有配置时返回nil, 表示不限流
+func (r *RateLimitConfig) RateLimit() *network.RateLimit {
+	if r == nil {
+		return nil
+	}
+	return &network.RateLimit{
+		MsgPerSec:   r.MsgPerSec,
+		MsgBurst:    r.MsgBurst,
+		BytesPerSec: r.BytesPerSec,
+		BytesBurst:  r.BytesBurst,
+		Action:      limitActions[r.Action],
+		MaxWarn:     r.MaxWarn,
+		BanTime:     time.Duration(r.BanTime),
+	}
+}
+
+// Print 启动时打印生效的配置和覆盖了配置的环境变量
+func (c *Config) Print() {
+	source := c.File
+	if source == "" {
+		source = "defaults"
+	}
+	logger.Release("config loaded from %v, env overrides %v\n%v", source, c.Overrides, c)
+}
@@ -0,0 +1,263 @@
+/*
+ * @Author: yujiaxun
+ * @Date: 2026-10-21 10:12:30
+ * @LastEditTime: 2026-10-21 10:12:30
+ * @Description: 网关的配置文件, 支持json, yaml和toml, 可以用环境变量覆盖
+ */
+
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// 配置文件按扩展名解析, .json, .yaml/.yml 或 .toml, 时间用 "10s", "1m30s" 这样的字符串
+// 没有写的字段使用下面的默认值, 写了0或者负数时校验会报错
+//
+//	log:
+//	  level: release            #debug, release, error, fatal
+//	  path: ""                  #日志目录, 为空时输出到标准输出
+//	server:
+//	  addr: ":8880"             #必填
+//	  max_conn_num: 10000
+//	  pending_write_num: 100
+//	  pending_read_num: 100
+//	  max_msg_len: 4096
+//	  http_timeout: 10s
+//	  pong_wait: 60s
+//	  https: false              #为true时cert_file和key_file必填
+//	  cert_file: ""
+//	  key_file: ""
+//	  allowed_origins: []       #允许的Origin, 例如 https://*.example.com, 为空时不检查
+//	  drain_timeout: 10s
+//	  drain_notice: ""
+//	  hot_restart: false
+//	  restart_timeout: 30s
+//	limit:
+//	  max_conn_per_ip: 0        #0表示不限制
+//	  upgrade_per_sec: 0
+//	  upgrade_burst: 0
+//	  bans: []                  #永久封禁的ip, 管理接口封禁的ip不受影响
+//	  conn:                     #每个连接的上行限流, 不写表示不限制
+//	    msg_per_sec: 20
+//	    msg_burst: 40
+//	    bytes_per_sec: 0
+//	    bytes_burst: 0
+//	    action: throttle        #throttle, drop, warn_kick, ban
+//	    max_warn: 0
+//	    ban_time: 0s
+//	  ip:                       #同一个ip所有连接共享的上行限流, 字段同conn
+//	session:
+//	  resume_wait: 0s           #0表示不开启断线重连
+//	  replay_buffer_num: 0      #不能超过server.pending_write_num
+//	  ack_timeout: 5s
+//	  login_policy: kick_old    #kick_old, reject_new, allow_multi
+//	  max_user_sessions: 0
+//	backend:
+//	  services: {}              #服务名 -> 实例地址列表
+//	  balancers: {}             #服务名 -> roundrobin, leastpending, hash
+//	  conn_num: 1
+//	  route_file: ""
+//	admin:
+//	  addr: ""                  #为空时不开启管理接口
+//	  token: ""                 #addr不是回环地址时必须设置
+//
+// 环境变量 GATE_<段>_<字段> 覆盖配置文件, 例如 GATE_SERVER_ADDR=:9000, GATE_LIMIT_CONN_MSG_PER_SEC=50
+// map和数组类型的字段不能用环境变量覆盖
+//
+// 下面的配置修改后可以用Reload生效, 不会断开连接, 其他的配置需要重启
+//
+//	log.level, limit.*, server.allowed_origins, server.cert_file, server.key_file, backend.route_file
+//	证书和路由表的文件内容变化时, 每次Reload都会重新读取
+
+const EnvPrefix = "GATE"
+
+type Config struct {
+	Log     LogConfig     `json:"log" yaml:"log" toml:"log"`
+	Server  ServerConfig  `json:"server" yaml:"server" toml:"server"`
+	Limit   LimitConfig   `json:"limit" yaml:"limit" toml:"limit"`
+	Session SessionConfig `json:"session" yaml:"session" toml:"session"`
+	Backend BackendConfig `json:"backend" yaml:"backend" toml:"backend"`
+	Admin   AdminConfig   `json:"admin" yaml:"admin" toml:"admin"`
+
+	File      string   `json:"-" yaml:"-" toml:"-"` //加载的配置文件
+	Overrides []string `json:"-" yaml:"-" toml:"-"` //生效的环境变量
+}
+
+type LogConfig struct {
+	Level string `json:"level" yaml:"level" toml:"level"`
+	Path  string `json:"path" yaml:"path" toml:"path"`
+}
+
+type ServerConfig struct {
+	Addr            string   `json:"addr" yaml:"addr" toml:"addr"`
+	MaxConnNum      int      `json:"max_conn_num" yaml:"max_conn_num" toml:"max_conn_num"`
+	PendingWriteNum int      `json:"pending_write_num" yaml:"pending_write_num" toml:"pending_write_num"`
+	PendingReadNum  int      `json:"pending_read_num" yaml:"pending_read_num" toml:"pending_read_num"`
+	MaxMsgLen       uint32   `json:"max_msg_len" yaml:"max_msg_len" toml:"max_msg_len"`
+	HTTPTimeout     Duration `json:"http_timeout" yaml:"http_timeout" toml:"http_timeout"`
+	PongWait        Duration `json:"pong_wait" yaml:"pong_wait" toml:"pong_wait"`
+	HTTPS           bool     `json:"https" yaml:"https" toml:"https"`
+	CertFile        string   `json:"cert_file" yaml:"cert_file" toml:"cert_file"`
+	KeyFile         string   `json:"key_file" yaml:"key_file" toml:"key_file"`
+	AllowedOrigins  []string `json:"allowed_origins,omitempty" yaml:"allowed_origins,omitempty" toml:"allowed_origins,omitempty"`
+	DrainTimeout    Duration `json:"drain_timeout" yaml:"drain_timeout" toml:"drain_timeout"`
+	DrainNotice     string   `json:"drain_notice" yaml:"drain_notice" toml:"drain_notice"`
+	HotRestart      bool     `json:"hot_restart" yaml:"hot_restart" toml:"hot_restart"`
+	RestartTimeout  Duration `json:"restart_timeout" yaml:"restart_timeout" toml:"restart_timeout"`
+}
+
+type LimitConfig struct {
+	MaxConnPerIP  int              `json:"max_conn_per_ip" yaml:"max_conn_per_ip" toml:"max_conn_per_ip"`
+	UpgradePerSec float64          `json:"upgrade_per_sec" yaml:"upgrade_per_sec" toml:"upgrade_per_sec"`
+	UpgradeBurst  int              `json:"upgrade_burst" yaml:"upgrade_burst" toml:"upgrade_burst"`
+	Bans          []string         `json:"bans,omitempty" yaml:"bans,omitempty" toml:"bans,omitempty"`
+	Conn          *RateLimitConfig `json:"conn,omitempty" yaml:"conn,omitempty" toml:"conn,omitempty"`
+	IP            *RateLimitConfig `json:"ip,omitempty" yaml:"ip,omitempty" toml:"ip,omitempty"`
+}
+
+type RateLimitConfig struct {
+	MsgPerSec   float64  `json:"msg_per_sec" yaml:"msg_per_sec" toml:"msg_per_sec"`
+	MsgBurst    int      `json:"msg_burst" yaml:"msg_burst" toml:"msg_burst"`
+	BytesPerSec float64  `json:"bytes_per_sec" yaml:"bytes_per_sec" toml:"bytes_per_sec"`
+	BytesBurst  int      `json:"bytes_burst" yaml:"bytes_burst" toml:"bytes_burst"`
+	Action      string   `json:"action" yaml:"action" toml:"action"`
+	MaxWarn     int      `json:"max_warn" yaml:"max_warn" toml:"max_warn"`
+	BanTime     Duration `json:"ban_time" yaml:"ban_time" toml:"ban_time"`
+}
+
+type SessionConfig struct {
+	ResumeWait      Duration `json:"resume_wait" yaml:"resume_wait" toml:"resume_wait"`
+	ReplayBufferNum int      `json:"replay_buffer_num" yaml:"replay_buffer_num" toml:"replay_buffer_num"`
+	AckTimeout      Duration `json:"ack_timeout" yaml:"ack_timeout" toml:"ack_timeout"`
+	LoginPolicy     string   `json:"login_policy" yaml:"login_policy" toml:"login_policy"`
+	MaxUserSessions int      `json:"max_user_sessions" yaml:"max_user_sessions" toml:"max_user_sessions"`
+}
+
+type BackendConfig struct {
+	Services  map[string][]string `json:"services,omitempty" yaml:"services,omitempty" toml:"services,omitempty"`
+	Balancers map[string]string   `json:"balancers,omitempty" yaml:"balancers,omitempty" toml:"balancers,omitempty"`
+	ConnNum   int                 `json:"conn_num" yaml:"conn_num" toml:"conn_num"`
+	RouteFile string              `json:"route_file" yaml:"route_file" toml:"route_file"`
+}
+
+type AdminConfig struct {
+	Addr  string `json:"addr" yaml:"addr" toml:"addr"`
+	Token string `json:"token" yaml:"token" toml:"token"`
+}
+
+// Default 所有字段都是默认值的配置
+func Default() *Config {
+	c := new(Config)
+	c.Log.Level = "release"
+	c.Server.MaxConnNum = 10000
+	c.Server.PendingWriteNum = 100
+	c.Server.PendingReadNum = 100
+	c.Server.MaxMsgLen = 4096
+	c.Server.HTTPTimeout = Duration(10 * time.Second)
+	c.Server.PongWait = Duration(60 * time.Second)
+	c.Server.DrainTimeout = Duration(10 * time.Second)
+	c.Server.RestartTimeout = Duration(30 * time.Second)
+	c.Session.AckTimeout = Duration(5 * time.Second)
+	c.Session.LoginPolicy = "kick_old"
+	c.Backend.ConnNum = 1
+	return c
+}
+
+// Load 读取配置文件, 再用环境变量覆盖, 最后校验, file为空时只使用默认值和环境变量
+func Load(file string) (*Config, error) {
+	c, err := Parse(file)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Parse 和Load一样但是不校验, 调用方还要修改配置时使用, 例如命令行参数, 改完之后再调用Validate
+func Parse(file string) (*Config, error) {
+	c := Default()
+	if file != "" {
+		if err := c.parseFile(file); err != nil {
+			return nil, err
+		}
+	}
+	if err := c.applyEnv(os.Environ()); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *Config) parseFile(file string) error {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".json":
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		err = dec.Decode(c)
+	case ".yaml", ".yml":
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		err = dec.Decode(c)
+	case ".toml":
+		var meta toml.MetaData
+		meta, err = toml.Decode(string(data), c)
+		if err == nil && len(meta.Undecoded()) > 0 {
+			err = fmt.Errorf("unknown field %v", meta.Undecoded()[0])
+		}
+	default:
+		return fmt.Errorf("config %v: unsupported format %q", file, filepath.Ext(file))
+	}
+	if err != nil {
+		return fmt.Errorf("config %v: %v", file, err)
+	}
+	c.File = file
+	return nil
+}
+
+// String 生效的配置, yaml格式, token等敏感字段用***代替
+func (c *Config) String() string {
+	masked := *c
+	if masked.Admin.Token != "" {
+		masked.Admin.Token = "***"
+	}
+	data, err := yaml.Marshal(&masked)
+	if err != nil {
+		return err.Error()
+	}
+	return string(data)
+}
+
+// Duration 配置文件里用字符串表示的时间
+type Duration time.Duration
+
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+func (d *Duration) UnmarshalText(text []byte) error {
+	v, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+func (d Duration) String() string {
+	return time.Duration(d).String()
+}
@@ -0,0 +1,147 @@
+/*
+ * @Author: yujiaxun
+ * @Date: 2026-10-21 12:10:36
+ * @LastEditTime: 2026-10-21 12:10:36
+ * @Description: xxx
+ */
+
+package config_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"test/config"
+	"test/gate"
+	"test/network"
+	"testing"
+	"time"
+)
+
+var files = map[string]string{
+	"gate.yaml": `
+server:
+  addr: ":8880"
+  pong_wait: 30s
+  pending_read_num: 50
+limit:
+  conn:
+    msg_per_sec: 20
+    action: drop
+session:
+  login_policy: reject_new
+backend:
+  services:
+    battle: ["127.0.0.1:9001"]
+`,
+	"gate.json": `{
+	"server": {"addr": ":8880", "pong_wait": "30s", "pending_read_num": 50},
+	"limit": {"conn": {"msg_per_sec": 20, "action": "drop"}},
+	"session": {"login_policy": "reject_new"},
+	"backend": {"services": {"battle": ["127.0.0.1:9001"]}}
+}`,
+	"gate.toml": `
+[server]
+addr = ":8880"
+pong_wait = "30s"
+pending_read_num = 50
+
+[limit.conn]
+msg_per_sec = 20
+action = "drop"
+
+[session]
+login_policy = "reject_new"
+
+[backend.services]
+battle = ["127.0.0.1:9001"]
+`,
+}
+
+func writeFile(t *testing.T, name string, content string) string {
+	file := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func TestLoad(t *testing.T) {
+	for name, content := range files {
+		c, err := config.Load(writeFile(t, name, content))
+		if err != nil {
+			t.Fatalf("%v: %v", name, err)
+		}
+		g := c.NewGate()
+		if g.WSAddr != ":8880" || g.PongWait != 30*time.Second || g.PendingReadNum != 50 {
+			t.Fatalf("%v: server config not loaded", name)
+		}
+		//没有写的字段使用默认值
+		if g.PendingWriteNum != 100 || g.HTTPTimeout != 10*time.Second || g.AckTimeout != 5*time.Second {
+			t.Fatalf("%v: defaults not applied", name)
+		}
+		if g.LoginPolicy != gate.LoginRejectNew {
+			t.Fatalf("%v: login policy %v", name, g.LoginPolicy)
+		}
+		if g.ConnRateLimit == nil || g.ConnRateLimit.MsgPerSec != 20 || g.ConnRateLimit.Action != network.ActionDrop {
+			t.Fatalf("%v: rate limit %+v", name, g.ConnRateLimit)
+		}
+		if g.IPRateLimit != nil {
+			t.Fatalf("%v: ip rate limit should be nil", name)
+		}
+		if len(g.Backends["battle"]) != 1 {
+			t.Fatalf("%v: backends %v", name, g.Backends)
+		}
+	}
+}
+
+func TestEnvOverride(t *testing.T) {
+	t.Setenv("GATE_SERVER_ADDR", ":9000")
+	t.Setenv("GATE_SERVER_PONG_WAIT", "15s")
+	t.Setenv("GATE_LIMIT_IP_MSG_PER_SEC", "100")
+	t.Setenv("GATE_ADMIN_TOKEN", "secret")
+	c, err := config.Load(writeFile(t, "gate.yaml", files["gate.yaml"]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Server.Addr != ":9000" || time.Duration(c.Server.PongWait) != 15*time.Second {
+		t.Fatalf("env not applied: %+v", c.Server)
+	}
+	if c.Limit.IP == nil || c.Limit.IP.MsgPerSec != 100 {
+		t.Fatalf("env not applied to ip limit: %+v", c.Limit.IP)
+	}
+	if len(c.Overrides) != 4 {
+		t.Fatalf("overrides %v", c.Overrides)
+	}
+	s := c.String()
+	if strings.Contains(s, "secret") || !strings.Contains(s, "pong_wait: 15s") {
+		t.Fatalf("effective config:\n%v", s)
+	}
+
+	t.Setenv("GATE_SERVER_MAX_CONN_NUM", "many")
+	if _, err := config.Load(""); err == nil || !strings.Contains(err.Error(), "GATE_SERVER_MAX_CONN_NUM") {
+		t.Fatalf("expect env error, got %v", err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	c := config.Default()
+	c.Server.PongWait = 0
+	c.Server.HTTPS = true
+	c.Session.LoginPolicy = "kick_new"
+	err := c.Validate()
+	var verr config.ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("expect validation error, got %v", err)
+	}
+	for _, field := range []string{"server.addr", "server.pong_wait", "server.cert_file", "server.key_file", "session.login_policy"} {
+		if !strings.Contains(err.Error(), field) {
+			t.Fatalf("%v not reported: %v", field, err)
+		}
+	}
+
+	if _, err := config.Load(writeFile(t, "gate.yaml", "server:\n  adr: \":8880\"\n")); err == nil {
+		t.Fatal("unknown field should be rejected")
+	}
+}
@@ -0,0 +1,125 @@
+/*
+ * @Author: yujiaxun
+ * @Date: 2026-10-21 10:58:04
+ * @LastEditTime: 2026-10-21 10:58:04
+ * @Description: 用环境变量覆盖配置
+ */
+
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var durationType = reflect.TypeOf(Duration(0))
+
+// applyEnv env为KEY=VALUE的列表, 按yaml的字段名拼出环境变量名
+func (c *Config) applyEnv(env []string) error {
+	values := make(map[string]string)
+	for _, kv := range env {
+		if i := strings.IndexByte(kv, '='); i > 0 && strings.HasPrefix(kv, EnvPrefix+"_") {
+			values[kv[:i]] = kv[i+1:]
+		}
+	}
+	if err := c.setEnv(reflect.ValueOf(c).Elem(), EnvPrefix, values); err != nil {
+		return err
+	}
+	sort.Strings(c.Overrides)
+	return nil
+}
+
+func (c *Config) setEnv(v reflect.Value, prefix string, values map[string]string) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := strings.Split(field.Tag.Get("yaml"), ",")[0]
+		if tag == "" || tag == "-" {
+			continue
+		}
+		name := prefix + "_" + strings.ToUpper(tag)
+		fv := v.Field(i)
+		switch {
+		case fv.Kind() == reflect.Struct:
+			if err := c.setEnv(fv, name, values); err != nil {
+				return err
+			}
+			continue
+		case fv.Kind() == reflect.Ptr && fv.Type().Elem().Kind() == reflect.Struct:
+			//没有配置的限流, 设置了其中任何一个字段的环境变量时才创建
+			if fv.IsNil() {
+				if !hasPrefix(values, name+"_") {
+					continue
+				}
+				fv.Set(reflect.New(fv.Type().Elem()))
+			}
+			if err := c.setEnv(fv.Elem(), name, values); err != nil {
+				return err
+			}
+			continue
+		}
+		value, ok := values[name]
+		if !ok {
+			continue
+		}
+		if err := setValue(fv, value); err != nil {
+			return fmt.Errorf("env %v: %v", name, err)
+		}
+		c.Overrides = append(c.Overrides, name)
+	}
+	return nil
+}
+
+func setValue(v reflect.Value, value string) error {
+	if v.Type() == durationType {
+		var d Duration
+		if err := d.UnmarshalText([]byte(value)); err != nil {
+			return err
+		}
+		v.Set(reflect.ValueOf(d))
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(value, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(n)
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	default:
+		return fmt.Errorf("%v can not be set by env", v.Type())
+	}
+	return nil
+}
+
+func hasPrefix(values map[string]string, prefix string) bool {
+	for name := range values {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
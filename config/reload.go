@@ -0,0 +1,184 @@
+/*
+ * @Author: yujiaxun
+ * @Date: 2026-10-21 17:05:41
+ * @LastEditTime: 2026-10-21 17:05:41
+ * @Description: 运行时重新加载配置, 只应用不需要重启的部分
+ */
+
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"test/gate"
+	"test/logger"
+	"test/network"
+)
+
+const banReason = "config"
+
+// hotFields 可以热更新的配置, 以.结尾的表示整个段
+var hotFields = []string{
+	"log.level",
+	"limit.",
+	"server.allowed_origins",
+	"server.cert_file",
+	"server.key_file",
+	"backend.route_file",
+}
+
+// secretFields 日志里不打印值
+var secretFields = map[string]bool{"admin.token": true}
+
+// Change 一个字段的变化, Restart为true时需要重启才能生效
+type Change struct {
+	Field   string
+	Old     string
+	New     string
+	Restart bool
+}
+
+func (ch Change) String() string {
+	s := fmt.Sprintf("%v: %v -> %v", ch.Field, ch.Old, ch.New)
+	if ch.Restart {
+		s += " (restart required)"
+	}
+	return s
+}
+
+// Diff 比较两份配置, 字段名和配置文件里的一样
+func Diff(old, new *Config) []Change {
+	var changes []Change
+	diff(reflect.ValueOf(old).Elem(), reflect.ValueOf(new).Elem(), "", &changes)
+	return changes
+}
+
+func diff(old, new reflect.Value, prefix string, changes *[]Change) {
+	t := old.Type()
+	for i := 0; i < t.NumField(); i++ {
+		tag := strings.Split(t.Field(i).Tag.Get("yaml"), ",")[0]
+		if tag == "" || tag == "-" {
+			continue
+		}
+		field := prefix + tag
+		ov, nv := old.Field(i), new.Field(i)
+		if ov.Kind() == reflect.Struct {
+			diff(ov, nv, field+".", changes)
+			continue
+		}
+		if ov.Kind() == reflect.Ptr && ov.Type().Elem().Kind() == reflect.Struct {
+			//没有配置的段按零值比较
+			zero := reflect.New(ov.Type().Elem()).Elem()
+			if ov.IsNil() && nv.IsNil() {
+				continue
+			}
+			if !ov.IsNil() {
+				zero = ov.Elem()
+			}
+			newValue := reflect.New(nv.Type().Elem()).Elem()
+			if !nv.IsNil() {
+				newValue = nv.Elem()
+			}
+			diff(zero, newValue, field+".", changes)
+			continue
+		}
+		if reflect.DeepEqual(ov.Interface(), nv.Interface()) {
+			continue
+		}
+		ch := Change{Field: field, Old: format(ov), New: format(nv), Restart: !isHot(field)}
+		if secretFields[field] {
+			ch.Old, ch.New = "***", "***"
+		}
+		*changes = append(*changes, ch)
+	}
+}
+
+func format(v reflect.Value) string {
+	if v.Kind() == reflect.String {
+		return fmt.Sprintf("%q", v.String())
+	}
+	return fmt.Sprintf("%v", v.Interface())
+}
+
+func isHot(field string) bool {
+	for _, hot := range hotFields {
+		if field == hot || strings.HasSuffix(hot, ".") && strings.HasPrefix(field, hot) {
+			return true
+		}
+	}
+	return false
+}
+
+func changed(changes []Change, prefix string) bool {
+	for _, ch := range changes {
+		if strings.HasPrefix(ch.Field, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Reload 把new里可以热更新的配置应用到运行中的gate, 每个变化都会打印日志
+// 需要重启的配置只打印日志不生效, 证书和路由表每次都重新读取, 因为文件内容可能变了
+func Reload(g *gate.Gate, old, new *Config) []Change {
+	changes := Diff(old, new)
+	for _, ch := range changes {
+		logger.Release("config changed, %v", ch)
+	}
+	if len(changes) == 0 {
+		logger.Release("config not changed")
+	}
+
+	if changed(changes, "log.") {
+		if err := logger.SetLevel(new.Log.Level); err != nil {
+			logger.Error("set log level error: %v", err)
+		}
+	}
+	if ws := g.WSServer(); ws != nil {
+		if changed(changes, "limit.conn.") || changed(changes, "limit.ip.") {
+			ws.SetRateLimits(new.Limit.Conn.RateLimit(), new.Limit.IP.RateLimit())
+		}
+		l := &new.Limit
+		if changed(changes, "limit.max_conn_per_ip") || changed(changes, "limit.upgrade_") {
+			ws.SetConnLimits(l.MaxConnPerIP, l.UpgradePerSec, l.UpgradeBurst)
+		}
+		if changed(changes, "server.allowed_origins") {
+			ws.SetAllowedOrigins(new.Server.AllowedOrigins)
+		}
+		if old.Server.HTTPS {
+			if err := ws.SetCertFiles(new.Server.CertFile, new.Server.KeyFile); err != nil {
+				logger.Error("reload certificate error: %v", err)
+			}
+		}
+	}
+	if g.BanList != nil {
+		syncBans(g.BanList, old.Limit.Bans, new.Limit.Bans)
+	}
+	if router := g.Router(); router != nil && new.Backend.RouteFile != "" {
+		router.File = new.Backend.RouteFile
+		if err := router.Reload(); err != nil {
+			logger.Error("reload route table error: %v", err)
+		}
+	}
+	return changes
+}
+
+// syncBans 只修改配置文件里的封禁, 管理接口封禁的ip不受影响
+func syncBans(list *network.BanList, old, new []string) {
+	keep := make(map[string]bool)
+	for _, ip := range new {
+		keep[ip] = true
+	}
+	for _, ip := range old {
+		if !keep[ip] {
+			list.Unban(ip)
+		}
+	}
+	for _, ip := range new {
+		if !list.IsBanned(ip) {
+			list.Ban(ip, 0, banReason)
+		}
+	}
+}
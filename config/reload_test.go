@@ -0,0 +1,67 @@
+/*
+ * @Author: yujiaxun
+ * @Date: 2026-10-21 17:40:12
+ * @LastEditTime: 2026-10-21 17:40:12
+ * @Description: xxx
+ */
+
+package config_test
+
+import (
+	"test/config"
+	"test/gate"
+	"test/network"
+	"testing"
+	"time"
+)
+
+func TestDiff(t *testing.T) {
+	old := config.Default()
+	old.Server.Addr = ":8880"
+	old.Admin.Token = "a"
+	next := config.Default()
+	next.Server.Addr = ":9000"
+	next.Server.PongWait = config.Duration(30 * time.Second)
+	next.Log.Level = "debug"
+	next.Limit.Conn = &config.RateLimitConfig{MsgPerSec: 10}
+	next.Admin.Token = "b"
+
+	changes := config.Diff(old, next)
+	want := map[string]bool{
+		"log.level":              false,
+		"server.addr":            true,
+		"server.pong_wait":       true,
+		"limit.conn.msg_per_sec": false,
+		"admin.token":            true,
+	}
+	if len(changes) != len(want) {
+		t.Fatalf("changes %v", changes)
+	}
+	for _, ch := range changes {
+		restart, ok := want[ch.Field]
+		if !ok || ch.Restart != restart {
+			t.Fatalf("unexpected change %v", ch)
+		}
+		if ch.Field == "admin.token" && (ch.Old != "***" || ch.New != "***") {
+			t.Fatalf("secret leaked: %v", ch)
+		}
+	}
+}
+
+func TestReloadBans(t *testing.T) {
+	old := config.Default()
+	old.Limit.Bans = []string{"10.0.0.1", "10.0.0.2"}
+	g := &gate.Gate{BanList: network.NewBanList()}
+	g.BanList.Ban("10.0.0.1", 0, "config")
+	g.BanList.Ban("10.0.0.2", 0, "config")
+	g.BanList.Ban("10.0.0.9", 0, "admin")
+
+	next := config.Default()
+	next.Limit.Bans = []string{"10.0.0.2", "10.0.0.3"}
+	config.Reload(g, old, next)
+	for ip, banned := range map[string]bool{"10.0.0.1": false, "10.0.0.2": true, "10.0.0.3": true, "10.0.0.9": true} {
+		if g.BanList.IsBanned(ip) != banned {
+			t.Fatalf("ip %v banned %v, want %v", ip, !banned, banned)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+/*
+ * @Author: yujiaxun
+ * @Date: 2026-10-21 11:20:47
+ * @LastEditTime: 2026-10-21 11:20:47
+ * @Description: 配置校验
+ */
+
+package config
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path"
+	"strings"
+
+	"test/backend"
+	"test/gate"
+	"test/network"
+)
+
+// ValidationError 校验失败的所有字段, 字段名和配置文件里的一样, 例如 server.pong_wait
+type ValidationError []string
+
+func (e ValidationError) Error() string {
+	return "invalid config: " + strings.Join(e, "; ")
+}
+
+var logLevels = []string{"debug", "release", "error", "fatal"}
+
+var loginPolicies = map[string]gate.LoginPolicy{
+	"kick_old":    gate.LoginKickOld,
+	"reject_new":  gate.LoginRejectNew,
+	"allow_multi": gate.LoginAllowMulti,
+}
+
+var limitActions = map[string]network.LimitAction{
+	"":          network.ActionThrottle,
+	"throttle":  network.ActionThrottle,
+	"drop":      network.ActionDrop,
+	"warn_kick": network.ActionWarnKick,
+	"ban":       network.ActionBan,
+}
+
+// Validate 检查所有字段, 返回的错误是ValidationError
+func (c *Config) Validate() error {
+	var errs ValidationError
+	check := func(ok bool, field string, format string, a ...interface{}) {
+		if !ok {
+			errs = append(errs, field+": "+fmt.Sprintf(format, a...))
+		}
+	}
+
+	check(contains(logLevels, strings.ToLower(c.Log.Level)), "log.level", "must be one of %v", strings.Join(logLevels, ", "))
+
+	s := &c.Server
+	check(s.Addr != "", "server.addr", "is required")
+	if s.Addr != "" {
+		_, _, err := net.SplitHostPort(s.Addr)
+		check(err == nil, "server.addr", "%v", err)
+	}
+	check(s.MaxConnNum > 0, "server.max_conn_num", "must be > 0")
+	check(s.PendingWriteNum > 0, "server.pending_write_num", "must be > 0")
+	check(s.PendingReadNum > 0, "server.pending_read_num", "must be > 0")
+	check(s.MaxMsgLen > 0, "server.max_msg_len", "must be > 0")
+	check(s.HTTPTimeout > 0, "server.http_timeout", "must be > 0")
+	check(s.PongWait > 0, "server.pong_wait", "must be > 0")
+	check(s.DrainTimeout > 0, "server.drain_timeout", "must be > 0")
+	check(s.RestartTimeout > 0, "server.restart_timeout", "must be > 0")
+	if s.HTTPS {
+		check(s.CertFile != "", "server.cert_file", "is required when https is true")
+		check(s.KeyFile != "", "server.key_file", "is required when https is true")
+	}
+	for _, origin := range s.AllowedOrigins {
+		_, err := path.Match(origin, "")
+		check(err == nil, "server.allowed_origins", "bad pattern %q", origin)
+	}
+	checkFile(check, "server.cert_file", s.CertFile)
+	checkFile(check, "server.key_file", s.KeyFile)
+
+	l := &c.Limit
+	check(l.MaxConnPerIP >= 0, "limit.max_conn_per_ip", "must be >= 0")
+	check(l.UpgradePerSec >= 0, "limit.upgrade_per_sec", "must be >= 0")
+	check(l.UpgradeBurst >= 0, "limit.upgrade_burst", "must be >= 0")
+	for _, ip := range l.Bans {
+		check(net.ParseIP(ip) != nil, "limit.bans", "bad ip %q", ip)
+	}
+	checkRateLimit(check, "limit.conn", l.Conn)
+	checkRateLimit(check, "limit.ip", l.IP)
+
+	ss := &c.Session
+	check(ss.ResumeWait >= 0, "session.resume_wait", "must be >= 0")
+	check(ss.ReplayBufferNum >= 0, "session.replay_buffer_num", "must be >= 0")
+	check(ss.ReplayBufferNum <= s.PendingWriteNum, "session.replay_buffer_num", "must not exceed server.pending_write_num")
+	check(ss.AckTimeout > 0, "session.ack_timeout", "must be > 0")
+	_, ok := loginPolicies[ss.LoginPolicy]
+	check(ok, "session.login_policy", "unknown policy %q, must be kick_old, reject_new or allow_multi", ss.LoginPolicy)
+	check(ss.MaxUserSessions >= 0, "session.max_user_sessions", "must be >= 0")
+
+	b := &c.Backend
+	for name, addrs := range b.Services {
+		check(len(addrs) > 0, "backend.services."+name, "has no instance")
+	}
+	for name, balancer := range b.Balancers {
+		_, err := backend.NewBalancer(balancer)
+		check(err == nil, "backend.balancers."+name, "%v", err)
+	}
+	check(b.ConnNum > 0, "backend.conn_num", "must be > 0")
+	checkFile(check, "backend.route_file", b.RouteFile)
+
+	if c.Admin.Addr != "" {
+		_, _, err := net.SplitHostPort(c.Admin.Addr)
+		check(err == nil, "admin.addr", "%v", err)
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func checkRateLimit(check func(bool, string, string, ...interface{}), field string, r *RateLimitConfig) {
+	if r == nil {
+		return
+	}
+	check(r.MsgPerSec >= 0, field+".msg_per_sec", "must be >= 0")
+	check(r.MsgBurst >= 0, field+".msg_burst", "must be >= 0")
+	check(r.BytesPerSec >= 0, field+".bytes_per_sec", "must be >= 0")
+	check(r.BytesBurst >= 0, field+".bytes_burst", "must be >= 0")
+	_, ok := limitActions[r.Action]
+	check(ok, field+".action", "unknown action %q, must be throttle, drop, warn_kick or ban", r.Action)
+	check(r.MaxWarn >= 0, field+".max_warn", "must be >= 0")
+	check(r.BanTime >= 0, field+".ban_time", "must be >= 0")
+}
+
+func checkFile(check func(bool, string, string, ...interface{}), field string, file string) {
+	if file == "" {
+		return
+	}
+	_, err := os.Stat(file)
+	check(err == nil, field, "%v", err)
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
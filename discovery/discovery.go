@@ -0,0 +1,44 @@
+/*
+ * @Author: yujiaxun
+ * @Date: 2026-10-19 20:40:17
+ * @LastEditTime: 2026-10-19 20:40:17
+ * @Description: 服务发现, 提供每个后端服务的实例地址
+ */
+
+package discovery
+
+import (
+	"sort"
+)
+
+// Provider 服务发现的接口, 以后可以接入consul或etcd
+type Provider interface {
+	// Services 当前每个服务的实例地址
+	Services() (map[string][]string, error)
+	// Watch 开始监听, 实例有变化时用全量的服务列表调用onChange, 直到Close
+	Watch(onChange func(services map[string][]string)) error
+	Close()
+}
+
+// Equal 比较两份服务列表, 实例地址不区分顺序
+func Equal(a, b map[string][]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for name, addrsA := range a {
+		addrsB, ok := b[name]
+		if !ok || len(addrsA) != len(addrsB) {
+			return false
+		}
+		sortedA := append([]string(nil), addrsA...)
+		sortedB := append([]string(nil), addrsB...)
+		sort.Strings(sortedA)
+		sort.Strings(sortedB)
+		for i := range sortedA {
+			if sortedA[i] != sortedB[i] {
+				return false
+			}
+		}
+	}
+	return true
+}
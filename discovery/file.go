@@ -0,0 +1,181 @@
+/*
+ * @Author: yujiaxun
+ * @Date: 2026-10-19 20:52:40
+ * @LastEditTime: 2026-10-19 20:52:40
+ * @Description: 基于文件的服务发现, 文件变化时自动重新加载
+ */
+
+package discovery
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"test/logger"
+
+	"gopkg.in/yaml.v3"
+)
+
+// 文件格式, 根据扩展名使用json或yaml
+//
+//	{"services": {"battle": ["10.0.0.1:9000", "10.0.0.2:9000"]}}
+type fileConfig struct {
+	Services map[string][]string `json:"services" yaml:"services"`
+}
+
+// FileProvider 定时检查文件的修改时间和大小, 有变化时重新加载
+type FileProvider struct {
+	File     string
+	Interval time.Duration //检查间隔, 默认2秒
+
+	sync.Mutex
+	services  map[string][]string
+	modTime   time.Time
+	size      int64
+	closeChan chan bool
+	wg        sync.WaitGroup
+}
+
+func NewFileProvider(file string) *FileProvider {
+	p := new(FileProvider)
+	p.File = file
+	p.Interval = 2 * time.Second
+	return p
+}
+
+func (p *FileProvider) Services() (map[string][]string, error) {
+	p.Lock()
+	services := p.services
+	p.Unlock()
+	if services != nil {
+		return services, nil
+	}
+	services, err := p.load()
+	if err != nil {
+		return nil, err
+	}
+	p.Lock()
+	p.services = services
+	p.Unlock()
+	return services, nil
+}
+
+func (p *FileProvider) Watch(onChange func(services map[string][]string)) error {
+	if _, err := p.Services(); err != nil {
+		return err
+	}
+	p.Lock()
+	if p.closeChan != nil {
+		p.Unlock()
+		return errors.New("provider is already watching")
+	}
+	closeChan := make(chan bool)
+	p.closeChan = closeChan
+	p.Unlock()
+
+	interval := p.Interval
+	if interval <= 0 {
+		interval = 2 * time.Second
+	}
+	p.wg.Add(1)
+	//Close会把p.closeChan置为nil, 协程里用局部变量
+	go func(closeChan chan bool) {
+		defer p.wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-closeChan:
+				return
+			case <-ticker.C:
+				p.check(onChange)
+			}
+		}
+	}(closeChan)
+	return nil
+}
+
+func (p *FileProvider) check(onChange func(services map[string][]string)) {
+	info, err := os.Stat(p.File)
+	if err != nil {
+		logger.Error("stat discovery file %v error: %v", p.File, err)
+		return
+	}
+	p.Lock()
+	changed := !info.ModTime().Equal(p.modTime) || info.Size() != p.size
+	p.Unlock()
+	if !changed {
+		return
+	}
+
+	services, err := p.load()
+	if err != nil {
+		//文件有错时保留原来的服务列表, 等文件再次修改
+		logger.Error("reload discovery file %v error: %v", p.File, err)
+		return
+	}
+	p.Lock()
+	old := p.services
+	p.services = services
+	p.Unlock()
+	if Equal(old, services) {
+		return
+	}
+	logger.Release("discovery file %v reloaded", p.File)
+	onChange(services)
+}
+
+// load 读取并解析文件, 同时记录文件的状态
+func (p *FileProvider) load() (map[string][]string, error) {
+	info, err := os.Stat(p.File)
+	if err != nil {
+		return nil, err
+	}
+	p.Lock()
+	p.modTime = info.ModTime()
+	p.size = info.Size()
+	p.Unlock()
+
+	data, err := os.ReadFile(p.File)
+	if err != nil {
+		return nil, err
+	}
+	conf := new(fileConfig)
+	switch strings.ToLower(filepath.Ext(p.File)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, conf)
+	default:
+		err = json.Unmarshal(data, conf)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parse %v error: %v", p.File, err)
+	}
+	if conf.Services == nil {
+		conf.Services = make(map[string][]string)
+	}
+	for name, addrs := range conf.Services {
+		for _, addr := range addrs {
+			if addr == "" {
+				return nil, fmt.Errorf("service %v has empty address", name)
+			}
+		}
+	}
+	return conf.Services, nil
+}
+
+func (p *FileProvider) Close() {
+	p.Lock()
+	closeChan := p.closeChan
+	p.closeChan = nil
+	p.Unlock()
+	if closeChan != nil {
+		close(closeChan)
+		p.wg.Wait()
+	}
+}
@@ -0,0 +1,50 @@
+/*
+ * @Author: yujiaxun
+ * @Date: 2026-10-19 21:25:03
+ * @LastEditTime: 2026-10-19 21:25:03
+ * @Description: xxx
+ */
+
+package discovery_test
+
+import (
+	"os"
+	"path/filepath"
+	"test/discovery"
+	"testing"
+	"time"
+)
+
+func TestFileProvider(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "services.yaml")
+	os.WriteFile(file, []byte("services:\n  battle:\n    - 127.0.0.1:9001\n"), 0644)
+
+	p := discovery.NewFileProvider(file)
+	p.Interval = 10 * time.Millisecond
+	services, err := p.Services()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !discovery.Equal(services, map[string][]string{"battle": {"127.0.0.1:9001"}}) {
+		t.Fatalf("unexpected services %v", services)
+	}
+
+	changes := make(chan map[string][]string, 1)
+	if err := p.Watch(func(services map[string][]string) {
+		changes <- services
+	}); err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	os.WriteFile(file, []byte("services:\n  battle:\n    - 127.0.0.1:9002\n    - 127.0.0.1:9001\n"), 0644)
+	select {
+	case services = <-changes:
+	case <-time.After(2 * time.Second):
+		t.Fatal("change not detected")
+	}
+	want := map[string][]string{"battle": {"127.0.0.1:9001", "127.0.0.1:9002"}}
+	if !discovery.Equal(services, want) {
+		t.Fatalf("got %v, want %v", services, want)
+	}
+}
@@ -0,0 +1,324 @@
+/*
+ * @Author: yujiaxun
+ * @Date: 2026-10-20 14:25:38
+ * @LastEditTime: 2026-10-20 14:25:38
+ * @Description: 运维用的管理接口
+ */
+
+package gate
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"test/logger"
+	"test/metrics"
+	"test/network"
+
+	"github.com/gorilla/websocket"
+)
+
+// 管理接口
+//
+//	GET  /sessions                        会话列表
+//	POST /kick?id=1&reason=xxx            踢掉会话, 也可以用 user=用户id 踢掉用户的所有会话
+//	POST /broadcast?text=xxx              给所有会话发系统公告, 需要设置Gate.Notice
+//	GET  /bans                            封禁列表
+//	POST /ban?ip=1.2.3.4&duration=10m     封禁ip, 不带duration时永久封禁
+//	POST /unban?ip=1.2.3.4
+//	GET  /loglevel                        当前日志级别
+//	POST /loglevel?level=debug
+//	POST /drain                           停止接受新连接并断开所有会话
+//	GET  /metrics                         prometheus格式的监控指标
+
+// SessionInfo 管理接口返回的会话信息
+type SessionInfo struct {
+	ID         uint64 `json:"id"`
+	RemoteAddr string `json:"remote_addr"`
+	UserID     string `json:"user_id"`
+	Uptime     int64  `json:"uptime"` //秒
+	QueueDepth int    `json:"queue_depth"`
+	Attached   bool   `json:"attached"`
+	Unacked    int    `json:"unacked"`
+}
+
+// Sessions 本节点的所有会话, 按id排序
+func (gate *Gate) Sessions() []SessionInfo {
+	agents := gate.allSessions()
+	sort.Slice(agents, func(i, j int) bool {
+		return agents[i].id < agents[j].id
+	})
+	infos := make([]SessionInfo, 0, len(agents))
+	for _, a := range agents {
+		a.Lock()
+		info := SessionInfo{
+			ID:         a.id,
+			RemoteAddr: a.conn.RemoteAddr().String(),
+			UserID:     a.userID,
+			Uptime:     int64(time.Since(a.createdAt) / time.Second),
+			Attached:   a.attached,
+			Unacked:    len(a.unacked),
+		}
+		if a.attached {
+			info.QueueDepth = a.conn.PendingWrite()
+		}
+		a.Unlock()
+		infos = append(infos, info)
+	}
+	return infos
+}
+
+// Kick 按会话id踢掉会话
+func (gate *Gate) Kick(id uint64, code int, reason string) bool {
+	a := gate.agentByID(id)
+	if a == nil {
+		return false
+	}
+	a.Kick(code, reason)
+	return true
+}
+
+// KickUser 踢掉用户在本节点上的所有会话, 返回踢掉的会话数
+func (gate *Gate) KickUser(userID string, code int, reason string) int {
+	gate.sessionMutex.Lock()
+	agents := append([]*agent(nil), gate.users[userID]...)
+	gate.sessionMutex.Unlock()
+	for _, a := range agents {
+		a.Kick(code, reason)
+	}
+	return len(agents)
+}
+
+// BroadcastAll 发给本节点的所有会话
+func (gate *Gate) BroadcastAll(msg interface{}) error {
+	data, err := gate.marshal(msg)
+	if err != nil {
+		return err
+	}
+	typ := msgType(msg)
+	for _, a := range gate.allSessions() {
+		a.write(typ, data)
+	}
+	return nil
+}
+
+// Drain 停止接受新连接, 先给所有会话发DrainNotice, 再发送关闭帧断开
+// 关闭帧排在写队列后面, 超过DrainTimeout还没发完的连接强制关闭
+func (gate *Gate) Drain() {
+	if !atomic.CompareAndSwapInt32(&gate.draining, 0, 1) {
+		return
+	}
+	logger.Release("gate start draining")
+	wsServer := gate.WSServer()
+	if wsServer != nil {
+		wsServer.SetDraining(true)
+	}
+	if gate.DrainNotice != "" && gate.Notice != nil {
+		if err := gate.BroadcastAll(gate.Notice(gate.DrainNotice)); err != nil {
+			logger.Error("broadcast drain notice error: %v", err)
+		}
+	}
+	for _, a := range gate.allSessions() {
+		a.close(network.CloseShutdown, func(conn network.Conn) {
+			conn.SetCloseReason(network.CloseShutdown)
+			conn.CloseWithCode(websocket.CloseGoingAway, "server draining")
+		})
+	}
+	if wsServer != nil {
+		wsServer.Drain(websocket.CloseGoingAway, "server draining", gate.DrainTimeout)
+	}
+	logger.Release("gate drained")
+}
+
+func (gate *Gate) Draining() bool {
+	return atomic.LoadInt32(&gate.draining) == 1
+}
+
+// AdminMux 管理接口的路由, 可以挂到自己的http服务上
+func (gate *Gate) AdminMux() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.Handle("/sessions", gate.adminHandler(http.MethodGet, gate.handleSessions))
+	mux.Handle("/kick", gate.adminHandler(http.MethodPost, gate.handleKick))
+	mux.Handle("/broadcast", gate.adminHandler(http.MethodPost, gate.handleBroadcast))
+	mux.Handle("/bans", gate.adminHandler(http.MethodGet, gate.handleBans))
+	mux.Handle("/ban", gate.adminHandler(http.MethodPost, gate.handleBan))
+	mux.Handle("/unban", gate.adminHandler(http.MethodPost, gate.handleUnban))
+	mux.Handle("/loglevel", gate.adminHandler("", gate.handleLogLevel))
+	mux.Handle("/drain", gate.adminHandler(http.MethodPost, gate.handleDrain))
+	mux.Handle("/metrics", gate.adminAuth(metrics.Default))
+	return mux
+}
+
+func (gate *Gate) startAdmin() error {
+	if gate.AdminToken == "" && !loopback(gate.AdminAddr) {
+		return fmt.Errorf("admin addr %v is not loopback, AdminToken is required", gate.AdminAddr)
+	}
+	ln, err := gate.listen(gate.AdminAddr)
+	if err != nil {
+		return fmt.Errorf("admin listen error: %v", err)
+	}
+	gate.adminServer = &http.Server{
+		Handler:      gate.AdminMux(),
+		ReadTimeout:  10 * time.Second,
+		WriteTimeout: 10 * time.Second,
+	}
+	logger.Release("admin server start, addr %v", ln.Addr())
+	go func() {
+		if err := gate.adminServer.Serve(ln); err != nil && err != http.ErrServerClosed {
+			logger.Error("admin server error: %v", err)
+		}
+	}()
+	return nil
+}
+
+// loopback 地址是否只能本机访问, host为空时监听所有网卡
+func loopback(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// adminAuth 设置了AdminToken时检查请求带的token
+func (gate *Gate) adminAuth(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if gate.AdminToken != "" {
+			token := r.Header.Get("Authorization")
+			if subtle.ConstantTimeCompare([]byte(token), []byte("Bearer "+gate.AdminToken)) != 1 {
+				http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+				return
+			}
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// adminHandler 检查请求方法和token, method为空时不检查方法
+func (gate *Gate) adminHandler(method string, handler func(w http.ResponseWriter, r *http.Request) (interface{}, error)) http.Handler {
+	return gate.adminAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if method != "" && r.Method != method {
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+		result, err := handler(w, r)
+		if err != nil {
+			status := http.StatusBadRequest
+			var httpErr *adminError
+			if errors.As(err, &httpErr) {
+				status = httpErr.status
+			}
+			http.Error(w, err.Error(), status)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(result)
+	}))
+}
+
+type adminError struct {
+	status int
+	msg    string
+}
+
+func (e *adminError) Error() string {
+	return e.msg
+}
+
+func (gate *Gate) handleSessions(w http.ResponseWriter, r *http.Request) (interface{}, error) {
+	return gate.Sessions(), nil
+}
+
+func (gate *Gate) handleKick(w http.ResponseWriter, r *http.Request) (interface{}, error) {
+	reason := r.FormValue("reason")
+	if reason == "" {
+		reason = "kicked by admin"
+	}
+	if userID := r.FormValue("user"); userID != "" {
+		return map[string]int{"kicked": gate.KickUser(userID, KickByAdmin, reason)}, nil
+	}
+	id, err := strconv.ParseUint(r.FormValue("id"), 10, 64)
+	if err != nil {
+		return nil, errors.New("bad session id")
+	}
+	if !gate.Kick(id, KickByAdmin, reason) {
+		return nil, &adminError{status: http.StatusNotFound, msg: "session not found"}
+	}
+	return map[string]int{"kicked": 1}, nil
+}
+
+func (gate *Gate) handleBroadcast(w http.ResponseWriter, r *http.Request) (interface{}, error) {
+	if gate.Notice == nil {
+		return nil, &adminError{status: http.StatusNotImplemented, msg: "notice is not supported"}
+	}
+	text := r.FormValue("text")
+	if text == "" {
+		return nil, errors.New("empty text")
+	}
+	if err := gate.BroadcastAll(gate.Notice(text)); err != nil {
+		return nil, &adminError{status: http.StatusInternalServerError, msg: err.Error()}
+	}
+	return map[string]int{"sessions": len(gate.allSessions())}, nil
+}
+
+func (gate *Gate) handleBans(w http.ResponseWriter, r *http.Request) (interface{}, error) {
+	return gate.BanList.List(), nil
+}
+
+func (gate *Gate) handleBan(w http.ResponseWriter, r *http.Request) (interface{}, error) {
+	ip := net.ParseIP(r.FormValue("ip"))
+	if ip == nil {
+		return nil, errors.New("bad ip")
+	}
+	var duration time.Duration
+	if s := r.FormValue("duration"); s != "" {
+		var err error
+		if duration, err = time.ParseDuration(s); err != nil {
+			return nil, errors.New("bad duration")
+		}
+	}
+	gate.BanList.Ban(ip.String(), duration, r.FormValue("reason"))
+	return map[string]string{"banned": ip.String()}, nil
+}
+
+func (gate *Gate) handleUnban(w http.ResponseWriter, r *http.Request) (interface{}, error) {
+	ip := net.ParseIP(r.FormValue("ip"))
+	if ip == nil {
+		return nil, errors.New("bad ip")
+	}
+	if !gate.BanList.Unban(ip.String()) {
+		return nil, &adminError{status: http.StatusNotFound, msg: "ip not banned"}
+	}
+	return map[string]string{"unbanned": ip.String()}, nil
+}
+
+func (gate *Gate) handleLogLevel(w http.ResponseWriter, r *http.Request) (interface{}, error) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		if err := logger.SetLevel(r.FormValue("level")); err != nil {
+			return nil, err
+		}
+		logger.Release("log level changed to %v", logger.Level())
+	default:
+		return nil, &adminError{status: http.StatusMethodNotAllowed, msg: http.StatusText(http.StatusMethodNotAllowed)}
+	}
+	return map[string]string{"level": logger.Level()}, nil
+}
+
+func (gate *Gate) handleDrain(w http.ResponseWriter, r *http.Request) (interface{}, error) {
+	go gate.Drain()
+	return map[string]bool{"draining": true}, nil
+}
@@ -0,0 +1,160 @@
+/*
+ * @Author: yujiaxun
+ * @Date: 2026-10-22 16:12:44
+ * @LastEditTime: 2026-10-22 16:12:44
+ * @Description: xxx
+ */
+
+package gate_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"test/gate"
+)
+
+// adminGate 启动网关和管理接口的httptest服务
+func adminGate(t *testing.T, token string) (*gate.Gate, string, *httptest.Server) {
+	g := &gate.Gate{AdminToken: token}
+	g.Processor = loginProcessor(g)
+	addr := startGate(t, g)
+	srv := httptest.NewServer(g.AdminMux())
+	t.Cleanup(srv.Close)
+	return g, addr, srv
+}
+
+func adminDo(t *testing.T, srv *httptest.Server, method string, path string, token string, form url.Values) (int, string) {
+	t.Helper()
+	req, err := http.NewRequest(method, srv.URL+path, strings.NewReader(form.Encode()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, string(body)
+}
+
+func TestAdminMethod(t *testing.T) {
+	_, _, srv := adminGate(t, "")
+	cases := []struct {
+		method string
+		path   string
+		status int
+	}{
+		{http.MethodGet, "/sessions", http.StatusOK},
+		{http.MethodPost, "/sessions", http.StatusMethodNotAllowed},
+		{http.MethodGet, "/kick", http.StatusMethodNotAllowed},
+		{http.MethodGet, "/ban", http.StatusMethodNotAllowed},
+		{http.MethodGet, "/bans", http.StatusOK},
+		{http.MethodGet, "/loglevel", http.StatusOK},
+		{http.MethodDelete, "/loglevel", http.StatusMethodNotAllowed},
+		{http.MethodGet, "/drain", http.StatusMethodNotAllowed},
+	}
+	for _, c := range cases {
+		if status, body := adminDo(t, srv, c.method, c.path, "", nil); status != c.status {
+			t.Fatalf("%v %v: status %v %v, want %v", c.method, c.path, status, body, c.status)
+		}
+	}
+}
+
+func TestAdminToken(t *testing.T) {
+	_, _, srv := adminGate(t, "secret")
+	for _, token := range []string{"", "wrong"} {
+		if status, _ := adminDo(t, srv, http.MethodGet, "/sessions", token, nil); status != http.StatusUnauthorized {
+			t.Fatalf("token %q: status %v", token, status)
+		}
+	}
+	if status, _ := adminDo(t, srv, http.MethodGet, "/metrics", "", nil); status != http.StatusUnauthorized {
+		t.Fatalf("metrics without token: status %v", status)
+	}
+	if status, _ := adminDo(t, srv, http.MethodGet, "/sessions", "secret", nil); status != http.StatusOK {
+		t.Fatalf("right token: status %v", status)
+	}
+}
+
+func TestAdminKick(t *testing.T) {
+	g, addr, srv := adminGate(t, "")
+	c := login(t, addr, "u1")
+	waitFor(t, func() bool { return len(g.Locate("u1")) == 1 })
+
+	status, body := adminDo(t, srv, http.MethodGet, "/sessions", "", nil)
+	var sessions []gate.SessionInfo
+	if err := json.Unmarshal([]byte(body), &sessions); err != nil || status != http.StatusOK {
+		t.Fatalf("sessions: status %v %v", status, body)
+	}
+	if len(sessions) != 1 || sessions[0].UserID != "u1" {
+		t.Fatalf("sessions %+v", sessions)
+	}
+
+	if status, _ := adminDo(t, srv, http.MethodPost, "/kick", "", url.Values{"id": {"12345"}}); status != http.StatusNotFound {
+		t.Fatalf("kick unknown session: status %v", status)
+	}
+	if status, _ := adminDo(t, srv, http.MethodPost, "/kick", "", url.Values{"id": {"x"}}); status != http.StatusBadRequest {
+		t.Fatalf("kick bad id: status %v", status)
+	}
+	status, body = adminDo(t, srv, http.MethodPost, "/kick", "", url.Values{"user": {"u1"}})
+	if status != http.StatusOK || !strings.Contains(body, `"kicked":1`) {
+		t.Fatalf("kick user: status %v %v", status, body)
+	}
+	expectKicked(t, c, gate.KickByAdmin)
+	waitFor(t, func() bool { return len(g.Sessions()) == 0 })
+}
+
+func TestAdminBan(t *testing.T) {
+	g, _, srv := adminGate(t, "")
+	if status, _ := adminDo(t, srv, http.MethodPost, "/ban", "", url.Values{"ip": {"bad"}}); status != http.StatusBadRequest {
+		t.Fatalf("ban bad ip: status %v", status)
+	}
+	if status, _ := adminDo(t, srv, http.MethodPost, "/ban", "", url.Values{"ip": {"10.0.0.1"}, "duration": {"x"}}); status != http.StatusBadRequest {
+		t.Fatalf("ban bad duration: status %v", status)
+	}
+	form := url.Values{"ip": {"10.0.0.1"}, "duration": {"1m"}, "reason": {"spam"}}
+	if status, body := adminDo(t, srv, http.MethodPost, "/ban", "", form); status != http.StatusOK {
+		t.Fatalf("ban: status %v %v", status, body)
+	}
+	if !g.BanList.IsBanned("10.0.0.1") {
+		t.Fatal("ip is not banned")
+	}
+	if status, body := adminDo(t, srv, http.MethodGet, "/bans", "", nil); status != http.StatusOK || !strings.Contains(body, "10.0.0.1") {
+		t.Fatalf("bans: status %v %v", status, body)
+	}
+
+	if status, _ := adminDo(t, srv, http.MethodPost, "/unban", "", url.Values{"ip": {"10.0.0.1"}}); status != http.StatusOK {
+		t.Fatalf("unban: status %v", status)
+	}
+	if g.BanList.IsBanned("10.0.0.1") {
+		t.Fatal("ip is still banned")
+	}
+	if status, _ := adminDo(t, srv, http.MethodPost, "/unban", "", url.Values{"ip": {"10.0.0.1"}}); status != http.StatusNotFound {
+		t.Fatalf("unban again: status %v", status)
+	}
+}
+
+func TestAdminNeedsToken(t *testing.T) {
+	g := &gate.Gate{WSAddr: freeAddr(t), AdminAddr: "0.0.0.0:0", Processor: newTestProcessor()}
+	if err := g.Serve(context.Background()); err == nil || !strings.Contains(err.Error(), "AdminToken") {
+		t.Fatalf("serve error %v", err)
+	}
+	//回环地址不需要token
+	g = &gate.Gate{AdminAddr: "127.0.0.1:0", Processor: newTestProcessor()}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := g.Serve(ctx); err != nil {
+		t.Fatalf("serve on loopback: %v", err)
+	}
+}
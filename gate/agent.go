@@ -0,0 +1,41 @@
+/*
+ * @Author: yujiaxun
+ * @Date: 2026-10-19 11:02:18
+ * @LastEditTime: 2026-10-19 11:02:18
+ * @Description: 逻辑层使用的agent接口
+ */
+
+package gate
+
+import (
+	"net"
+)
+
+// 踢下线时发给客户端的websocket关闭码, 4000-4999是私有码
+const (
+	KickDuplicateLogin = 4001 //在其他地方登录
+	KickLoginRejected  = 4002 //已经在其他地方登录, 本次登录被拒绝
+	KickByBackend      = 4003 //后端要求踢掉
+	KickByAdmin        = 4004 //管理接口踢掉
+)
+
+// Agent 是Processor.Route收到的userData, 代表一个客户端会话
+type Agent interface {
+	WriteMsg(msg interface{})
+	LocalAddr() net.Addr
+	RemoteAddr() net.Addr
+	Close()
+	Destroy()
+	UserData() interface{}
+	SetUserData(data interface{})
+	// 认证通过后绑定用户, 按照Gate.LoginPolicy处理重复登录
+	Login(userID string) error
+	UserID() string
+	// 发送关闭码后断开, 不再等待重连
+	Kick(code int, reason string)
+	// 网关内唯一的会话id, 转发到后端时带上
+	ID() uint64
+	// 需要客户端确认的消息, 超时重发, 需要开启断线重连
+	WriteReliable(msg interface{}) (seq uint64, err error)
+	Unacked() int
+}
@@ -0,0 +1,262 @@
+/*
+ * @Author: yujiaxun
+ * @Date: 2026-10-19 23:55:21
+ * @LastEditTime: 2026-10-19 23:55:21
+ * @Description: 跨网关节点给用户和房间发消息
+ */
+
+package gate
+
+import (
+	"errors"
+	"reflect"
+	"time"
+
+	"test/cluster"
+	"test/logger"
+)
+
+var ErrUserOffline = errors.New("user is offline")
+
+const (
+	syncBatchSize     = 64 * 1024 //同步在线用户时每条消息的大小
+	syncRetryInterval = 50 * time.Millisecond
+)
+
+// JoinRoom 把会话加入房间, 会话关闭时自动离开所有房间
+func (gate *Gate) JoinRoom(a Agent, room string) {
+	ag, ok := a.(*agent)
+	if !ok {
+		return
+	}
+	gate.sessionMutex.Lock()
+	defer gate.sessionMutex.Unlock()
+	ag.Lock()
+	closeFlag := ag.closeFlag
+	ag.Unlock()
+	if closeFlag {
+		return
+	}
+	members, ok := gate.rooms[room]
+	if !ok {
+		members = make(map[*agent]bool)
+		gate.rooms[room] = members
+	}
+	members[ag] = true
+	if ag.rooms == nil {
+		ag.rooms = make(map[string]bool)
+	}
+	ag.rooms[room] = true
+}
+
+func (gate *Gate) LeaveRoom(a Agent, room string) {
+	ag, ok := a.(*agent)
+	if !ok {
+		return
+	}
+	gate.sessionMutex.Lock()
+	defer gate.sessionMutex.Unlock()
+	gate.leaveRoom(ag, room)
+}
+
+// leaveRoom 调用时需要持有sessionMutex
+func (gate *Gate) leaveRoom(a *agent, room string) {
+	delete(a.rooms, room)
+	members := gate.rooms[room]
+	delete(members, a)
+	if len(members) == 0 {
+		delete(gate.rooms, room)
+	}
+}
+
+// Broadcast 发给房间里的所有会话, 设置了Bus时也发给其他节点上的房间成员
+func (gate *Gate) Broadcast(room string, msg interface{}) error {
+	data, err := gate.marshal(msg)
+	if err != nil {
+		return err
+	}
+	gate.broadcastLocal(room, msgType(msg), data)
+	if gate.Bus != nil {
+		return gate.Bus.Send(&cluster.Message{Kind: cluster.KindRoom, Key: room, Data: data})
+	}
+	return nil
+}
+
+// SendToUser 发给用户的所有会话, 用户在其他节点上时通过Bus转发, 都不在线时放进Mailbox
+func (gate *Gate) SendToUser(userID string, msg interface{}) error {
+	data, err := gate.marshal(msg)
+	if err != nil {
+		return err
+	}
+	found := gate.sendLocal(userID, msgType(msg), data)
+	if gate.Bus != nil {
+		for _, node := range gate.directory.Lookup(userID) {
+			found = true
+			err = gate.Bus.Send(&cluster.Message{Kind: cluster.KindUser, To: node, Key: userID, Data: data})
+			if err != nil {
+				logger.Error("send to user %v on node %v error: %v", userID, node, err)
+			}
+		}
+	}
+	if !found && !gate.storeMail(userID, data) {
+		return ErrUserOffline
+	}
+	return err
+}
+
+// Locate 用户在线的节点, 包括本节点, 没有设置Bus时本节点的id为空
+func (gate *Gate) Locate(userID string) []string {
+	var nodes []string
+	gate.sessionMutex.Lock()
+	online := len(gate.users[userID]) > 0
+	gate.sessionMutex.Unlock()
+	if online {
+		nodes = append(nodes, gate.nodeID())
+	}
+	if gate.Bus != nil {
+		nodes = append(nodes, gate.directory.Lookup(userID)...)
+	}
+	return nodes
+}
+
+func (gate *Gate) nodeID() string {
+	if gate.Bus == nil {
+		return ""
+	}
+	return gate.Bus.NodeID()
+}
+
+func (gate *Gate) marshal(msg interface{}) ([]byte, error) {
+	if gate.Processor == nil {
+		return nil, errors.New("no processor")
+	}
+	data, err := gate.Processor.Marshal(msg)
+	if err != nil {
+		logger.Error("marshal message %v error: %v", reflect.TypeOf(msg), err)
+	}
+	return data, err
+}
+
+func (gate *Gate) sendLocal(userID string, typ string, data []byte) bool {
+	gate.sessionMutex.Lock()
+	agents := append([]*agent(nil), gate.users[userID]...)
+	gate.sessionMutex.Unlock()
+	for _, a := range agents {
+		if err := a.write(typ, data); err != nil {
+			logger.Debug("send to user %v error: %v", userID, err)
+		}
+	}
+	return len(agents) > 0
+}
+
+func (gate *Gate) broadcastLocal(room string, typ string, data []byte) {
+	gate.sessionMutex.Lock()
+	agents := make([]*agent, 0, len(gate.rooms[room]))
+	for a := range gate.rooms[room] {
+		agents = append(agents, a)
+	}
+	gate.sessionMutex.Unlock()
+	for _, a := range agents {
+		a.write(typ, data)
+	}
+}
+
+func (gate *Gate) localUsers() []string {
+	gate.sessionMutex.Lock()
+	defer gate.sessionMutex.Unlock()
+	users := make([]string, 0, len(gate.users))
+	for userID := range gate.users {
+		users = append(users, userID)
+	}
+	return users
+}
+
+// userOnline 用户在本节点上第一个会话登录, 更新在线状态并通知其他节点
+func (gate *Gate) userOnline(userID string) {
+	if gate.Presence != nil {
+		gate.Presence.Online(userID)
+	}
+	if gate.Bus != nil {
+		gate.Bus.Send(&cluster.Message{Kind: cluster.KindOnline, Key: userID})
+	}
+}
+
+// userOffline 用户在本节点上的最后一个会话关闭
+func (gate *Gate) userOffline(userID string) {
+	if gate.Presence != nil {
+		gate.Presence.Offline(userID)
+	}
+	if gate.Bus != nil {
+		gate.Bus.Send(&cluster.Message{Kind: cluster.KindOffline, Key: userID})
+	}
+}
+
+// syncUsers 把本节点的在线用户分批发给node, 总线忙时等一会儿重试, 每次重试重新取在线用户
+// 在单独的协程里执行, 不阻塞总线的协程
+func (gate *Gate) syncUsers(node string) {
+	for {
+		err := gate.sendUsers(node)
+		if err == nil {
+			return
+		}
+		if err != cluster.ErrBusBusy {
+			logger.Debug("sync users to node %v error: %v", node, err)
+			return
+		}
+		time.Sleep(syncRetryInterval)
+	}
+}
+
+func (gate *Gate) sendUsers(node string) error {
+	users := gate.localUsers()
+	for len(users) > 0 {
+		n, size := 0, 0
+		for n < len(users) && size+2+len(users[n]) <= syncBatchSize {
+			size += 2 + len(users[n])
+			n++
+		}
+		if n == 0 {
+			//用户id本身超过了一批的大小
+			n = 1
+		}
+		err := gate.Bus.Send(&cluster.Message{Kind: cluster.KindUsers, To: node, Data: cluster.EncodeUsers(users[:n])})
+		if err != nil {
+			return err
+		}
+		users = users[n:]
+	}
+	return nil
+}
+
+func (gate *Gate) onClusterMessage(msg *cluster.Message) {
+	switch msg.Kind {
+	case cluster.KindUser:
+		if !gate.sendLocal(msg.Key, typeCluster, msg.Data) {
+			//目录还没更新时用户已经下线
+			gate.storeMail(msg.Key, msg.Data)
+		}
+	case cluster.KindRoom:
+		gate.broadcastLocal(msg.Key, typeCluster, msg.Data)
+	case cluster.KindOnline:
+		gate.directory.Add(msg.Key, msg.From)
+	case cluster.KindOffline:
+		gate.directory.Remove(msg.Key, msg.From)
+	case cluster.KindUsers:
+		users, err := cluster.DecodeUsers(msg.Data)
+		if err != nil {
+			logger.Error("decode users from node %v error: %v", msg.From, err)
+			return
+		}
+		for _, userID := range users {
+			gate.directory.Add(userID, msg.From)
+		}
+	case cluster.KindSync:
+		go gate.syncUsers(msg.From)
+	case cluster.KindNodeUp:
+		//双方互相同步在线用户, 单向断线重连后也能恢复
+		go gate.syncUsers(msg.From)
+		gate.Bus.Send(&cluster.Message{Kind: cluster.KindSync, To: msg.From})
+	case cluster.KindNodeDown:
+		gate.directory.RemoveNode(msg.From)
+	}
+}
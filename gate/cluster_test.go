@@ -0,0 +1,98 @@
+/*
+ * @Author: yujiaxun
+ * @Date: 2026-10-22 11:36:02
+ * @LastEditTime: 2026-10-22 11:36:02
+ * @Description: xxx
+ */
+
+package gate_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"test/cluster"
+	"test/gate"
+
+	"github.com/gorilla/websocket"
+)
+
+// loginProcessor 收到"login:用户id"时登录, "join:房间"时加入房间
+func loginProcessor(g *gate.Gate) *testProcessor {
+	p := newTestProcessor()
+	p.route = func(msg []byte, a gate.Agent) error {
+		s := string(msg)
+		switch {
+		case strings.HasPrefix(s, "login:"):
+			return a.Login(strings.TrimPrefix(s, "login:"))
+		case strings.HasPrefix(s, "join:"):
+			g.JoinRoom(a, strings.TrimPrefix(s, "join:"))
+		}
+		p.msgs <- msg
+		return nil
+	}
+	return p
+}
+
+func login(t *testing.T, addr string, userID string) *websocket.Conn {
+	c := dial(t, addr, "")
+	c.WriteMessage(websocket.BinaryMessage, []byte("login:"+userID))
+	return c
+}
+
+func TestClusterHub(t *testing.T) {
+	//待处理的消息数比在线用户少, 同步时要分批发送
+	hub := cluster.NewHub()
+	hub.PendingNum = 4
+	g1 := &gate.Gate{Bus: hub.Node("g1")}
+	g1.Processor = loginProcessor(g1)
+	addr1 := startGate(t, g1)
+
+	const userNum = 20
+	conns := make([]*websocket.Conn, userNum)
+	for i := range conns {
+		conns[i] = login(t, addr1, fmt.Sprintf("u%v", i))
+	}
+	waitFor(t, func() bool { return len(g1.Locate(fmt.Sprintf("u%v", userNum-1))) == 1 })
+
+	g2 := &gate.Gate{Bus: hub.Node("g2")}
+	g2.Processor = loginProcessor(g2)
+	addr2 := startGate(t, g2)
+	//g2加入后同步g1上已经在线的用户
+	for i := 0; i < userNum; i++ {
+		userID := fmt.Sprintf("u%v", i)
+		waitFor(t, func() bool { return len(g2.Locate(userID)) == 1 })
+	}
+
+	if err := g2.SendToUser("u7", []byte("hello u7")); err != nil {
+		t.Fatal(err)
+	}
+	if data := readMsg(t, conns[7]); string(data) != "hello u7" {
+		t.Fatalf("u7 got %q", data)
+	}
+
+	//g2上新登录的用户通过KindOnline通知g1
+	c := login(t, addr2, "v1")
+	waitFor(t, func() bool {
+		nodes := g1.Locate("v1")
+		return len(nodes) == 1 && nodes[0] == "g2"
+	})
+	c.WriteMessage(websocket.BinaryMessage, []byte("join:room1"))
+	conns[0].WriteMessage(websocket.BinaryMessage, []byte("join:room1"))
+	time.Sleep(50 * time.Millisecond)
+	if err := g1.Broadcast("room1", []byte("hi room1")); err != nil {
+		t.Fatal(err)
+	}
+	if data := readMsg(t, c); string(data) != "hi room1" {
+		t.Fatalf("v1 got %q", data)
+	}
+	if data := readMsg(t, conns[0]); string(data) != "hi room1" {
+		t.Fatalf("u0 got %q", data)
+	}
+
+	//用户下线后其他节点上的目录也删除
+	c.Close()
+	waitFor(t, func() bool { return len(g1.Locate("v1")) == 0 })
+}
@@ -0,0 +1,63 @@
+/*
+ * @Author: yujiaxun
+ * @Date: 2026-10-22 14:40:18
+ * @LastEditTime: 2026-10-22 14:40:18
+ * @Description: xxx
+ */
+
+package gate_test
+
+import (
+	"encoding/binary"
+	"fmt"
+	"testing"
+
+	"test/backend"
+	"test/gate"
+
+	"github.com/gorilla/websocket"
+)
+
+// keyProcessor 所有消息都转发, 消息内容就是路由的key
+type keyProcessor struct {
+	*testProcessor
+}
+
+func (p keyProcessor) RouteKey(msg interface{}) (string, bool) {
+	return string(msg.([]byte)), true
+}
+
+// unroutableGate 两个服务并且没有路由表, 所有消息都无法路由
+func unroutableGate(t *testing.T) *gate.Gate {
+	return &gate.Gate{
+		Processor: keyProcessor{newTestProcessor()},
+		Backends:  map[string][]string{"s1": {freeAddr(t)}, "s2": {freeAddr(t)}},
+	}
+}
+
+func TestForwardErrorFrame(t *testing.T) {
+	addr := startGate(t, unroutableGate(t))
+	c := dial(t, addr, "")
+	c.WriteMessage(websocket.BinaryMessage, []byte("login"))
+	//没有开启断线重连也发送frameError帧
+	data := readMsg(t, c)
+	if len(data) != 12 || data[0] != 2 || binary.BigEndian.Uint64(data[1:]) != 0 {
+		t.Fatalf("got frame %v", data)
+	}
+	if code := binary.BigEndian.Uint16(data[9:]); code != backend.CodeUnroutable || data[11] != 0 {
+		t.Fatalf("got code %v retryable %v", code, data[11])
+	}
+}
+
+func TestForwardErrorMsg(t *testing.T) {
+	g := unroutableGate(t)
+	g.ForwardError = func(code int, retryable bool) interface{} {
+		return []byte(fmt.Sprintf("error %v %v", code, retryable))
+	}
+	addr := startGate(t, g)
+	c := dial(t, addr, "")
+	c.WriteMessage(websocket.BinaryMessage, []byte("login"))
+	if data := readMsg(t, c); string(data) != "error 1 false" {
+		t.Fatalf("got %q", data)
+	}
+}
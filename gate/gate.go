@@ -8,24 +8,44 @@
 package gate
 
 import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
 	"net"
+	"net/http"
+	"os"
+	"os/signal"
 	"reflect"
+	"strconv"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"test/backend"
+	"test/cluster"
+	"test/discovery"
 	"test/logger"
+	"test/mailbox"
 	"test/network"
+	"test/presence"
+	"test/restart"
 )
 
 type Gate struct {
 	MaxConnNum      int
 	PendingWriteNum int
+	PendingReadNum  int
 	MaxMsgLen       uint32
 	Processor       network.Processor
+	Hooks           Hooks //会话建立, 登录, 关闭和出错时的回调
 	// AgentChanRPC    *chanrpc.Server
 
 	// websocket
 	WSAddr      string
 	HTTPTimeout time.Duration
+	PongWait    time.Duration //心跳检测时间, 默认60秒
+	HttpsFlag   bool          //使用CertFile和KeyFile开启wss
 	CertFile    string
 	KeyFile     string
 
@@ -33,23 +53,213 @@ type Gate struct {
 	TCPAddr      string
 	LenMsgLen    int
 	LittleEndian bool
+
+	// 断线重连
+	ResumeWait      time.Duration //断线后会话保留的时间, 0表示不开启
+	ReplayBufferNum int           //会话最多缓存的下行消息数, 不要超过PendingWriteNum
+	AckTimeout      time.Duration //可靠消息等待确认的时间, 超时后重发, 默认5秒
+
+	// 重复登录
+	LoginPolicy     LoginPolicy
+	MaxUserSessions int //LoginAllowMulti时每个用户最多的会话数
+	OnLogin         func(ev LoginEvent)
+
+	// 上行限流, 按消息类型的限流由Processor实现network.MsgLimiter
+	ConnRateLimit *network.RateLimit
+	IPRateLimit   *network.RateLimit
+
+	// 按ip限制连接, BanList为nil时自动创建, 可以在运行时封禁和解封
+	MaxConnPerIP  int
+	UpgradePerSec float64
+	UpgradeBurst  int
+	BanList       *network.BanList
+
+	// 允许的Origin, 支持*通配符, 为空时不检查
+	AllowedOrigins []string
+
+	// 转发到后端, Processor实现network.RouteKeyer时消息可以转发
+	// 只有一个服务并且没有路由表时, 所有消息都转发到这个服务
+	Backends       map[string][]string //服务名 -> 实例地址
+	Discovery      discovery.Provider  //设置后从服务发现获取实例, 不再使用Backends
+	Balancers      map[string]string   //服务名 -> roundrobin, leastpending 或 hash(按用户id)
+	BackendConnNum int
+	RouteFile      string                   //路由表, 可以调用Router().Reload()重新加载
+	OnForwardError func(a Agent, err error) //转发失败时调用, 例如*backend.UnroutableError
+	OnRebalance    func(ev backend.RebalanceEvent)
+	BackendHealth  backend.HealthConfig //健康检查和熔断, Interval大于0时开启, 后端需要回复KindPong
+	// 把转发失败的错误码转成Processor能编码的消息发给客户端
+	// 没有设置时发送frameError帧, 没有开启断线重连的客户端也会收到这个带帧头的帧
+	ForwardError func(code int, retryable bool) interface{}
+
+	// 多个网关节点之间的消息总线, 设置后SendToUser和Broadcast可以跨节点
+	Bus cluster.Bus
+	// 在线状态, 用户上下线和收到pong时更新, Run时启动, 退出时关闭
+	Presence *presence.Service
+	// 离线消息, SendToUser找不到用户时保存, 用户登录后投递, 需要先调用Open, Run退出时关闭
+	// 客户端确认后才从邮箱删除, 所以需要开启断线重连(ResumeWait > 0)
+	Mailbox *mailbox.Mailbox
+
+	// 管理接口, 单独监听AdminAddr, 设置AdminToken时请求需要带上 Authorization: Bearer <token>
+	// AdminAddr不是回环地址时必须设置AdminToken
+	AdminAddr  string
+	AdminToken string
+	Notice     func(text string) interface{} //把系统公告转成Processor能编码的消息, 没有设置时不能广播公告
+
+	// 排空, 通过Drain或者管理接口触发, 关闭时也会等待写队列发完
+	DrainNotice  string        //排空时先发给客户端的公告, 例如让客户端重连到其他节点, 需要设置Notice
+	DrainTimeout time.Duration //等待写队列发完的时间, 超时后强制关闭, 默认10秒
+
+	// 热重启, 只支持linux, 收到SIGUSR2时用同样的参数启动新进程并把监听交给它, 然后排空退出
+	HotRestart     bool
+	RestartTimeout time.Duration //等待新进程就绪的时间, 默认30秒
+
+	wsServer     *network.WSServer
+	adminServer  *http.Server
+	draining     int32 //调用Drain之后为1
+	forwarder    *backend.Forwarder
+	lastID       uint64
+	sessionMutex sync.Mutex
+	agents       map[uint64]*agent   //id -> agent
+	sessions     map[string]*agent   //token -> agent
+	users        map[string][]*agent //userID -> agent, 按登录先后排序
+	rooms        map[string]map[*agent]bool
+	directory    *cluster.Directory   //其他节点上的用户
+	serveMutex   sync.Mutex           //保护wsServer, forwarder和Serve用的channel, 其他协程通过它读取
+	shutdownChan chan context.Context //Shutdown把排空的期限交给Serve
+	serveDone    chan struct{}        //Serve退出后关闭
+	served       bool                 //Serve已经调用过
 }
 
+// Run 实现module.Module, closeSig收到值时关闭, 启动失败时退出进程
 func (gate *Gate) Run(closeSig chan bool) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-closeSig:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	if err := gate.Serve(ctx); err != nil {
+		logger.Fatal("gate serve error: %v", err)
+	}
+}
+
+// ErrServed 同一个Gate的Serve只能调用一次, 退出后需要新建Gate
+var ErrServed = errors.New("gate already served")
+
+// Serve 启动网关并阻塞到ctx取消, Shutdown完成或者热重启交接完成
+// ctx取消时按DrainTimeout排空连接, 监听失败等启动错误会关闭已经启动的部分并返回
+func (gate *Gate) Serve(ctx context.Context) error {
+	shutdownChan, serveDone, err := gate.startServe()
+	if err != nil {
+		return err
+	}
+	defer close(serveDone)
+	if gate.BanList == nil {
+		gate.BanList = network.NewBanList()
+	}
+	if gate.AckTimeout <= 0 {
+		gate.AckTimeout = 5 * time.Second
+	}
+	if gate.DrainTimeout <= 0 {
+		gate.DrainTimeout = 10 * time.Second
+	}
+	if gate.RestartTimeout <= 0 {
+		gate.RestartTimeout = 30 * time.Second
+	}
+	if gate.Mailbox != nil && gate.ResumeWait <= 0 {
+		return ErrMailboxNoSession
+	}
 	var wsServer *network.WSServer
 	if gate.WSAddr != "" {
 		wsServer = new(network.WSServer)
 		wsServer.Addr = gate.WSAddr
 		wsServer.MaxConnNum = gate.MaxConnNum
 		wsServer.PendingWriteNum = gate.PendingWriteNum
+		wsServer.PendingReadNum = gate.PendingReadNum
 		wsServer.ReadBufferSize = int(gate.MaxMsgLen)
+		wsServer.WriteBufferSize = int(gate.MaxMsgLen)
 		wsServer.HTTPTimeout = gate.HTTPTimeout
+		wsServer.PongWait = gate.PongWait
+		wsServer.HttpsFlag = gate.HttpsFlag
+		wsServer.DrainTimeout = gate.DrainTimeout
 		wsServer.CertFile = gate.CertFile
 		wsServer.KeyFile = gate.KeyFile
-		wsServer.NewAgent = func(conn *network.WSConn) network.Agent {
-			a := &agent{conn: conn, gate: gate}
-			return a
+		wsServer.ConnRateLimit = gate.ConnRateLimit
+		wsServer.IPRateLimit = gate.IPRateLimit
+		wsServer.MaxConnPerIP = gate.MaxConnPerIP
+		wsServer.UpgradePerSec = gate.UpgradePerSec
+		wsServer.UpgradeBurst = gate.UpgradeBurst
+		wsServer.BanList = gate.BanList
+		wsServer.AllowedOrigins = gate.AllowedOrigins
+		wsServer.NewAgent = gate.newAgent
+		wsServer.ReadyCheck = gate.ready
+	}
+	gate.agents = make(map[uint64]*agent)
+	gate.sessions = make(map[string]*agent)
+	gate.users = make(map[string][]*agent)
+	gate.rooms = make(map[string]map[*agent]bool)
+
+	//按启动的相反顺序关闭, 启动失败时也要关闭已经启动的部分
+	var closers []func()
+	defer func() {
+		for i := len(closers) - 1; i >= 0; i-- {
+			closers[i]()
+		}
+	}()
+	if gate.Mailbox != nil {
+		closers = append(closers, func() { gate.Mailbox.Close() })
+	}
+	if gate.Presence != nil {
+		//心跳最多每TTL/2写入一次, 再加上ping的间隔, TTL不到PongWait的两倍时在线用户会被误判离线
+		pongWait := gate.PongWait
+		if pongWait <= 0 {
+			pongWait = 60 * time.Second
+		}
+		if gate.Presence.TTL < 2*pongWait {
+			gate.Presence.TTL = 2 * pongWait
+			logger.Release("presence TTL is shorter than twice PongWait, reset to %v", gate.Presence.TTL)
+		}
+		if gate.Presence.Node == "" {
+			gate.Presence.Node = gate.nodeID()
+		}
+		gate.Presence.Start()
+		closers = append(closers, gate.Presence.Close)
+	}
+	if gate.Bus != nil {
+		gate.directory = cluster.NewDirectory()
+		if err := gate.Bus.Start(gate.onClusterMessage); err != nil {
+			return fmt.Errorf("start cluster bus error: %v", err)
+		}
+		closers = append(closers, gate.Bus.Close)
+	}
+
+	if len(gate.Backends) > 0 || gate.Discovery != nil {
+		router, err := gate.newRouter()
+		if err != nil {
+			return fmt.Errorf("load route table error: %v", err)
+		}
+		forwarder := new(backend.Forwarder)
+		forwarder.Services = gate.Backends
+		forwarder.Discovery = gate.Discovery
+		forwarder.Balancers = gate.Balancers
+		forwarder.OnRebalance = gate.OnRebalance
+		forwarder.Health = gate.BackendHealth
+		forwarder.Router = router
+		forwarder.ConnNum = gate.BackendConnNum
+		forwarder.PendingWriteNum = gate.PendingWriteNum
+		forwarder.MaxMsgLen = gate.MaxMsgLen
+		forwarder.OnDeliver = gate.deliver
+		forwarder.OnKick = gate.kick
+		if err := forwarder.Start(); err != nil {
+			return fmt.Errorf("start forwarder error: %v", err)
 		}
+		closers = append(closers, forwarder.Close)
+		gate.serveMutex.Lock()
+		gate.forwarder = forwarder
+		gate.serveMutex.Unlock()
 	}
 
 	// var tcpServer *network.TCPServer
@@ -70,53 +280,487 @@ func (gate *Gate) Run(closeSig chan bool) {
 	// 	}
 	// }
 
+	//还在等待重连的会话也要关闭
+	closers = append(closers, func() {
+		for _, a := range gate.allSessions() {
+			a.destroy(network.CloseShutdown)
+		}
+	})
+	var drainCtx context.Context //Shutdown传进来的期限, 为nil时用DrainTimeout
+	serveErr := make(chan error, 1)
 	if wsServer != nil {
-		wsServer.Start()
+		ln, err := gate.listen(gate.WSAddr)
+		if err != nil {
+			return fmt.Errorf("listen %v error: %v", gate.WSAddr, err)
+		}
+		wsServer.Listener = ln
+		wsServer.Init()
+		//到这里网关已经初始化完成, WSServer()返回非nil之后其他协程可以安全地调用网关的方法
+		gate.serveMutex.Lock()
+		gate.wsServer = wsServer
+		gate.serveMutex.Unlock()
+		wsDone := make(chan bool)
+		go func() {
+			if err := wsServer.Serve(context.Background()); err != nil {
+				serveErr <- err
+			}
+			close(wsDone)
+		}()
+		closers = append(closers, func() {
+			//等连接上的消息发完再关闭会话
+			ctx, cancel := context.WithTimeout(context.Background(), gate.DrainTimeout)
+			defer cancel()
+			if drainCtx != nil {
+				ctx = drainCtx
+			}
+			wsServer.Shutdown(ctx)
+			<-wsDone
+		})
+	}
+	if gate.AdminAddr != "" {
+		if err := gate.startAdmin(); err != nil {
+			return err
+		}
+		closers = append(closers, func() { gate.adminServer.Close() })
 	}
 	// if tcpServer != nil {
 	// 	tcpServer.Start()
 	// }
-	<-closeSig
-	if wsServer != nil {
-		wsServer.Close()
+	var restartSig chan os.Signal
+	if gate.HotRestart {
+		if err := restart.Ready(); err != nil {
+			logger.Error("notify parent ready error: %v", err)
+		}
+		restartSig = make(chan os.Signal, 1)
+		restart.Notify(restartSig)
+		defer signal.Stop(restartSig)
 	}
-	// if tcpServer != nil {
-	// 	tcpServer.Close()
-	// }
+	for exit := false; !exit; {
+		select {
+		case <-ctx.Done():
+			exit = true
+		case drainCtx = <-shutdownChan:
+			exit = true
+		case err := <-serveErr:
+			return err
+		case <-restartSig:
+			exit = gate.hotRestart()
+		}
+	}
+	return nil
+}
+
+// Shutdown 让Serve退出, 连接的写队列要在ctx到期之前发完, 到期后强制关闭
+// Serve退出之前ctx到期时返回ctx的错误
+func (gate *Gate) Shutdown(ctx context.Context) error {
+	shutdownChan, serveDone := gate.serveChans()
+	select {
+	case shutdownChan <- ctx:
+	default:
+		//已经有Shutdown在等待
+	}
+	select {
+	case <-serveDone:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (gate *Gate) serveChans() (chan context.Context, chan struct{}) {
+	gate.serveMutex.Lock()
+	defer gate.serveMutex.Unlock()
+	if gate.shutdownChan == nil {
+		gate.shutdownChan = make(chan context.Context, 1)
+		gate.serveDone = make(chan struct{})
+	}
+	return gate.shutdownChan, gate.serveDone
 }
 
+// startServe 标记网关已经启动, Serve只能调用一次
+func (gate *Gate) startServe() (chan context.Context, chan struct{}, error) {
+	shutdownChan, serveDone := gate.serveChans()
+	gate.serveMutex.Lock()
+	defer gate.serveMutex.Unlock()
+	if gate.served {
+		return nil, nil, ErrServed
+	}
+	gate.served = true
+	return shutdownChan, serveDone, nil
+}
+
+func (gate *Gate) OnInit() {}
+
 func (gate *Gate) OnDestroy() {}
 
+func (gate *Gate) newAgent(conn *network.WSConn) network.Agent {
+	if gate.ResumeWait > 0 {
+		if a := gate.resume(conn); a != nil {
+			conn.SetOnPong(a.heartbeat)
+			return &attachment{a: a, conn: conn}
+		}
+	}
+	a := &agent{conn: conn, gate: gate, attached: true, createdAt: time.Now()}
+	conn.SetOnPong(a.heartbeat)
+	a.id = atomic.AddUint64(&gate.lastID, 1)
+	sessionCurrent.Inc()
+	gate.sessionMutex.Lock()
+	gate.agents[a.id] = a
+	if gate.ResumeWait > 0 {
+		a.session = newSession(gate.ReplayBufferNum)
+		gate.sessions[a.session.token] = a
+	}
+	gate.sessionMutex.Unlock()
+	if a.session != nil {
+		conn.WriteMsg(a.session.sessionFrame())
+	}
+	if gate.Hooks != nil {
+		gate.Hooks.OnConnect(a)
+	}
+	// if gate.AgentChanRPC != nil {
+	// 	gate.AgentChanRPC.Go("NewAgent", a)
+	// }
+	return &attachment{a: a, conn: conn}
+}
+
+// resume 根据url上的token找回断线的会话, 找不到或者无法重放时返回nil
+func (gate *Gate) resume(conn *network.WSConn) *agent {
+	query := conn.Request().URL.Query()
+	token := query.Get(resumeTokenKey)
+	if token == "" {
+		return nil
+	}
+	seq, err := parseSeq(query.Get(resumeSeqKey))
+	if err != nil {
+		logger.Debug("resume session with bad seq: %v", err)
+		return nil
+	}
+	gate.sessionMutex.Lock()
+	a := gate.sessions[token]
+	gate.sessionMutex.Unlock()
+	if a == nil {
+		logger.Debug("resume session %v not found", token)
+		return nil
+	}
+	if !a.attach(conn, seq) {
+		//客户端漏掉的消息已经不在缓冲区里了, 旧会话作废
+		logger.Debug("resume session %v failed, seq %v", token, seq)
+		a.destroy("")
+		return nil
+	}
+	logger.Debug("resume session %v, seq %v", token, seq)
+	return a
+}
+
+func (gate *Gate) allSessions() []*agent {
+	gate.sessionMutex.Lock()
+	defer gate.sessionMutex.Unlock()
+	agents := make([]*agent, 0, len(gate.agents))
+	for _, a := range gate.agents {
+		agents = append(agents, a)
+	}
+	return agents
+}
+
+func (gate *Gate) newRouter() (*backend.Router, error) {
+	if gate.RouteFile != "" {
+		return backend.LoadRouter(gate.RouteFile)
+	}
+	conf := new(backend.RouteConfig)
+	if len(gate.Backends) == 1 {
+		for service := range gate.Backends {
+			conf.Default = service
+		}
+	}
+	return backend.NewRouter(conf)
+}
+
+// Router 转发用的路由表, 没有配置后端时返回nil
+func (gate *Gate) Router() *backend.Router {
+	gate.serveMutex.Lock()
+	defer gate.serveMutex.Unlock()
+	if gate.forwarder == nil {
+		return nil
+	}
+	return gate.forwarder.Router
+}
+
+// ready 给readyz用, 排空中或者有后端服务不可用时返回错误
+func (gate *Gate) ready() error {
+	if gate.Draining() {
+		return errors.New("draining")
+	}
+	if gate.forwarder != nil {
+		return gate.forwarder.Ready()
+	}
+	return nil
+}
+
+// WSServer 运行时修改限流, Origin白名单和证书时使用, Serve建立监听之前或者没有配置WSAddr时返回nil
+func (gate *Gate) WSServer() *network.WSServer {
+	gate.serveMutex.Lock()
+	defer gate.serveMutex.Unlock()
+	return gate.wsServer
+}
+
+func (gate *Gate) agentByID(id uint64) *agent {
+	gate.sessionMutex.Lock()
+	defer gate.sessionMutex.Unlock()
+	return gate.agents[id]
+}
+
+// deliver 后端发给客户端的消息, data已经是Processor编码好的
+func (gate *Gate) deliver(id uint64, data []byte) {
+	a := gate.agentByID(id)
+	if a == nil {
+		logger.Debug("deliver to unknown session %v", id)
+		return
+	}
+	if err := a.write(typeBackend, data); err != nil {
+		logger.Error("deliver message to session %v error: %v", id, err)
+	}
+}
+
+func (gate *Gate) kick(id uint64, reason string) {
+	if a := gate.agentByID(id); a != nil {
+		a.Kick(KickByBackend, reason)
+	}
+}
+
+// attachment 把一条网络连接挂到agent上, 断线重连后同一个agent会先后挂上多条连接
+type attachment struct {
+	a    *agent
+	conn network.Conn
+}
+
+func (at *attachment) Run() {
+	at.a.run(at.conn)
+}
+
+func (at *attachment) OnClose() {
+	at.a.detach(at.conn)
+}
+
 type agent struct {
-	conn     network.Conn
-	gate     *Gate
-	userData interface{}
+	sync.Mutex
+	conn        network.Conn //最后挂上的连接
+	gate        *Gate
+	id          uint64
+	userData    interface{}
+	userID      string
+	session     *session //没有开启断线重连时为nil
+	attached    bool     //conn是否可用
+	noResume    bool     //逻辑层主动关闭, 不再等待重连
+	closeFlag   bool
+	detachTimer *time.Timer
+	limiters    map[string]*network.Limiter //按消息类型的限流
+	delayed     []delayedMsg                //按消息类型限流等待中的消息, 到时间后按顺序处理
+	delayTimer  *time.Timer                 //delayed里第一条消息到时间时触发
+	rooms       map[string]bool             //加入的房间, 由gate.sessionMutex保护
+	mailAcks    []mailAck                   //已经投递但客户端还没确认的离线消息
+	delivering  bool                        //正在投递离线消息, 期间write的消息先放进deferred
+	deferred    []deferredMsg
+	unacked     []unackedFrame //还没确认的可靠消息, 按seq递增
+	retryTimer  *time.Timer
+	createdAt   time.Time
+
+	dispatchMutex sync.Mutex //run和到时间的限流消息串行处理
 }
 
-func (a *agent) Run() {
+func (a *agent) run(conn network.Conn) {
 	for {
-		data, err := a.conn.ReadMsg()
+		data, err := conn.ReadMsg()
 		if err != nil {
 			// logger.Debug("read message: %v", err)
 			break
 		}
 
-		if a.gate.Processor.(network.Processor) != nil {
+		if a.session != nil {
+			kind, payload, err := decodeFrame(data)
+			if err != nil {
+				logger.Debug("decode frame error: %v", err)
+				conn.SetCloseReason(network.CloseProtocolError)
+				a.onError(err)
+				break
+			}
+			if kind == frameAck {
+				seq := binary.BigEndian.Uint64(payload)
+				a.Lock()
+				a.session.ack(seq)
+				a.ackReliable(seq)
+				mailID, userID := a.ackMails(seq), a.userID
+				a.Unlock()
+				if mailID > 0 {
+					if err := a.gate.Mailbox.Ack(userID, mailID); err != nil {
+						logger.Error("ack mail of user %v error: %v", userID, err)
+					}
+				}
+				continue
+			}
+			data = payload
+		}
+
+		if a.gate.Processor != nil {
 			msg, err := a.gate.Processor.Unmarshal(data)
 			if err != nil {
 				logger.Debug("unmarshal message error: %v", err)
+				conn.SetCloseReason(network.CloseProtocolError)
+				a.onError(err)
 				break
 			}
-			err = a.gate.Processor.Route(msg, a)
-			if err != nil {
-				logger.Debug("route message error: %v", err)
+			typ := msgType(msg)
+			countIn(typ, len(data))
+			ok, wait := a.checkMsgLimit(msg, len(data))
+			if !ok {
+				continue
+			}
+			a.dispatchMutex.Lock()
+			ok = a.delay(msg, data, typ, wait) || a.dispatch(conn, msg, data, typ)
+			a.dispatchMutex.Unlock()
+			if !ok {
 				break
 			}
 		}
 	}
 }
 
-func (a *agent) OnClose() {
+// dispatch 转发或者路由一条消息, 返回false时需要关闭连接, 调用时需要持有dispatchMutex
+func (a *agent) dispatch(conn network.Conn, msg interface{}, data []byte, typ string) bool {
+	if a.forward(msg, data) {
+		return true
+	}
+	var err error
+	start := time.Now()
+	if router, ok := a.gate.Processor.(network.ContextRouter); ok {
+		err = router.RouteContext(conn.Context(), msg, a)
+	} else {
+		err = a.gate.Processor.Route(msg, a)
+	}
+	routeDuration.With(typ).Observe(time.Since(start).Seconds())
+	if err != nil {
+		logger.Debug("route message error: %v", err)
+		a.onError(err)
+		a.Lock()
+		closing := a.noResume
+		a.Unlock()
+		//已经被踢掉, 例如登录被拒绝, 继续读到连接关闭, 让关闭帧先发出去
+		return closing
+	}
+	return true
+}
+
+// attach 把重连上来的连接挂到agent上, 并重放seq之后的消息
+func (a *agent) attach(conn network.Conn, seq uint64) bool {
+	a.Lock()
+	if a.closeFlag {
+		a.Unlock()
+		return false
+	}
+	frames, ok := a.session.replay(seq)
+	if !ok {
+		a.Unlock()
+		return false
+	}
+	old, oldAttached := a.conn, a.attached
+	a.conn = conn
+	a.attached = true
+	if a.detachTimer != nil {
+		a.detachTimer.Stop()
+		a.detachTimer = nil
+	}
+	conn.WriteMsg(a.session.sessionFrame())
+	for _, frame := range frames {
+		if err := conn.WriteMsg(frame); err != nil {
+			logger.Error("replay message error: %v", err)
+			break
+		}
+	}
+	a.restartRetransmit()
+	a.Unlock()
+
+	if oldAttached {
+		//服务端还没发现旧连接断开
+		old.Close()
+	}
+	return true
+}
+
+// detach 连接断开, 开启了断线重连时等待ResumeWait后才真正关闭
+func (a *agent) detach(conn network.Conn) {
+	a.Lock()
+	if a.closeFlag || a.conn != conn || !a.attached {
+		//已经重连到了新的连接上
+		a.Unlock()
+		return
+	}
+	a.attached = false
+	a.stopRetransmit()
+	if a.session == nil || a.noResume {
+		a.Unlock()
+		a.destroy("")
+		return
+	}
+	var timer *time.Timer
+	timer = time.AfterFunc(a.gate.ResumeWait, func() {
+		a.Lock()
+		expired := a.detachTimer == timer
+		a.Unlock()
+		if expired {
+			logger.Debug("session %v resume timeout", a.session.token)
+			a.destroy("")
+		}
+	})
+	a.detachTimer = timer
+	a.Unlock()
+}
+
+// destroy 真正关闭会话, 只会执行一次, reason为空时使用连接关闭的原因
+func (a *agent) destroy(reason network.CloseReason) {
+	a.Lock()
+	if a.closeFlag {
+		a.Unlock()
+		return
+	}
+	a.closeFlag = true
+	a.attached = false
+	if a.detachTimer != nil {
+		a.detachTimer.Stop()
+		a.detachTimer = nil
+	}
+	if a.delayTimer != nil {
+		a.delayTimer.Stop()
+		a.delayTimer = nil
+	}
+	a.delayed = nil
+	a.Unlock()
+
+	sessionCurrent.Dec()
+	a.gate.sessionMutex.Lock()
+	delete(a.gate.agents, a.id)
+	if a.session != nil {
+		delete(a.gate.sessions, a.session.token)
+	}
+	for room := range a.rooms {
+		a.gate.leaveRoom(a, room)
+	}
+	a.gate.sessionMutex.Unlock()
+	a.logout()
+	a.saveUnacked()
+	a.conn.Close()
+	if reason == "" {
+		reason = a.conn.CloseReason()
+	}
+	if a.gate.forwarder != nil {
+		a.gate.forwarder.SessionClosed(a.id)
+	}
+	a.OnClose(reason)
+}
+
+func (a *agent) OnClose(reason network.CloseReason) {
+	sessionClosedTotal.With(string(reason)).Inc()
+	if a.gate.Hooks != nil {
+		a.gate.Hooks.OnClose(a, reason)
+	}
 	// if a.gate.AgentChanRPC != nil {
 	// 	err := a.gate.AgentChanRPC.Call0("CloseAgent", a)
 	// 	if err != nil {
@@ -125,34 +769,139 @@ func (a *agent) OnClose() {
 	// }
 }
 
+// onError 处理消息出错, 返回后连接会被关闭
+func (a *agent) onError(err error) {
+	if a.gate.Hooks != nil {
+		a.gate.Hooks.OnError(a, err)
+	}
+}
+
 func (a *agent) WriteMsg(msg interface{}) {
-	if a.gate.Processor.(network.Processor) != nil {
+	if a.gate.Processor != nil {
 		data, err := a.gate.Processor.Marshal(msg)
 		if err != nil {
 			logger.Error("marshal message %v error: %v", reflect.TypeOf(msg), err)
 			return
 		}
-		err = a.conn.WriteMsg(data)
+		err = a.write(msgType(msg), data)
 		if err != nil {
 			logger.Error("write message %v error: %v", reflect.TypeOf(msg), err)
 		}
 	}
 }
 
+// write 发送编码好的消息, typ为消息类型, 只用于统计
+func (a *agent) write(typ string, data []byte) error {
+	a.Lock()
+	defer a.Unlock()
+	if a.closeFlag {
+		writeFailed.With(typ).Inc()
+		return errors.New("agent is closed")
+	}
+	if a.delivering {
+		//等离线消息投递完再发, 保证先后顺序
+		a.deferred = append(a.deferred, deferredMsg{typ: typ, data: data})
+		return nil
+	}
+	if a.session != nil {
+		data = a.session.push(data)
+		if !a.attached {
+			//断线期间先放在重放缓冲区里
+			return nil
+		}
+	}
+	if err := a.conn.WriteMsg(data); err != nil {
+		writeFailed.With(typ).Inc()
+		return err
+	}
+	countOut(typ, len(data))
+	return nil
+}
+
 func (a *agent) LocalAddr() net.Addr {
+	a.Lock()
+	defer a.Unlock()
 	return a.conn.LocalAddr()
 }
 
 func (a *agent) RemoteAddr() net.Addr {
+	a.Lock()
+	defer a.Unlock()
 	return a.conn.RemoteAddr()
 }
 
 func (a *agent) Close() {
-	a.conn.Close()
+	a.close(network.CloseByServer, func(conn network.Conn) {
+		conn.Close()
+	})
+}
+
+func (a *agent) Kick(code int, reason string) {
+	sessionKickTotal.With(strconv.Itoa(code)).Inc()
+	a.close(network.CloseKicked, func(conn network.Conn) {
+		conn.CloseWithCode(code, reason)
+	})
+}
+
+// close 关闭会话, 不再等待重连, 连接断开后由detach销毁, 已经断线时直接以reason销毁
+func (a *agent) close(reason network.CloseReason, closeConn func(conn network.Conn)) {
+	a.Lock()
+	a.noResume = true
+	conn, attached := a.conn, a.attached
+	a.Unlock()
+	if attached {
+		closeConn(conn)
+	} else {
+		a.destroy(reason)
+	}
 }
 
 func (a *agent) Destroy() {
-	a.conn.Close()
+	a.Close()
+}
+
+func (a *agent) ID() uint64 {
+	return a.id
+}
+
+// forward 需要转发的消息交给后端, 返回false时由Processor.Route处理
+func (a *agent) forward(msg interface{}, data []byte) bool {
+	keyer, ok := a.gate.Processor.(network.RouteKeyer)
+	if !ok || a.gate.forwarder == nil {
+		return false
+	}
+	key, forward := keyer.RouteKey(msg)
+	if !forward {
+		return false
+	}
+	hashKey := a.UserID()
+	if hashKey == "" {
+		//登录之前按会话id选择实例, Login时重新绑定
+		hashKey = strconv.FormatUint(a.id, 10)
+	}
+	if err := a.gate.forwarder.Forward(a.id, hashKey, key, data); err != nil {
+		logger.Error("forward message %v to backend error: %v", key, err)
+		forwardErrTotal.Inc()
+		a.writeError(err)
+		if a.gate.OnForwardError != nil {
+			a.gate.OnForwardError(a, err)
+		}
+	}
+	return true
+}
+
+// writeError 告诉客户端转发失败, 设置了ForwardError时由Processor编码, 否则发送frameError帧
+func (a *agent) writeError(err error) {
+	code, retryable := backend.ErrorCode(err)
+	if a.gate.ForwardError != nil {
+		a.WriteMsg(a.gate.ForwardError(code, retryable))
+		return
+	}
+	a.Lock()
+	defer a.Unlock()
+	if !a.closeFlag && a.attached {
+		a.conn.WriteMsg(errorFrame(code, retryable))
+	}
 }
 
 func (a *agent) UserData() interface{} {
@@ -0,0 +1,186 @@
+/*
+ * @Author: yujiaxun
+ * @Date: 2026-10-22 10:05:31
+ * @LastEditTime: 2026-10-22 10:05:31
+ * @Description: xxx
+ */
+
+package gate_test
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"test/gate"
+	"test/network"
+
+	"github.com/gorilla/websocket"
+)
+
+// testProcessor 消息就是[]byte, route为nil时收到的消息放进msgs
+type testProcessor struct {
+	route func(msg []byte, a gate.Agent) error
+	msgs  chan []byte
+}
+
+func newTestProcessor() *testProcessor {
+	return &testProcessor{msgs: make(chan []byte, 64)}
+}
+
+func (p *testProcessor) Route(msg interface{}, userData interface{}) error {
+	if p.route != nil {
+		return p.route(msg.([]byte), userData.(gate.Agent))
+	}
+	p.msgs <- msg.([]byte)
+	return nil
+}
+
+func (p *testProcessor) Unmarshal(data []byte) (interface{}, error) {
+	return append([]byte(nil), data...), nil
+}
+
+func (p *testProcessor) Marshal(msg interface{}) ([]byte, error) {
+	data, ok := msg.([]byte)
+	if !ok {
+		return nil, errors.New("msg is not []byte")
+	}
+	return data, nil
+}
+
+// testHooks 记录会话建立和关闭
+type testHooks struct {
+	gate.NopHooks
+	connected chan gate.Agent
+	closed    chan network.CloseReason
+}
+
+func newTestHooks() *testHooks {
+	return &testHooks{
+		connected: make(chan gate.Agent, 16),
+		closed:    make(chan network.CloseReason, 16),
+	}
+}
+
+func (h *testHooks) OnConnect(a gate.Agent) {
+	h.connected <- a
+}
+
+func (h *testHooks) OnClose(a gate.Agent, reason network.CloseReason) {
+	h.closed <- reason
+}
+
+func freeAddr(t *testing.T) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	return ln.Addr().String()
+}
+
+// startGate 在随机端口上启动网关, 测试结束时关闭
+func startGate(t *testing.T, g *gate.Gate) string {
+	g.WSAddr = freeAddr(t)
+	if g.MaxMsgLen == 0 {
+		g.MaxMsgLen = 4096
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- g.Serve(ctx)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Error(err)
+		}
+	})
+	//WSServer()不为nil时网关已经初始化完成
+	waitFor(t, func() bool { return g.WSServer() != nil })
+	return g.WSAddr
+}
+
+// dial 连接网关, query为url上的参数, 网关还没开始监听时重试
+func dial(t *testing.T, addr string, query string) *websocket.Conn {
+	url := "ws://" + addr + "/"
+	if query != "" {
+		url += "?" + query
+	}
+	var c *websocket.Conn
+	var err error
+	for i := 0; i < 100; i++ {
+		if c, _, err = websocket.DefaultDialer.Dial(url, nil); err == nil {
+			t.Cleanup(func() { c.Close() })
+			return c
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal(err)
+	return nil
+}
+
+func readMsg(t *testing.T, c *websocket.Conn) []byte {
+	t.Helper()
+	c.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, data, err := c.ReadMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// readFrame 开启断线重连时读取一个下行帧
+func readFrame(t *testing.T, c *websocket.Conn) (kind byte, seq uint64, payload []byte) {
+	t.Helper()
+	data := readMsg(t, c)
+	if len(data) < 9 {
+		t.Fatalf("short frame %v", data)
+	}
+	return data[0], binary.BigEndian.Uint64(data[1:]), data[9:]
+}
+
+func recvAgent(t *testing.T, hooks *testHooks) gate.Agent {
+	t.Helper()
+	select {
+	case a := <-hooks.connected:
+		return a
+	case <-time.After(2 * time.Second):
+		t.Fatal("no session connected")
+	}
+	return nil
+}
+
+func recvClosed(t *testing.T, hooks *testHooks) network.CloseReason {
+	t.Helper()
+	select {
+	case reason := <-hooks.closed:
+		return reason
+	case <-time.After(2 * time.Second):
+		t.Fatal("no session closed")
+	}
+	return ""
+}
+
+// waitFor 轮询直到cond返回true
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	for i := 0; i < 200; i++ {
+		if cond() {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("condition not met")
+}
+
+func TestServeTwice(t *testing.T) {
+	g := &gate.Gate{Processor: newTestProcessor()}
+	startGate(t, g)
+	if err := g.Serve(context.Background()); err != gate.ErrServed {
+		t.Fatalf("second serve: %v", err)
+	}
+}
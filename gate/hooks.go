@@ -0,0 +1,34 @@
+/*
+ * @Author: yujiaxun
+ * @Date: 2026-10-21 16:52:07
+ * @LastEditTime: 2026-10-21 16:52:07
+ * @Description: 会话生命周期的回调
+ */
+
+package gate
+
+import (
+	"test/network"
+)
+
+// Hooks 会话生命周期的回调, 设置到Gate.Hooks, 只关心部分事件时可以嵌入NopHooks
+// 开启断线重连时一个会话会先后挂上多条连接, 重连成功不会再调用OnConnect和OnClose
+type Hooks interface {
+	// 新会话建立, 在连接的http处理协程里调用, 之后才开始处理这个会话的消息
+	OnConnect(a Agent)
+	// Login成功, 被拒绝的登录不会调用
+	OnAuthenticated(a Agent, userID string)
+	// 会话关闭, reason是最后一条连接断开的原因
+	// 断线后等待重连超时时也是连接断开的原因, 断线期间被踢掉或者服务器关闭时是CloseKicked或者CloseShutdown
+	OnClose(a Agent, reason network.CloseReason)
+	// 消息无法解码或者Route返回错误, 之后连接会被关闭
+	OnError(a Agent, err error)
+}
+
+// NopHooks 什么都不做的Hooks, 嵌入后只需要实现关心的方法
+type NopHooks struct{}
+
+func (NopHooks) OnConnect(a Agent)                           {}
+func (NopHooks) OnAuthenticated(a Agent, userID string)      {}
+func (NopHooks) OnClose(a Agent, reason network.CloseReason) {}
+func (NopHooks) OnError(a Agent, err error)                  {}
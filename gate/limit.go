@@ -0,0 +1,141 @@
+/*
+ * @Author: yujiaxun
+ * @Date: 2026-10-19 13:58:40
+ * @LastEditTime: 2026-10-19 13:58:40
+ * @Description: 按消息类型限流
+ */
+
+package gate
+
+import (
+	"net"
+	"reflect"
+	"time"
+
+	"test/logger"
+	"test/network"
+
+	"github.com/gorilla/websocket"
+)
+
+// delayedMsg 按消息类型限流延后处理的消息
+type delayedMsg struct {
+	msg  interface{}
+	data []byte
+	typ  string
+	due  time.Time
+}
+
+// checkMsgLimit 按Processor给出的限制检查消息, 返回false时丢弃这条消息, wait大于0时需要延后处理
+func (a *agent) checkMsgLimit(msg interface{}, n int) (bool, time.Duration) {
+	msgLimiter, ok := a.gate.Processor.(network.MsgLimiter)
+	if !ok {
+		return true, 0
+	}
+	limit := msgLimiter.MsgLimit(msg)
+	if limit == nil {
+		return true, 0
+	}
+
+	//按消息类型保存限流状态, MsgLimit每次返回新的RateLimit时也不会重置
+	typ := msgType(msg)
+	a.Lock()
+	if a.limiters == nil {
+		a.limiters = make(map[string]*network.Limiter)
+	}
+	limiter, ok := a.limiters[typ]
+	if !ok {
+		limiter = network.NewLimiter(limit)
+		a.limiters[typ] = limiter
+	} else if old := limiter.Limit(); old != limit && (old == nil || *old != *limit) {
+		//限流配置改变了
+		limiter.SetLimit(limit)
+	}
+	a.Unlock()
+
+	result, wait := limiter.Check(n)
+	switch result {
+	case network.LimitDelay:
+		return true, wait
+	case network.LimitDiscard:
+		logger.Debug("message %v exceed rate limit, drop", reflect.TypeOf(msg))
+		return false, 0
+	case network.LimitWarn:
+		logger.Release("%v message %v exceed rate limit, warning", a.RemoteAddr(), reflect.TypeOf(msg))
+		return false, 0
+	case network.LimitKick:
+		logger.Release("%v message %v exceed rate limit, kick", a.RemoteAddr(), reflect.TypeOf(msg))
+		a.Kick(websocket.ClosePolicyViolation, "rate limit")
+		return false, 0
+	case network.LimitBanned:
+		logger.Release("%v message %v exceed rate limit, ban", a.RemoteAddr(), reflect.TypeOf(msg))
+		if ip, _, err := net.SplitHostPort(a.RemoteAddr().String()); err == nil {
+			a.gate.BanList.Ban(ip, limit.BanTime, "rate limit")
+		}
+		a.Kick(websocket.ClosePolicyViolation, "rate limit")
+		return false, 0
+	}
+	return true, 0
+}
+
+// delay wait大于0或者同类型的消息还在等待时放进delayed, 返回false时需要立即处理, 调用时需要持有dispatchMutex
+// 不在agent协程里等待, 到时间后由flushDelayed处理
+func (a *agent) delay(msg interface{}, data []byte, typ string, wait time.Duration) bool {
+	a.Lock()
+	defer a.Unlock()
+	if a.closeFlag {
+		return false
+	}
+	pending := false
+	for i := range a.delayed {
+		if a.delayed[i].typ == typ {
+			pending = true
+			break
+		}
+	}
+	if wait <= 0 && !pending {
+		return false
+	}
+	due := time.Now().Add(wait)
+	if n := len(a.delayed); n > 0 && due.Before(a.delayed[n-1].due) {
+		due = a.delayed[n-1].due
+	}
+	a.delayed = append(a.delayed, delayedMsg{msg: msg, data: data, typ: typ, due: due})
+	if a.delayTimer == nil {
+		a.delayTimer = time.AfterFunc(time.Until(a.delayed[0].due), a.flushDelayed)
+	}
+	return true
+}
+
+// flushDelayed 按顺序处理到时间的消息, 还有等待的消息时继续定时
+func (a *agent) flushDelayed() {
+	a.dispatchMutex.Lock()
+	defer a.dispatchMutex.Unlock()
+
+	a.Lock()
+	a.delayTimer = nil
+	if a.closeFlag {
+		a.Unlock()
+		return
+	}
+	now := time.Now()
+	i := 0
+	for i < len(a.delayed) && !a.delayed[i].due.After(now) {
+		i++
+	}
+	ready := a.delayed[:i]
+	a.delayed = a.delayed[i:]
+	if len(a.delayed) > 0 {
+		a.delayTimer = time.AfterFunc(a.delayed[0].due.Sub(now), a.flushDelayed)
+	}
+	conn := a.conn
+	a.Unlock()
+
+	for _, m := range ready {
+		if !a.dispatch(conn, m.msg, m.data, m.typ) {
+			//和run里处理出错一样关闭连接
+			conn.Close()
+			return
+		}
+	}
+}
@@ -0,0 +1,80 @@
+/*
+ * @Author: yujiaxun
+ * @Date: 2026-10-22 18:40:27
+ * @LastEditTime: 2026-10-22 18:40:27
+ * @Description: xxx
+ */
+
+package gate_test
+
+import (
+	"testing"
+	"time"
+
+	"test/gate"
+	"test/network"
+
+	"github.com/gorilla/websocket"
+)
+
+// limitProcessor 除了"x"之外的消息每秒最多一条, 每次返回新的RateLimit
+type limitProcessor struct {
+	*testProcessor
+	action network.LimitAction
+}
+
+func (p limitProcessor) MsgLimit(msg interface{}) *network.RateLimit {
+	if string(msg.([]byte)) == "x" {
+		return nil
+	}
+	return &network.RateLimit{MsgPerSec: 1, MsgBurst: 1, Action: p.action}
+}
+
+func TestMsgLimit(t *testing.T) {
+	p := limitProcessor{newTestProcessor(), network.ActionDrop}
+	addr := startGate(t, &gate.Gate{Processor: p})
+	c := dial(t, addr, "")
+	for _, s := range []string{"a", "b", "c", "x"} {
+		c.WriteMessage(websocket.BinaryMessage, []byte(s))
+	}
+	//同一类型的消息共用限流, 超出的丢弃
+	for _, want := range []string{"a", "x"} {
+		select {
+		case msg := <-p.msgs:
+			if string(msg) != want {
+				t.Fatalf("got %q, want %q", msg, want)
+			}
+		case <-time.After(500 * time.Millisecond):
+			t.Fatalf("message %q not routed", want)
+		}
+	}
+}
+
+func TestMsgLimitThrottle(t *testing.T) {
+	p := limitProcessor{newTestProcessor(), network.ActionThrottle}
+	addr := startGate(t, &gate.Gate{Processor: p})
+	c := dial(t, addr, "")
+	start := time.Now()
+	for _, s := range []string{"a", "b", "c"} {
+		c.WriteMessage(websocket.BinaryMessage, []byte(s))
+	}
+	//b等待一秒后处理, c超过了可以预支的令牌被丢弃
+	for _, want := range []string{"a", "b"} {
+		select {
+		case msg := <-p.msgs:
+			if string(msg) != want {
+				t.Fatalf("got %q, want %q", msg, want)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("message %q not routed", want)
+		}
+	}
+	if d := time.Since(start); d < 900*time.Millisecond {
+		t.Fatalf("b routed after %v, want delayed", d)
+	}
+	select {
+	case msg := <-p.msgs:
+		t.Fatalf("got %q, want c dropped", msg)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
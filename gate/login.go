@@ -0,0 +1,157 @@
+/*
+ * @Author: yujiaxun
+ * @Date: 2026-10-19 11:05:47
+ * @LastEditTime: 2026-10-19 11:05:47
+ * @Description: 用户和会话的绑定, 重复登录处理
+ */
+
+package gate
+
+import (
+	"errors"
+
+	"test/logger"
+)
+
+// LoginPolicy 同一个用户在多个连接上登录时的处理方式
+type LoginPolicy int
+
+const (
+	LoginKickOld    LoginPolicy = iota //踢掉旧会话, 默认
+	LoginRejectNew                     //已经登录时拒绝新会话
+	LoginAllowMulti                    //最多允许MaxUserSessions个会话, 超出时踢掉最早的
+)
+
+// LoginResult 登录事件的结果
+type LoginResult int
+
+const (
+	LoginOK       LoginResult = iota //正常登录
+	LoginKicked                      //登录成功, Kicked里的旧会话被踢掉
+	LoginRejected                    //登录被拒绝
+)
+
+// LoginEvent 每次Login都会通过Gate.OnLogin通知逻辑层
+type LoginEvent struct {
+	UserID string
+	Agent  Agent
+	Result LoginResult
+	Kicked []Agent
+}
+
+var (
+	ErrLoginRejected = errors.New("user already logged in")
+	ErrAlreadyLogin  = errors.New("agent already logged in")
+)
+
+func (a *agent) Login(userID string) error {
+	gate := a.gate
+	maxNum := 1
+	if gate.LoginPolicy == LoginAllowMulti && gate.MaxUserSessions > 0 {
+		maxNum = gate.MaxUserSessions
+	}
+
+	var kicked []*agent
+	result := LoginOK
+	gate.sessionMutex.Lock()
+	a.Lock()
+	closeFlag, oldUserID := a.closeFlag, a.userID
+	a.Unlock()
+	if closeFlag || oldUserID != "" {
+		gate.sessionMutex.Unlock()
+		if closeFlag {
+			return errors.New("agent is closed")
+		}
+		return ErrAlreadyLogin
+	}
+	agents := gate.users[userID]
+	first := len(agents) == 0
+	if len(agents) >= maxNum && gate.LoginPolicy == LoginRejectNew {
+		result = LoginRejected
+	} else {
+		if n := len(agents) - maxNum + 1; n > 0 {
+			kicked = append(kicked, agents[:n]...)
+			agents = agents[n:]
+			result = LoginKicked
+		}
+		gate.users[userID] = append(agents, a)
+		a.Lock()
+		a.userID = userID
+		//和加入gate.users在同一个临界区里标记, 并发的SendToUser排在离线消息之后
+		a.delivering = gate.Mailbox != nil
+		a.Unlock()
+	}
+	gate.sessionMutex.Unlock()
+	if first && result != LoginRejected {
+		gate.userOnline(userID)
+	}
+
+	ev := LoginEvent{UserID: userID, Agent: a, Result: result}
+	for _, old := range kicked {
+		logger.Debug("user %v login again, kick old session %v", userID, old.RemoteAddr())
+		old.Kick(KickDuplicateLogin, "login elsewhere")
+		ev.Kicked = append(ev.Kicked, old)
+	}
+	if gate.OnLogin != nil {
+		gate.OnLogin(ev)
+	}
+	if result == LoginRejected {
+		logger.Debug("user %v already logged in, reject %v", userID, a.RemoteAddr())
+		a.Kick(KickLoginRejected, "already logged in")
+		return ErrLoginRejected
+	}
+	if gate.forwarder != nil {
+		//登录之前按会话id选择的实例, 换成按用户id选择
+		gate.forwarder.SessionLogin(a.id, userID)
+	}
+	if gate.Hooks != nil {
+		gate.Hooks.OnAuthenticated(a, userID)
+	}
+	if gate.Mailbox != nil {
+		a.deliverMails(userID)
+	}
+	return nil
+}
+
+func (a *agent) UserID() string {
+	a.Lock()
+	defer a.Unlock()
+	return a.userID
+}
+
+// logout 会话关闭时解除和用户的绑定
+func (a *agent) logout() {
+	userID := a.UserID()
+	if userID == "" {
+		return
+	}
+	gate := a.gate
+	gate.sessionMutex.Lock()
+	agents := gate.users[userID]
+	for i, other := range agents {
+		if other == a {
+			agents = append(agents[:i:i], agents[i+1:]...)
+			break
+		}
+	}
+	last := len(agents) == 0 && len(gate.users[userID]) > 0
+	if len(agents) == 0 {
+		delete(gate.users, userID)
+	} else {
+		gate.users[userID] = agents
+	}
+	gate.sessionMutex.Unlock()
+	if last {
+		gate.userOffline(userID)
+	}
+}
+
+// heartbeat 收到pong, 刷新用户的在线状态
+func (a *agent) heartbeat() {
+	if a.gate.Presence == nil {
+		return
+	}
+	if userID := a.UserID(); userID != "" {
+		a.gate.Presence.Heartbeat(userID)
+	}
+}
@@ -0,0 +1,162 @@
+/*
+ * @Author: yujiaxun
+ * @Date: 2026-10-22 15:06:52
+ * @LastEditTime: 2026-10-22 15:06:52
+ * @Description: xxx
+ */
+
+package gate_test
+
+import (
+	"testing"
+	"time"
+
+	"test/gate"
+	"test/network"
+
+	"github.com/gorilla/websocket"
+)
+
+// loginGate 启动网关, 登录事件放进返回的channel
+func loginGate(t *testing.T, g *gate.Gate) (string, chan gate.LoginEvent) {
+	events := make(chan gate.LoginEvent, 16)
+	g.Processor = loginProcessor(g)
+	g.OnLogin = func(ev gate.LoginEvent) {
+		events <- ev
+	}
+	return startGate(t, g), events
+}
+
+func recvLogin(t *testing.T, events chan gate.LoginEvent) gate.LoginEvent {
+	t.Helper()
+	select {
+	case ev := <-events:
+		return ev
+	case <-time.After(2 * time.Second):
+		t.Fatal("no login event")
+	}
+	return gate.LoginEvent{}
+}
+
+// expectKicked 连接被网关以code关闭
+func expectKicked(t *testing.T, c *websocket.Conn, code int) {
+	t.Helper()
+	for {
+		c.SetReadDeadline(time.Now().Add(2 * time.Second))
+		_, _, err := c.ReadMessage()
+		if err == nil {
+			continue
+		}
+		if !websocket.IsCloseError(err, code) {
+			t.Fatalf("expect close %v, got %v", code, err)
+		}
+		return
+	}
+}
+
+func userSessions(g *gate.Gate, userID string) int {
+	n := 0
+	for _, info := range g.Sessions() {
+		if info.UserID == userID {
+			n++
+		}
+	}
+	return n
+}
+
+func TestLoginKickOld(t *testing.T) {
+	g := &gate.Gate{}
+	addr, events := loginGate(t, g)
+
+	c1 := login(t, addr, "u1")
+	if ev := recvLogin(t, events); ev.Result != gate.LoginOK || ev.UserID != "u1" {
+		t.Fatalf("first login %+v", ev)
+	}
+	login(t, addr, "u1")
+	ev := recvLogin(t, events)
+	if ev.Result != gate.LoginKicked || len(ev.Kicked) != 1 || ev.Kicked[0] == ev.Agent {
+		t.Fatalf("second login %+v", ev)
+	}
+	expectKicked(t, c1, gate.KickDuplicateLogin)
+	waitFor(t, func() bool { return len(g.Sessions()) == 1 })
+	if n := userSessions(g, "u1"); n != 1 {
+		t.Fatalf("u1 has %v sessions", n)
+	}
+}
+
+func TestLoginRejectNew(t *testing.T) {
+	g := &gate.Gate{LoginPolicy: gate.LoginRejectNew}
+	addr, events := loginGate(t, g)
+
+	c1 := login(t, addr, "u1")
+	first := recvLogin(t, events)
+	c2 := login(t, addr, "u1")
+	ev := recvLogin(t, events)
+	if ev.Result != gate.LoginRejected || len(ev.Kicked) != 0 {
+		t.Fatalf("second login %+v", ev)
+	}
+	expectKicked(t, c2, gate.KickLoginRejected)
+	waitFor(t, func() bool { return len(g.Sessions()) == 1 })
+	//旧会话不受影响
+	if first.Agent.UserID() != "u1" {
+		t.Fatal("first session is logged out")
+	}
+	if err := g.SendToUser("u1", []byte("still here")); err != nil {
+		t.Fatal(err)
+	}
+	if data := readMsg(t, c1); string(data) != "still here" {
+		t.Fatalf("got %q", data)
+	}
+}
+
+func TestLoginAllowMulti(t *testing.T) {
+	g := &gate.Gate{LoginPolicy: gate.LoginAllowMulti, MaxUserSessions: 2}
+	addr, events := loginGate(t, g)
+
+	c1 := login(t, addr, "u1")
+	first := recvLogin(t, events)
+	login(t, addr, "u1")
+	if ev := recvLogin(t, events); ev.Result != gate.LoginOK {
+		t.Fatalf("second login %+v", ev)
+	}
+	waitFor(t, func() bool { return userSessions(g, "u1") == 2 })
+
+	//超过MaxUserSessions时踢掉最早的
+	login(t, addr, "u1")
+	ev := recvLogin(t, events)
+	if ev.Result != gate.LoginKicked || len(ev.Kicked) != 1 || ev.Kicked[0] != first.Agent {
+		t.Fatalf("third login %+v", ev)
+	}
+	expectKicked(t, c1, gate.KickDuplicateLogin)
+	waitFor(t, func() bool { return len(g.Sessions()) == 2 })
+	if n := userSessions(g, "u1"); n != 2 {
+		t.Fatalf("u1 has %v sessions", n)
+	}
+}
+
+func TestLoginKickDetached(t *testing.T) {
+	hooks := newTestHooks()
+	g := &gate.Gate{ResumeWait: 5 * time.Second, Hooks: hooks}
+	addr, events := loginGate(t, g)
+
+	c1, _, _ := newSession(t, addr, hooks)
+	c1.WriteMessage(websocket.BinaryMessage, append([]byte{frameData}, "login:u1"...))
+	recvLogin(t, events)
+	c1.Close()
+	waitFor(t, detached(g))
+
+	//旧会话断线等待重连时也要踢掉, 不用等ResumeWait
+	c2, _, _ := newSession(t, addr, hooks)
+	c2.WriteMessage(websocket.BinaryMessage, append([]byte{frameData}, "login:u1"...))
+	ev := recvLogin(t, events)
+	if ev.Result != gate.LoginKicked || len(ev.Kicked) != 1 {
+		t.Fatalf("second login %+v", ev)
+	}
+	if reason := recvClosed(t, hooks); reason != network.CloseKicked {
+		t.Fatalf("old session closed by %v", reason)
+	}
+	waitFor(t, func() bool { return len(g.Sessions()) == 1 })
+	if n := userSessions(g, "u1"); n != 1 {
+		t.Fatalf("u1 has %v sessions", n)
+	}
+}
@@ -0,0 +1,86 @@
+/*
+ * @Author: yujiaxun
+ * @Date: 2026-10-20 11:34:47
+ * @LastEditTime: 2026-10-20 11:34:47
+ * @Description: 用户登录后投递离线消息
+ */
+
+package gate
+
+import (
+	"errors"
+
+	"test/logger"
+)
+
+// 离线消息等客户端确认后才从邮箱删除, 确认依赖会话保持
+var ErrMailboxNoSession = errors.New("mailbox needs ResumeWait > 0")
+
+// mailAck 离线消息在会话里的序号, 客户端确认到seq时从邮箱删除id及之前的消息
+type mailAck struct {
+	seq uint64
+	id  uint64
+}
+
+// deferredMsg 投递离线消息期间发给会话的消息
+type deferredMsg struct {
+	typ  string
+	data []byte
+}
+
+// deliverMails 按顺序投递离线消息, 然后发送投递期间write的消息
+// 客户端确认后才从邮箱删除, 没确认的消息下次登录时重新投递
+func (a *agent) deliverMails(userID string) {
+	mails := a.gate.Mailbox.Pending(userID)
+	a.Lock()
+	defer a.Unlock()
+	deferred := a.deferred
+	a.delivering = false
+	a.deferred = nil
+	if a.closeFlag {
+		return
+	}
+	for _, mail := range mails {
+		frame := a.session.push(mail.Data)
+		a.mailAcks = append(a.mailAcks, mailAck{seq: a.session.seq, id: mail.ID})
+		if a.attached {
+			a.conn.WriteMsg(frame)
+		}
+	}
+	for _, msg := range deferred {
+		frame := a.session.push(msg.data)
+		if !a.attached {
+			continue
+		}
+		if err := a.conn.WriteMsg(frame); err != nil {
+			writeFailed.With(msg.typ).Inc()
+			logger.Debug("send to user %v error: %v", userID, err)
+			continue
+		}
+		countOut(msg.typ, len(frame))
+	}
+}
+
+// ackMails 客户端确认到seq, 返回可以从邮箱删除的最大id, 调用时需要持有锁
+func (a *agent) ackMails(seq uint64) uint64 {
+	var id uint64
+	n := 0
+	for n < len(a.mailAcks) && a.mailAcks[n].seq <= seq {
+		id = a.mailAcks[n].id
+		n++
+	}
+	a.mailAcks = a.mailAcks[n:]
+	return id
+}
+
+// storeMail 用户不在线时放进邮箱, 没有设置Mailbox时返回false
+func (gate *Gate) storeMail(userID string, data []byte) bool {
+	if gate.Mailbox == nil {
+		return false
+	}
+	if _, err := gate.Mailbox.Put(userID, data); err != nil {
+		logger.Error("store mail of user %v error: %v", userID, err)
+		return false
+	}
+	return true
+}
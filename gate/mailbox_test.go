@@ -0,0 +1,71 @@
+/*
+ * @Author: yujiaxun
+ * @Date: 2026-10-22 14:02:37
+ * @LastEditTime: 2026-10-22 14:02:37
+ * @Description: xxx
+ */
+
+package gate_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"test/gate"
+	"test/mailbox"
+
+	"github.com/gorilla/websocket"
+)
+
+func openMailbox(t *testing.T) *mailbox.Mailbox {
+	mb := &mailbox.Mailbox{File: filepath.Join(t.TempDir(), "mailbox.log")}
+	if err := mb.Open(); err != nil {
+		t.Fatal(err)
+	}
+	return mb
+}
+
+func TestMailboxDeliver(t *testing.T) {
+	mb := openMailbox(t)
+	g := &gate.Gate{ResumeWait: 5 * time.Second, ReplayBufferNum: 16, Mailbox: mb}
+	g.Processor = loginProcessor(g)
+	addr := startGate(t, g)
+
+	for _, s := range []string{"m1", "m2"} {
+		if err := g.SendToUser("u1", []byte(s)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	c := dial(t, addr, "")
+	readFrame(t, c)
+	c.WriteMessage(websocket.BinaryMessage, append([]byte{frameData}, "login:u1"...))
+	waitFor(t, func() bool { return len(g.Locate("u1")) == 1 })
+	if err := g.SendToUser("u1", []byte("m3")); err != nil {
+		t.Fatal(err)
+	}
+	//离线消息在登录后的消息之前
+	for i, want := range []string{"m1", "m2", "m3"} {
+		kind, seq, payload := readFrame(t, c)
+		if kind != frameData || seq != uint64(i+1) || string(payload) != want {
+			t.Fatalf("got kind %v seq %v %q, want %q", kind, seq, payload, want)
+		}
+	}
+
+	//客户端确认之前不从邮箱删除
+	if n := mb.Count("u1"); n != 2 {
+		t.Fatalf("mailbox count %v before ack", n)
+	}
+	writeAck(c, 1)
+	waitFor(t, func() bool { return mb.Count("u1") == 1 })
+	writeAck(c, 3)
+	waitFor(t, func() bool { return mb.Count("u1") == 0 })
+}
+
+func TestMailboxNeedsResume(t *testing.T) {
+	g := &gate.Gate{WSAddr: freeAddr(t), Mailbox: openMailbox(t), Processor: newTestProcessor()}
+	if err := g.Serve(context.Background()); err != gate.ErrMailboxNoSession {
+		t.Fatalf("serve error %v", err)
+	}
+}
@@ -0,0 +1,51 @@
+/*
+ * @Author: yujiaxun
+ * @Date: 2026-10-20 16:55:31
+ * @LastEditTime: 2026-10-20 16:55:31
+ * @Description: 会话层的监控指标
+ */
+
+package gate
+
+import (
+	"reflect"
+	"strings"
+
+	"test/metrics"
+)
+
+// 从后端和其他节点转发来的消息已经编码好, 不知道消息类型
+const (
+	typeBackend = "backend"
+	typeCluster = "cluster"
+)
+
+var (
+	sessionCurrent     = metrics.Default.Gauge("gate_sessions", "Current sessions, including detached ones waiting for resume.").With()
+	msgTotal           = metrics.Default.Counter("gate_messages_total", "Messages by direction and type.", "dir", "type")
+	bytesTotal         = metrics.Default.Counter("gate_message_bytes_total", "Message bytes by direction and type.", "dir", "type")
+	routeDuration      = metrics.Default.Histogram("gate_route_duration_seconds", "Processor.Route latency.", nil, "type")
+	writeFailed        = metrics.Default.Counter("gate_write_failed_total", "Messages that could not be queued to the connection.", "type")
+	retransmitTotal    = metrics.Default.Counter("gate_reliable_retransmits_total", "Reliable messages sent again after ack timeout.").With()
+	forwardErrTotal    = metrics.Default.Counter("gate_forward_errors_total", "Messages that could not be forwarded to a backend.").With()
+	sessionKickTotal   = metrics.Default.Counter("gate_kicks_total", "Sessions kicked by close code.", "code")
+	sessionClosedTotal = metrics.Default.Counter("gate_sessions_closed_total", "Closed sessions by reason.", "reason")
+)
+
+// msgType 消息类型的名字, 用作指标的标签
+func msgType(msg interface{}) string {
+	if msg == nil {
+		return "nil"
+	}
+	return strings.TrimPrefix(reflect.TypeOf(msg).String(), "*")
+}
+
+func countIn(typ string, n int) {
+	msgTotal.With("in", typ).Inc()
+	bytesTotal.With("in", typ).Add(float64(n))
+}
+
+func countOut(typ string, n int) {
+	msgTotal.With("out", typ).Inc()
+	bytesTotal.With("out", typ).Add(float64(n))
+}
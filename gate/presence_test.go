@@ -0,0 +1,35 @@
+/*
+ * @Author: yujiaxun
+ * @Date: 2026-10-22 19:40:18
+ * @LastEditTime: 2026-10-22 19:40:18
+ * @Description: xxx
+ */
+
+package gate_test
+
+import (
+	"testing"
+	"time"
+
+	"test/gate"
+	"test/presence"
+)
+
+func TestPresenceTTL(t *testing.T) {
+	tests := []struct {
+		pongWait time.Duration
+		ttl      time.Duration
+		want     time.Duration
+	}{
+		{time.Second, 10 * time.Millisecond, 2 * time.Second},
+		{time.Second, time.Minute, time.Minute},
+		{0, 90 * time.Second, 2 * time.Minute}, //PongWait默认60秒
+	}
+	for _, tt := range tests {
+		g := &gate.Gate{PongWait: tt.pongWait, Presence: presence.NewService(nil, tt.ttl)}
+		startGate(t, g)
+		if g.Presence.TTL != tt.want {
+			t.Fatalf("PongWait %v TTL %v reset to %v, want %v", tt.pongWait, tt.ttl, g.Presence.TTL, tt.want)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+/*
+ * @Author: yujiaxun
+ * @Date: 2026-10-20 13:20:05
+ * @LastEditTime: 2026-10-20 13:20:05
+ * @Description: 至少送达一次的下行消息
+ */
+
+package gate
+
+import (
+	"errors"
+	"time"
+
+	"test/logger"
+)
+
+// 可靠消息和普通消息一样带seq下发, 客户端按seq去重, 确认之前超时会重发同一个帧
+// 会话关闭时还没确认的消息放进Mailbox, 用户下次登录时再投递
+var ErrNoSession = errors.New("reliable message needs ResumeWait > 0")
+
+type unackedFrame struct {
+	seq    uint64
+	data   []byte //Processor编码好的消息, 会话关闭时放进邮箱
+	frame  []byte
+	sentAt time.Time
+}
+
+// WriteReliable 发送需要客户端确认的消息, 返回消息的seq
+func (a *agent) WriteReliable(msg interface{}) (uint64, error) {
+	data, err := a.gate.marshal(msg)
+	if err != nil {
+		return 0, err
+	}
+	a.Lock()
+	defer a.Unlock()
+	if a.closeFlag {
+		return 0, errors.New("agent is closed")
+	}
+	if a.session == nil {
+		return 0, ErrNoSession
+	}
+	frame := a.session.push(data)
+	a.unacked = append(a.unacked, unackedFrame{seq: a.session.seq, data: data, frame: frame, sentAt: time.Now()})
+	if a.attached {
+		if err := a.conn.WriteMsg(frame); err != nil {
+			logger.Debug("write reliable message %v error: %v, retry later", a.session.seq, err)
+		} else {
+			countOut(msgType(msg), len(frame))
+		}
+	}
+	if a.attached && a.retryTimer == nil {
+		a.retryTimer = time.AfterFunc(a.gate.AckTimeout, a.retransmit)
+	}
+	return a.session.seq, nil
+}
+
+// Unacked 还没有被客户端确认的可靠消息数
+func (a *agent) Unacked() int {
+	a.Lock()
+	defer a.Unlock()
+	return len(a.unacked)
+}
+
+// ackReliable 客户端确认到seq, 调用时需要持有锁
+func (a *agent) ackReliable(seq uint64) {
+	n := 0
+	for n < len(a.unacked) && a.unacked[n].seq <= seq {
+		n++
+	}
+	a.unacked = a.unacked[n:]
+}
+
+// retransmit 重发超过AckTimeout没有确认的消息, 在锁里取出要重发的帧, 释放锁之后再写
+// 断线时定时器已经停掉, 重连时由attach重放并重新开始计时
+func (a *agent) retransmit() {
+	a.Lock()
+	a.retryTimer = nil
+	if a.closeFlag || !a.attached || len(a.unacked) == 0 {
+		a.Unlock()
+		return
+	}
+	conn := a.conn
+	now := time.Now()
+	var frames []unackedFrame
+	for i := range a.unacked {
+		f := &a.unacked[i]
+		if now.Sub(f.sentAt) < a.gate.AckTimeout {
+			break
+		}
+		f.sentAt = now
+		frames = append(frames, *f)
+	}
+	a.retryTimer = time.AfterFunc(a.gate.AckTimeout, a.retransmit)
+	a.Unlock()
+
+	for _, f := range frames {
+		if err := conn.WriteMsg(f.frame); err != nil {
+			logger.Debug("retransmit message %v error: %v", f.seq, err)
+			break
+		}
+		retransmitTotal.Inc()
+	}
+}
+
+// stopRetransmit 断线时停止重发, 调用时需要持有锁
+func (a *agent) stopRetransmit() {
+	if a.retryTimer != nil {
+		a.retryTimer.Stop()
+		a.retryTimer = nil
+	}
+}
+
+// restartRetransmit 重连后重放已经发出了没确认的消息, 从现在开始重新计时, 调用时需要持有锁
+func (a *agent) restartRetransmit() {
+	if len(a.unacked) == 0 || a.retryTimer != nil {
+		return
+	}
+	now := time.Now()
+	for i := range a.unacked {
+		a.unacked[i].sentAt = now
+	}
+	a.retryTimer = time.AfterFunc(a.gate.AckTimeout, a.retransmit)
+}
+
+// saveUnacked 会话关闭时把没确认的消息放进邮箱, 没有登录或者没有设置Mailbox时丢弃
+func (a *agent) saveUnacked() {
+	a.Lock()
+	unacked, userID := a.unacked, a.userID
+	a.unacked = nil
+	a.stopRetransmit()
+	a.Unlock()
+	if len(unacked) == 0 {
+		return
+	}
+	if userID == "" || a.gate.Mailbox == nil {
+		logger.Error("session %v closed with %v unacked messages", a.id, len(unacked))
+		return
+	}
+	for _, f := range unacked {
+		a.gate.storeMail(userID, f.data)
+	}
+}
+
+// Unacked 所有会话还没有确认的可靠消息数
+func (gate *Gate) Unacked() int {
+	n := 0
+	for _, a := range gate.allSessions() {
+		n += a.Unacked()
+	}
+	return n
+}
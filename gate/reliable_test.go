@@ -0,0 +1,64 @@
+/*
+ * @Author: yujiaxun
+ * @Date: 2026-10-22 15:41:09
+ * @LastEditTime: 2026-10-22 15:41:09
+ * @Description: xxx
+ */
+
+package gate_test
+
+import (
+	"testing"
+	"time"
+
+	"test/gate"
+)
+
+func TestReliableRetransmit(t *testing.T) {
+	hooks := newTestHooks()
+	g := &gate.Gate{ResumeWait: 5 * time.Second, AckTimeout: 100 * time.Millisecond, Processor: newTestProcessor(), Hooks: hooks}
+	addr := startGate(t, g)
+
+	c, a, _ := newSession(t, addr, hooks)
+	seq, err := a.WriteReliable([]byte{1})
+	if err != nil || seq != 1 {
+		t.Fatalf("write reliable seq %v err %v", seq, err)
+	}
+	expectData(t, c, 1)
+	//超过AckTimeout没有确认时重发同一个帧
+	start := time.Now()
+	expectData(t, c, 1)
+	if d := time.Since(start); d < 50*time.Millisecond {
+		t.Fatalf("retransmit after %v", d)
+	}
+	if n := a.Unacked(); n != 1 {
+		t.Fatalf("unacked %v", n)
+	}
+
+	writeAck(c, 1)
+	waitFor(t, func() bool { return a.Unacked() == 0 })
+	//确认之后不再重发, 下一帧是新消息
+	time.Sleep(250 * time.Millisecond)
+	a.WriteMsg([]byte{2})
+	expectData(t, c, 2)
+}
+
+func TestReliableDetached(t *testing.T) {
+	hooks := newTestHooks()
+	g := &gate.Gate{ResumeWait: 5 * time.Second, AckTimeout: 100 * time.Millisecond, Processor: newTestProcessor(), Hooks: hooks}
+	addr := startGate(t, g)
+
+	c, a, token := newSession(t, addr, hooks)
+	a.WriteReliable([]byte{1})
+	expectData(t, c, 1)
+	c.Close()
+	waitFor(t, detached(g))
+	time.Sleep(250 * time.Millisecond)
+
+	//重连时重放没确认的消息, 之后继续超时重发
+	c, _, _ = resume(t, addr, token, 0)
+	expectData(t, c, 1)
+	expectData(t, c, 1)
+	writeAck(c, 1)
+	waitFor(t, func() bool { return a.Unacked() == 0 })
+}
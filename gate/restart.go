@@ -0,0 +1,41 @@
+/*
+ * @Author: yujiaxun
+ * @Date: 2026-10-20 22:08:37
+ * @LastEditTime: 2026-10-20 22:08:37
+ * @Description: 热重启, 监听交给新进程之后排空旧进程
+ */
+
+package gate
+
+import (
+	"net"
+
+	"test/logger"
+	"test/restart"
+)
+
+func (gate *Gate) listen(addr string) (net.Listener, error) {
+	if gate.HotRestart {
+		return restart.Listen("tcp", addr)
+	}
+	return net.Listen("tcp", addr)
+}
+
+// hotRestart 收到SIGUSR2, 把监听交给新进程, 成功后停止接受新连接并排空, 返回true时Run退出
+func (gate *Gate) hotRestart() bool {
+	logger.Release("receive restart signal")
+	proc, err := restart.Restart(gate.RestartTimeout)
+	if err != nil {
+		logger.Error("hot restart error: %v", err)
+		return false
+	}
+	logger.Release("listeners handed over to process %v, start draining", proc.Pid)
+	if wsServer := gate.WSServer(); wsServer != nil {
+		wsServer.StopAccept()
+	}
+	if gate.adminServer != nil {
+		gate.adminServer.Close()
+	}
+	gate.Drain()
+	return true
+}
@@ -0,0 +1,149 @@
+/*
+ * @Author: yujiaxun
+ * @Date: 2026-10-19 10:12:31
+ * @LastEditTime: 2026-10-19 10:12:31
+ * @Description: 断线重连的会话保持和消息重放
+ */
+
+package gate
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"strconv"
+)
+
+// 开启会话保持(ResumeWait > 0)后, 客户端和网关之间的每一帧都带上帧头
+// 下行: kind(1字节) + seq(8字节) + payload
+// 上行: kind(1字节) + payload
+// 客户端重连时在url上带上 token 和最后收到的 seq, 例如 /?token=xxx&seq=10
+const (
+	frameData    byte = 0 //普通消息
+	frameSession byte = 1 //下行: 会话信息, seq为当前最大序号, payload为token
+	frameError   byte = 2 //下行: 转发失败, seq为0, payload为错误码(2字节) + 是否可以重试(1字节), 不会重放
+	frameAck     byte = 3 //上行: 确认收到, payload为8字节的seq
+
+	frameHeadLen = 9
+)
+
+const (
+	resumeTokenKey = "token"
+	resumeSeqKey   = "seq"
+)
+
+var errBadFrame = errors.New("bad frame")
+
+type replayFrame struct {
+	seq  uint64
+	data []byte //已经编码好的帧
+}
+
+// session 保存一个逻辑会话的序号和重放缓冲区, 由agent的锁保护
+type session struct {
+	token  string
+	seq    uint64        //最后一条下行消息的序号
+	buffer []replayFrame //按seq递增, 最多保存maxNum条
+	maxNum int
+}
+
+func newSession(maxNum int) *session {
+	if maxNum <= 0 {
+		maxNum = 1
+	}
+	s := new(session)
+	s.token = genToken()
+	s.maxNum = maxNum
+	return s
+}
+
+func genToken() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+func encodeFrame(kind byte, seq uint64, payload []byte) []byte {
+	frame := make([]byte, frameHeadLen+len(payload))
+	frame[0] = kind
+	binary.BigEndian.PutUint64(frame[1:], seq)
+	copy(frame[frameHeadLen:], payload)
+	return frame
+}
+
+// push 给消息分配序号并放入重放缓冲区, 返回编码好的帧
+func (s *session) push(data []byte) []byte {
+	s.seq++
+	frame := encodeFrame(frameData, s.seq, data)
+	if len(s.buffer) >= s.maxNum {
+		s.buffer = s.buffer[1:]
+	}
+	s.buffer = append(s.buffer, replayFrame{seq: s.seq, data: frame})
+	return frame
+}
+
+// ack 客户端已经收到seq及之前的消息, 不再需要重放
+func (s *session) ack(seq uint64) {
+	i := 0
+	for i < len(s.buffer) && s.buffer[i].seq <= seq {
+		i++
+	}
+	s.buffer = s.buffer[i:]
+}
+
+// replay 返回seq之后的所有帧, 缓冲区里已经丢掉的消息无法重放时ok为false
+func (s *session) replay(seq uint64) (frames [][]byte, ok bool) {
+	if seq > s.seq {
+		return nil, false
+	}
+	if seq < s.seq {
+		if len(s.buffer) == 0 || s.buffer[0].seq > seq+1 {
+			return nil, false
+		}
+	}
+	for _, f := range s.buffer {
+		if f.seq > seq {
+			frames = append(frames, f.data)
+		}
+	}
+	return frames, true
+}
+
+func (s *session) sessionFrame() []byte {
+	return encodeFrame(frameSession, s.seq, []byte(s.token))
+}
+
+func errorFrame(code int, retryable bool) []byte {
+	payload := make([]byte, 3)
+	binary.BigEndian.PutUint16(payload, uint16(code))
+	if retryable {
+		payload[2] = 1
+	}
+	return encodeFrame(frameError, 0, payload)
+}
+
+// decodeFrame 解析上行帧
+func decodeFrame(frame []byte) (kind byte, payload []byte, err error) {
+	if len(frame) < 1 {
+		return 0, nil, errBadFrame
+	}
+	kind = frame[0]
+	payload = frame[1:]
+	switch kind {
+	case frameData:
+	case frameAck:
+		if len(payload) != 8 {
+			return 0, nil, errBadFrame
+		}
+	default:
+		return 0, nil, errBadFrame
+	}
+	return kind, payload, nil
+}
+
+func parseSeq(s string) (uint64, error) {
+	return strconv.ParseUint(s, 10, 64)
+}
@@ -0,0 +1,174 @@
+/*
+ * @Author: yujiaxun
+ * @Date: 2026-10-22 10:21:47
+ * @LastEditTime: 2026-10-22 10:21:47
+ * @Description: xxx
+ */
+
+package gate_test
+
+import (
+	"encoding/binary"
+	"fmt"
+	"testing"
+	"time"
+
+	"test/gate"
+	"test/network"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	frameData    = 0
+	frameSession = 1
+	frameAck     = 3
+)
+
+// newSession 建立一个会话, 返回token
+func newSession(t *testing.T, addr string, hooks *testHooks) (*websocket.Conn, gate.Agent, string) {
+	c := dial(t, addr, "")
+	kind, seq, token := readFrame(t, c)
+	if kind != frameSession || seq != 0 {
+		t.Fatalf("first frame kind %v seq %v", kind, seq)
+	}
+	return c, recvAgent(t, hooks), string(token)
+}
+
+func resume(t *testing.T, addr string, token string, seq uint64) (*websocket.Conn, string, uint64) {
+	c := dial(t, addr, fmt.Sprintf("token=%v&seq=%v", token, seq))
+	kind, lastSeq, newToken := readFrame(t, c)
+	if kind != frameSession {
+		t.Fatalf("first frame kind %v", kind)
+	}
+	return c, string(newToken), lastSeq
+}
+
+func expectData(t *testing.T, c *websocket.Conn, seq uint64) {
+	t.Helper()
+	kind, got, payload := readFrame(t, c)
+	if kind != frameData || got != seq || payload[0] != byte(seq) {
+		t.Fatalf("got kind %v seq %v payload %v, want seq %v", kind, got, payload, seq)
+	}
+}
+
+// writeAck 确认seq及之前的下行消息
+func writeAck(c *websocket.Conn, seq uint64) {
+	ack := make([]byte, 9)
+	ack[0] = frameAck
+	binary.BigEndian.PutUint64(ack[1:], seq)
+	c.WriteMessage(websocket.BinaryMessage, ack)
+}
+
+func detached(g *gate.Gate) func() bool {
+	return func() bool {
+		sessions := g.Sessions()
+		return len(sessions) == 1 && !sessions[0].Attached
+	}
+}
+
+func TestSessionReplay(t *testing.T) {
+	hooks := newTestHooks()
+	g := &gate.Gate{ResumeWait: 5 * time.Second, ReplayBufferNum: 8, Processor: newTestProcessor(), Hooks: hooks}
+	addr := startGate(t, g)
+
+	c, a, token := newSession(t, addr, hooks)
+	for i := 1; i <= 3; i++ {
+		a.WriteMsg([]byte{byte(i)})
+		expectData(t, c, uint64(i))
+	}
+	c.Close()
+	waitFor(t, detached(g))
+	//断线期间的消息放在重放缓冲区里
+	a.WriteMsg([]byte{4})
+
+	c, newToken, lastSeq := resume(t, addr, token, 2)
+	if newToken != token || lastSeq != 4 {
+		t.Fatalf("resume token %v seq %v", newToken, lastSeq)
+	}
+	expectData(t, c, 3)
+	expectData(t, c, 4)
+	a.WriteMsg([]byte{5})
+	expectData(t, c, 5)
+	select {
+	case <-hooks.connected:
+		t.Fatal("resume should not create a new session")
+	default:
+	}
+}
+
+func TestSessionReplayOutOfBuffer(t *testing.T) {
+	hooks := newTestHooks()
+	g := &gate.Gate{ResumeWait: 5 * time.Second, ReplayBufferNum: 2, Processor: newTestProcessor(), Hooks: hooks}
+	addr := startGate(t, g)
+
+	c, a, token := newSession(t, addr, hooks)
+	for i := 1; i <= 4; i++ {
+		a.WriteMsg([]byte{byte(i)})
+		expectData(t, c, uint64(i))
+	}
+	c.Close()
+	waitFor(t, detached(g))
+
+	//缓冲区里只剩3和4, 从1之后重放缺了2
+	_, newToken, lastSeq := resume(t, addr, token, 1)
+	if newToken == token || lastSeq != 0 {
+		t.Fatalf("resume out of buffer should start a new session, token %v seq %v", newToken, lastSeq)
+	}
+	if reason := recvClosed(t, hooks); reason != network.CloseReadError {
+		t.Fatalf("old session close reason %v", reason)
+	}
+	recvAgent(t, hooks)
+}
+
+func TestSessionAck(t *testing.T) {
+	hooks := newTestHooks()
+	p := newTestProcessor()
+	g := &gate.Gate{ResumeWait: 5 * time.Second, ReplayBufferNum: 8, Processor: p, Hooks: hooks}
+	addr := startGate(t, g)
+
+	c, a, token := newSession(t, addr, hooks)
+	for i := 1; i <= 3; i++ {
+		a.WriteMsg([]byte{byte(i)})
+		expectData(t, c, uint64(i))
+	}
+	writeAck(c, 2)
+	//上行消息按顺序处理, 收到后面的消息说明ack已经处理完
+	c.WriteMessage(websocket.BinaryMessage, []byte{frameData, 'x'})
+	select {
+	case <-p.msgs:
+	case <-time.After(2 * time.Second):
+		t.Fatal("message not routed")
+	}
+	c.Close()
+	waitFor(t, detached(g))
+
+	//1和2已经确认并从缓冲区删除, 不能再从1之后重放
+	_, newToken, _ := resume(t, addr, token, 1)
+	if newToken == token {
+		t.Fatal("acked frames should not be replayed")
+	}
+}
+
+func TestSessionResumeTimeout(t *testing.T) {
+	hooks := newTestHooks()
+	g := &gate.Gate{ResumeWait: 100 * time.Millisecond, ReplayBufferNum: 8, Processor: newTestProcessor(), Hooks: hooks}
+	addr := startGate(t, g)
+
+	c, _, token := newSession(t, addr, hooks)
+	c.Close()
+	start := time.Now()
+	if reason := recvClosed(t, hooks); reason != network.CloseReadError {
+		t.Fatalf("close reason %v", reason)
+	}
+	if d := time.Since(start); d < 100*time.Millisecond {
+		t.Fatalf("session closed after %v, before ResumeWait", d)
+	}
+	if n := len(g.Sessions()); n != 0 {
+		t.Fatalf("%v sessions after expiry", n)
+	}
+	_, newToken, _ := resume(t, addr, token, 0)
+	if newToken == token {
+		t.Fatal("expired session should not be resumed")
+	}
+}
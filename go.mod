@@ -2,7 +2,10 @@ module test
 
 go 1.18
 
-require github.com/vmihailenco/msgpack v4.0.4+incompatible
+require (
+	github.com/BurntSushi/toml v1.5.0
+	github.com/vmihailenco/msgpack v4.0.4+incompatible
+)
 
 require (
 	github.com/gabriel-vasile/mimetype v1.4.2 // indirect
@@ -21,4 +24,5 @@ require (
 	github.com/gorilla/websocket v1.5.1
 	google.golang.org/appengine v1.6.8 // indirect
 	google.golang.org/protobuf v1.26.0 // indirect
+	gopkg.in/yaml.v3 v3.0.1
 )
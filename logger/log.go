@@ -14,6 +14,7 @@ import (
 	"os"
 	"path"
 	"strings"
+	"sync/atomic"
 	"time"
 )
 
@@ -32,26 +33,28 @@ const (
 	printFatalLevel   = "[fatal  ] "
 )
 
+var levelNames = []string{"debug", "release", "error", "fatal"}
+
 type Logger struct {
-	level      int
+	level      int32 //运行时可以修改, 用atomic读写
 	baseLogger *log.Logger
 	baseFile   *os.File
 }
 
+func parseLevel(strLevel string) (int32, error) {
+	for level, name := range levelNames {
+		if strings.ToLower(strLevel) == name {
+			return int32(level), nil
+		}
+	}
+	return 0, errors.New("unknown level: " + strLevel)
+}
+
 func New(strLevel string, pathname string, flag int) (*Logger, error) {
 	// level
-	var level int
-	switch strings.ToLower(strLevel) {
-	case "debug":
-		level = debugLevel
-	case "release":
-		level = releaseLevel
-	case "error":
-		level = errorLevel
-	case "fatal":
-		level = fatalLevel
-	default:
-		return nil, errors.New("unknown level: " + strLevel)
+	level, err := parseLevel(strLevel)
+	if err != nil {
+		return nil, err
 	}
 
 	// logger
@@ -97,8 +100,22 @@ func (logger *Logger) Close() {
 	logger.baseFile = nil
 }
 
-func (logger *Logger) doPrintf(level int, printLevel string, format string, a ...interface{}) {
-	if level < logger.level {
+// SetLevel 运行时修改日志级别
+func (logger *Logger) SetLevel(strLevel string) error {
+	level, err := parseLevel(strLevel)
+	if err != nil {
+		return err
+	}
+	atomic.StoreInt32(&logger.level, level)
+	return nil
+}
+
+func (logger *Logger) Level() string {
+	return levelNames[atomic.LoadInt32(&logger.level)]
+}
+
+func (logger *Logger) doPrintf(level int32, printLevel string, format string, a ...interface{}) {
+	if level < atomic.LoadInt32(&logger.level) {
 		return
 	}
 	if logger.baseLogger == nil {
@@ -138,6 +155,14 @@ func Export(logger *Logger) {
 	}
 }
 
+func SetLevel(strLevel string) error {
+	return gLogger.SetLevel(strLevel)
+}
+
+func Level() string {
+	return gLogger.Level()
+}
+
 func Debug(format string, a ...interface{}) {
 	gLogger.doPrintf(debugLevel, printDebugLevel, format, a...)
 }
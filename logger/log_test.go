@@ -35,3 +35,18 @@ func TestExample(t *testing.T) {
 	logger.Debug("will not print")
 	logger.Release("My name is %v", name)
 }
+
+func TestSetLevel(t *testing.T) {
+	newLogger, err := logger.New("debug", "", l.LstdFlags)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer newLogger.Close()
+	if err := newLogger.SetLevel("error"); err != nil || newLogger.Level() != "error" {
+		t.Fatalf("got level %v %v, want error", newLogger.Level(), err)
+	}
+	if err := newLogger.SetLevel("verbose"); err == nil || newLogger.Level() != "error" {
+		t.Fatalf("set unknown level got %v, level %v", err, newLogger.Level())
+	}
+	newLogger.Release("will not print")
+}
@@ -0,0 +1,85 @@
+/*
+ * @Author: yujiaxun
+ * @Date: 2026-10-20 10:40:26
+ * @LastEditTime: 2026-10-20 10:40:26
+ * @Description: 邮箱的追加写日志
+ */
+
+package mailbox
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"time"
+)
+
+// 日志里的每条记录
+// ------------------------------------------------------------------------------------------------------
+// | op(1) | len(user)(2) | user | id(8) | time(8) | len(data)(4) | data | crc32(4), 校验前面所有字节 |
+// ------------------------------------------------------------------------------------------------------
+const (
+	opPut byte = 1 //新消息
+	opAck byte = 2 //确认id及之前的消息
+)
+
+const recordHeadLen = 1 + 2 + 8 + 8 + 4
+
+var errBadRecord = errors.New("bad mailbox record")
+
+type record struct {
+	op     byte
+	userID string
+	id     uint64
+	time   time.Time
+	data   []byte
+}
+
+func encodeRecord(r *record) []byte {
+	b := make([]byte, recordHeadLen+len(r.userID)+len(r.data)+4)
+	b[0] = r.op
+	binary.BigEndian.PutUint16(b[1:], uint16(len(r.userID)))
+	i := 3 + copy(b[3:], r.userID)
+	binary.BigEndian.PutUint64(b[i:], r.id)
+	binary.BigEndian.PutUint64(b[i+8:], uint64(r.time.UnixNano()))
+	binary.BigEndian.PutUint32(b[i+16:], uint32(len(r.data)))
+	i += 20 + copy(b[i+20:], r.data)
+	binary.BigEndian.PutUint32(b[i:], crc32.ChecksumIEEE(b[:i]))
+	return b
+}
+
+// readRecord 读一条记录, 返回记录占用的字节数
+// 文件末尾写了一半的记录返回io.ErrUnexpectedEOF或errBadRecord
+func readRecord(r *bufio.Reader) (*record, int, error) {
+	head := make([]byte, 3)
+	if _, err := io.ReadFull(r, head); err != nil {
+		return nil, 0, err
+	}
+	userLen := int(binary.BigEndian.Uint16(head[1:]))
+	rest := make([]byte, userLen+20)
+	if _, err := io.ReadFull(r, rest); err != nil {
+		return nil, 0, io.ErrUnexpectedEOF
+	}
+	dataLen := int(binary.BigEndian.Uint32(rest[userLen+16:]))
+	if dataLen > 64*1024*1024 {
+		return nil, 0, errBadRecord
+	}
+	tail := make([]byte, dataLen+4)
+	if _, err := io.ReadFull(r, tail); err != nil {
+		return nil, 0, io.ErrUnexpectedEOF
+	}
+	b := append(append(head, rest...), tail...)
+	n := len(b)
+	if crc32.ChecksumIEEE(b[:n-4]) != binary.BigEndian.Uint32(b[n-4:]) {
+		return nil, 0, errBadRecord
+	}
+	rec := new(record)
+	rec.op = head[0]
+	rec.userID = string(rest[:userLen])
+	rec.id = binary.BigEndian.Uint64(rest[userLen:])
+	rec.time = time.Unix(0, int64(binary.BigEndian.Uint64(rest[userLen+8:])))
+	rec.data = tail[:dataLen]
+	return rec, n, nil
+}
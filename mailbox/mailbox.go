@@ -0,0 +1,287 @@
+/*
+ * @Author: yujiaxun
+ * @Date: 2026-10-20 10:58:03
+ * @LastEditTime: 2026-10-20 10:58:03
+ * @Description: 离线消息, 用户重新登录后按顺序投递
+ */
+
+package mailbox
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sync"
+	"time"
+
+	"test/logger"
+)
+
+// Mail 一条离线消息, Data是Processor编码好的消息
+type Mail struct {
+	ID   uint64
+	Time time.Time
+	Data []byte
+}
+
+// Mailbox 每个用户一个队列, 所有修改追加到File, 打开时重放日志恢复
+// 超过TTL的消息不再投递, 队列超过MaxNum条或MaxBytes字节时丢掉最早的消息
+// 日志里的无效数据超过一半并且文件大于CompactSize时重写日志
+type Mailbox struct {
+	File        string
+	TTL         time.Duration //默认7天
+	MaxNum      int           //每个用户最多的消息数, 默认100
+	MaxBytes    int           //每个用户最多的字节数, 默认1MB
+	CompactSize int64         //默认16MB
+	SyncWrites  bool          //每次写入后fsync
+
+	mutex     sync.Mutex
+	file      *os.File
+	fileSize  int64
+	liveSize  int64 //队列里的消息在日志里占用的字节数
+	lastID    uint64
+	queues    map[string]*queue
+	closeFlag bool
+}
+
+type queue struct {
+	mails []*Mail
+	bytes int
+}
+
+var ErrClosed = errors.New("mailbox is closed")
+
+func (m *Mailbox) init() {
+	if m.TTL <= 0 {
+		m.TTL = 7 * 24 * time.Hour
+	}
+	if m.MaxNum <= 0 {
+		m.MaxNum = 100
+	}
+	if m.MaxBytes <= 0 {
+		m.MaxBytes = 1024 * 1024
+	}
+	if m.CompactSize <= 0 {
+		m.CompactSize = 16 * 1024 * 1024
+	}
+	m.queues = make(map[string]*queue)
+}
+
+// Open 打开日志并重放, 末尾写了一半的记录会被截掉
+func (m *Mailbox) Open() error {
+	m.init()
+	file, err := os.OpenFile(m.File, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	var offset int64
+	reader := bufio.NewReader(file)
+	for {
+		rec, n, err := readRecord(reader)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			logger.Error("mailbox %v truncated at %v: %v", m.File, offset, err)
+			break
+		}
+		offset += int64(n)
+		m.apply(rec, int64(n))
+	}
+	if err := file.Truncate(offset); err != nil {
+		file.Close()
+		return err
+	}
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		file.Close()
+		return err
+	}
+	m.file = file
+	m.fileSize = offset
+	return nil
+}
+
+func (m *Mailbox) apply(rec *record, size int64) {
+	if rec.id > m.lastID {
+		m.lastID = rec.id
+	}
+	switch rec.op {
+	case opPut:
+		q := m.queues[rec.userID]
+		if q == nil {
+			q = new(queue)
+			m.queues[rec.userID] = q
+		}
+		q.mails = append(q.mails, &Mail{ID: rec.id, Time: rec.time, Data: rec.data})
+		q.bytes += len(rec.data)
+		m.liveSize += size
+		m.trim(rec.userID, q, time.Now())
+	case opAck:
+		if q := m.queues[rec.userID]; q != nil {
+			m.drop(rec.userID, q, func(mail *Mail) bool { return mail.ID <= rec.id })
+		}
+	}
+}
+
+// trim 去掉过期的消息, 再按MaxNum和MaxBytes去掉最早的消息
+func (m *Mailbox) trim(userID string, q *queue, now time.Time) {
+	m.drop(userID, q, func(mail *Mail) bool {
+		return now.Sub(mail.Time) > m.TTL || len(q.mails) > m.MaxNum || q.bytes > m.MaxBytes
+	})
+}
+
+// drop 从队列头部去掉满足条件的消息
+func (m *Mailbox) drop(userID string, q *queue, cond func(mail *Mail) bool) {
+	for len(q.mails) > 0 && cond(q.mails[0]) {
+		mail := q.mails[0]
+		q.mails[0] = nil
+		q.mails = q.mails[1:]
+		q.bytes -= len(mail.Data)
+		m.liveSize -= int64(recordHeadLen + len(userID) + len(mail.Data) + 4)
+	}
+	if len(q.mails) == 0 {
+		delete(m.queues, userID)
+	}
+}
+
+func (m *Mailbox) write(rec *record) (int64, error) {
+	b := encodeRecord(rec)
+	if _, err := m.file.Write(b); err != nil {
+		return 0, err
+	}
+	if m.SyncWrites {
+		if err := m.file.Sync(); err != nil {
+			return 0, err
+		}
+	}
+	m.fileSize += int64(len(b))
+	return int64(len(b)), nil
+}
+
+// Put 给用户的队列追加一条消息
+func (m *Mailbox) Put(userID string, data []byte) (uint64, error) {
+	if len(userID) > math.MaxUint16 {
+		return 0, fmt.Errorf("user id too long: %v", len(userID))
+	}
+	if len(data) > m.MaxBytes {
+		return 0, fmt.Errorf("mail too long: %v", len(data))
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.closeFlag {
+		return 0, ErrClosed
+	}
+	rec := &record{op: opPut, userID: userID, id: m.lastID + 1, time: time.Now(), data: data}
+	size, err := m.write(rec)
+	if err != nil {
+		return 0, err
+	}
+	m.apply(rec, size)
+	m.compact()
+	return rec.id, nil
+}
+
+// Pending 用户还没有确认并且没有过期的消息, 按投递顺序排列
+func (m *Mailbox) Pending(userID string) []Mail {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	q := m.queues[userID]
+	if q == nil {
+		return nil
+	}
+	m.trim(userID, q, time.Now())
+	mails := make([]Mail, 0, len(q.mails))
+	for _, mail := range q.mails {
+		mails = append(mails, *mail)
+	}
+	return mails
+}
+
+// Count 用户还没有确认的消息数, 包括已经过期但还没清理的
+func (m *Mailbox) Count(userID string) int {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if q := m.queues[userID]; q != nil {
+		return len(q.mails)
+	}
+	return 0
+}
+
+// Ack 确认id及之前的消息, 不再投递
+func (m *Mailbox) Ack(userID string, id uint64) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.closeFlag {
+		return ErrClosed
+	}
+	q := m.queues[userID]
+	if q == nil || q.mails[0].ID > id {
+		return nil
+	}
+	rec := &record{op: opAck, userID: userID, id: id, time: time.Now()}
+	if _, err := m.write(rec); err != nil {
+		return err
+	}
+	m.apply(rec, 0)
+	m.compact()
+	return nil
+}
+
+// compact 重写日志, 只保留队列里的消息, 调用时需要持有mutex
+func (m *Mailbox) compact() {
+	if m.fileSize < m.CompactSize || m.fileSize < 2*m.liveSize {
+		return
+	}
+	if err := m.rewrite(); err != nil {
+		logger.Error("compact mailbox %v error: %v", m.File, err)
+	}
+}
+
+func (m *Mailbox) rewrite() error {
+	now := time.Now()
+	tmpFile := m.File + ".tmp"
+	tmp, err := os.OpenFile(tmpFile, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	writer := bufio.NewWriter(tmp)
+	var size int64
+	for userID, q := range m.queues {
+		m.trim(userID, q, now)
+		for _, mail := range q.mails {
+			n, _ := writer.Write(encodeRecord(&record{op: opPut, userID: userID, id: mail.ID, time: mail.Time, data: mail.Data}))
+			size += int64(n)
+		}
+	}
+	err = writer.Flush()
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if err == nil {
+		err = os.Rename(tmpFile, m.File)
+	}
+	if err != nil {
+		tmp.Close()
+		os.Remove(tmpFile)
+		return err
+	}
+	m.file.Close()
+	m.file = tmp
+	m.fileSize = size
+	m.liveSize = size
+	logger.Release("mailbox %v compacted, size %v", m.File, size)
+	return nil
+}
+
+func (m *Mailbox) Close() error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.closeFlag || m.file == nil {
+		return nil
+	}
+	m.closeFlag = true
+	return m.file.Close()
+}
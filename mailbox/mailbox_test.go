@@ -0,0 +1,106 @@
+/*
+ * @Author: yujiaxun
+ * @Date: 2026-10-20 11:52:16
+ * @LastEditTime: 2026-10-20 11:52:16
+ * @Description: xxx
+ */
+
+package mailbox_test
+
+import (
+	"os"
+	"path/filepath"
+	"test/mailbox"
+	"testing"
+	"time"
+)
+
+func open(t *testing.T, file string) *mailbox.Mailbox {
+	t.Helper()
+	m := &mailbox.Mailbox{File: file, MaxNum: 3}
+	if err := m.Open(); err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func texts(mails []mailbox.Mail) []string {
+	var s []string
+	for _, mail := range mails {
+		s = append(s, string(mail.Data))
+	}
+	return s
+}
+
+func TestMailbox(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "mailbox.log")
+	m := open(t, file)
+	for _, s := range []string{"a", "b", "c", "d"} {
+		m.Put("u1", []byte(s))
+	}
+	m.Put("u2", []byte("x"))
+
+	//超过MaxNum时丢掉最早的消息
+	mails := m.Pending("u1")
+	if got := texts(mails); len(got) != 3 || got[0] != "b" || got[2] != "d" {
+		t.Fatalf("got %v, want [b c d]", got)
+	}
+	m.Ack("u1", mails[1].ID)
+	m.Close()
+
+	//重启后从日志恢复, 末尾写了一半的记录被截掉
+	f, _ := os.OpenFile(file, os.O_WRONLY|os.O_APPEND, 0644)
+	f.Write([]byte{1, 0, 2, 'u'})
+	f.Close()
+	m = open(t, file)
+	defer m.Close()
+	if got := texts(m.Pending("u1")); len(got) != 1 || got[0] != "d" {
+		t.Fatalf("got %v, want [d]", got)
+	}
+	if got := texts(m.Pending("u2")); len(got) != 1 || got[0] != "x" {
+		t.Fatalf("got %v, want [x]", got)
+	}
+	if id, err := m.Put("u1", []byte("e")); err != nil || id != 6 {
+		t.Fatalf("got id %v %v, want 6", id, err)
+	}
+}
+
+func TestMailboxTTL(t *testing.T) {
+	m := &mailbox.Mailbox{File: filepath.Join(t.TempDir(), "mailbox.log"), TTL: 20 * time.Millisecond}
+	if err := m.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+	m.Put("u1", []byte("a"))
+	time.Sleep(30 * time.Millisecond)
+	m.Put("u1", []byte("b"))
+	if got := texts(m.Pending("u1")); len(got) != 1 || got[0] != "b" {
+		t.Fatalf("got %v, want [b]", got)
+	}
+}
+
+func TestMailboxCompact(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "mailbox.log")
+	m := &mailbox.Mailbox{File: file, CompactSize: 1024}
+	if err := m.Open(); err != nil {
+		t.Fatal(err)
+	}
+	data := make([]byte, 100)
+	for i := 0; i < 50; i++ {
+		id, _ := m.Put("u1", data)
+		m.Ack("u1", id)
+	}
+	m.Put("u1", []byte("last"))
+	m.Close()
+	if info, _ := os.Stat(file); info.Size() > 1024 {
+		t.Fatalf("log size %v after compact", info.Size())
+	}
+	m = &mailbox.Mailbox{File: file}
+	if err := m.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+	if got := texts(m.Pending("u1")); len(got) != 1 || got[0] != "last" {
+		t.Fatalf("got %v, want [last]", got)
+	}
+}
@@ -0,0 +1,240 @@
+/*
+ * @Author: yujiaxun
+ * @Date: 2026-10-20 15:40:12
+ * @LastEditTime: 2026-10-20 15:40:12
+ * @Description: prometheus文本格式的监控指标, 不依赖prometheus的库
+ */
+
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// DefBuckets 默认的直方图分桶, 单位为秒
+var DefBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Default 网关内置的指标都注册在这里
+var Default = NewRegistry()
+
+type collector interface {
+	name() string
+	write(w io.Writer)
+}
+
+// Registry 保存所有指标, 实现了http.Handler
+type Registry struct {
+	mutex      sync.Mutex
+	collectors map[string]collector
+}
+
+func NewRegistry() *Registry {
+	r := new(Registry)
+	r.collectors = make(map[string]collector)
+	return r
+}
+
+// register 同名的指标只注册一次, 重复注册时返回已有的指标
+func (r *Registry) register(c collector) collector {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if old, ok := r.collectors[c.name()]; ok {
+		return old
+	}
+	r.collectors[c.name()] = c
+	return c
+}
+
+func (r *Registry) Counter(name string, help string, labels ...string) *CounterVec {
+	v := &CounterVec{vec: newVec(name, help, "counter", labels)}
+	return r.register(v).(*CounterVec)
+}
+
+func (r *Registry) Gauge(name string, help string, labels ...string) *GaugeVec {
+	v := &GaugeVec{vec: newVec(name, help, "gauge", labels)}
+	return r.register(v).(*GaugeVec)
+}
+
+// GaugeFunc 采集时调用fn得到当前值
+func (r *Registry) GaugeFunc(name string, help string, fn func() float64) {
+	r.register(&gaugeFunc{vec: newVec(name, help, "gauge", nil), fn: fn})
+}
+
+// Histogram buckets为nil时使用DefBuckets
+func (r *Registry) Histogram(name string, help string, buckets []float64, labels ...string) *HistogramVec {
+	if buckets == nil {
+		buckets = DefBuckets
+	}
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+	v := &HistogramVec{vec: newVec(name, help, "histogram", labels), buckets: buckets}
+	return r.register(v).(*HistogramVec)
+}
+
+// Write 按名字顺序输出所有指标
+func (r *Registry) Write(w io.Writer) {
+	r.mutex.Lock()
+	collectors := make([]collector, 0, len(r.collectors))
+	for _, c := range r.collectors {
+		collectors = append(collectors, c)
+	}
+	r.mutex.Unlock()
+	sort.Slice(collectors, func(i, j int) bool {
+		return collectors[i].name() < collectors[j].name()
+	})
+	for _, c := range collectors {
+		c.write(w)
+	}
+}
+
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	r.Write(w)
+}
+
+// vec 按标签值保存同一个指标的多个序列
+type vec struct {
+	metricName string
+	help       string
+	typ        string
+	labels     []string
+	mutex      sync.RWMutex
+	series     map[string]interface{}
+	values     map[string][]string
+}
+
+func newVec(name string, help string, typ string, labels []string) vec {
+	return vec{
+		metricName: name,
+		help:       help,
+		typ:        typ,
+		labels:     labels,
+		series:     make(map[string]interface{}),
+		values:     make(map[string][]string),
+	}
+}
+
+func (v *vec) name() string {
+	return v.metricName
+}
+
+func (v *vec) get(values []string, create func() interface{}) interface{} {
+	if len(values) != len(v.labels) {
+		panic(fmt.Sprintf("metric %v needs %v label values, got %v", v.metricName, len(v.labels), len(values)))
+	}
+	key := strings.Join(values, "\xff")
+	v.mutex.RLock()
+	s, ok := v.series[key]
+	v.mutex.RUnlock()
+	if ok {
+		return s
+	}
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	if s, ok := v.series[key]; ok {
+		return s
+	}
+	s = create()
+	v.series[key] = s
+	v.values[key] = append([]string(nil), values...)
+	return s
+}
+
+func (v *vec) writeHead(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %v %v\n# TYPE %v %v\n", v.metricName, escapeHelp(v.help), v.metricName, v.typ)
+}
+
+// sorted 按标签值排序的序列
+func (v *vec) sorted() (series []interface{}, values [][]string) {
+	v.mutex.RLock()
+	defer v.mutex.RUnlock()
+	keys := make([]string, 0, len(v.series))
+	for key := range v.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		series = append(series, v.series[key])
+		values = append(values, v.values[key])
+	}
+	return
+}
+
+// labelString 生成 {a="1",b="2"}, extra为直方图的le标签
+func (v *vec) labelString(values []string, extra ...string) string {
+	if len(values) == 0 && len(extra) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, label := range v.labels {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, "%v=\"%v\"", label, escapeLabel(values[i]))
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		if b.Len() > 1 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, "%v=\"%v\"", extra[i], escapeLabel(extra[i+1]))
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+var (
+	helpReplacer  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelReplacer = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(s string) string {
+	return helpReplacer.Replace(s)
+}
+
+func escapeLabel(s string) string {
+	return labelReplacer.Replace(s)
+}
+
+func formatFloat(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "+Inf"
+	case math.IsInf(f, -1):
+		return "-Inf"
+	case math.IsNaN(f):
+		return "NaN"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// value 可以原子加减的float64
+type value struct {
+	bits uint64
+}
+
+func (v *value) Add(delta float64) {
+	for {
+		old := atomic.LoadUint64(&v.bits)
+		n := math.Float64bits(math.Float64frombits(old) + delta)
+		if atomic.CompareAndSwapUint64(&v.bits, old, n) {
+			return
+		}
+	}
+}
+
+func (v *value) Set(f float64) {
+	atomic.StoreUint64(&v.bits, math.Float64bits(f))
+}
+
+func (v *value) Value() float64 {
+	return math.Float64frombits(atomic.LoadUint64(&v.bits))
+}
@@ -0,0 +1,55 @@
+/*
+ * @Author: yujiaxun
+ * @Date: 2026-10-20 17:20:44
+ * @LastEditTime: 2026-10-20 17:20:44
+ * @Description: xxx
+ */
+
+package metrics_test
+
+import (
+	"strings"
+	"test/metrics"
+	"testing"
+)
+
+func TestRegistry(t *testing.T) {
+	r := metrics.NewRegistry()
+	msgs := r.Counter("msgs_total", "Messages.", "dir")
+	msgs.With("in").Inc()
+	msgs.With("in").Add(2)
+	msgs.With("out").Inc()
+	r.Gauge("conns", "Connections.").With().Set(5)
+	r.GaugeFunc("queue", "Queue.", func() float64 { return 7 })
+	h := r.Histogram("latency_seconds", "Latency.", []float64{0.1, 1}, "type")
+	h.With(`a"b`).Observe(0.05)
+	h.With(`a"b`).Observe(0.5)
+	h.With(`a"b`).Observe(3)
+	if r.Counter("msgs_total", "Messages.", "dir") != msgs {
+		t.Fatal("register twice should return the same metric")
+	}
+
+	var b strings.Builder
+	r.Write(&b)
+	want := `# HELP conns Connections.
+# TYPE conns gauge
+conns 5
+# HELP latency_seconds Latency.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{type="a\"b",le="0.1"} 1
+latency_seconds_bucket{type="a\"b",le="1"} 2
+latency_seconds_bucket{type="a\"b",le="+Inf"} 3
+latency_seconds_sum{type="a\"b"} 3.55
+latency_seconds_count{type="a\"b"} 3
+# HELP msgs_total Messages.
+# TYPE msgs_total counter
+msgs_total{dir="in"} 3
+msgs_total{dir="out"} 1
+# HELP queue Queue.
+# TYPE queue gauge
+queue 7
+`
+	if b.String() != want {
+		t.Fatalf("got\n%v\nwant\n%v", b.String(), want)
+	}
+}
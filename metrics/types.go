@@ -0,0 +1,138 @@
+/*
+ * @Author: yujiaxun
+ * @Date: 2026-10-20 15:58:47
+ * @LastEditTime: 2026-10-20 15:58:47
+ * @Description: counter, gauge 和 histogram
+ */
+
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"sync/atomic"
+)
+
+// Counter 只增不减的计数
+type Counter struct {
+	value
+}
+
+func (c *Counter) Inc() {
+	c.Add(1)
+}
+
+// Add delta不能为负数
+func (c *Counter) Add(delta float64) {
+	if delta < 0 {
+		panic("counter cannot decrease")
+	}
+	c.value.Add(delta)
+}
+
+type CounterVec struct {
+	vec
+}
+
+// With 按标签值取得序列, 值的个数要和注册时的标签个数一样
+func (v *CounterVec) With(values ...string) *Counter {
+	return v.get(values, func() interface{} { return new(Counter) }).(*Counter)
+}
+
+func (v *CounterVec) write(w io.Writer) {
+	v.writeHead(w)
+	series, values := v.sorted()
+	for i, s := range series {
+		fmt.Fprintf(w, "%v%v %v\n", v.metricName, v.labelString(values[i]), formatFloat(s.(*Counter).Value()))
+	}
+}
+
+// Gauge 可增可减的当前值
+type Gauge struct {
+	value
+}
+
+func (g *Gauge) Inc() {
+	g.Add(1)
+}
+
+func (g *Gauge) Dec() {
+	g.Add(-1)
+}
+
+type GaugeVec struct {
+	vec
+}
+
+func (v *GaugeVec) With(values ...string) *Gauge {
+	return v.get(values, func() interface{} { return new(Gauge) }).(*Gauge)
+}
+
+func (v *GaugeVec) write(w io.Writer) {
+	v.writeHead(w)
+	series, values := v.sorted()
+	for i, s := range series {
+		fmt.Fprintf(w, "%v%v %v\n", v.metricName, v.labelString(values[i]), formatFloat(s.(*Gauge).Value()))
+	}
+}
+
+type gaugeFunc struct {
+	vec
+	fn func() float64
+}
+
+func (g *gaugeFunc) write(w io.Writer) {
+	g.writeHead(w)
+	fmt.Fprintf(w, "%v %v\n", g.metricName, formatFloat(g.fn()))
+}
+
+// Histogram 按分桶统计观测值的分布
+type Histogram struct {
+	buckets []float64
+	counts  []uint64 //每个桶自己的计数, 输出时累加
+	count   uint64
+	sum     value
+}
+
+func (h *Histogram) Observe(v float64) {
+	i := sort.SearchFloat64s(h.buckets, v)
+	if i < len(h.counts) {
+		atomic.AddUint64(&h.counts[i], 1)
+	}
+	h.sum.Add(v)
+	atomic.AddUint64(&h.count, 1)
+}
+
+type HistogramVec struct {
+	vec
+	buckets []float64
+}
+
+func (v *HistogramVec) With(values ...string) *Histogram {
+	return v.get(values, func() interface{} {
+		return &Histogram{buckets: v.buckets, counts: make([]uint64, len(v.buckets))}
+	}).(*Histogram)
+}
+
+func (v *HistogramVec) write(w io.Writer) {
+	v.writeHead(w)
+	series, values := v.sorted()
+	for i, s := range series {
+		h := s.(*Histogram)
+		count := atomic.LoadUint64(&h.count)
+		var cumulative uint64
+		for j, le := range h.buckets {
+			cumulative += atomic.LoadUint64(&h.counts[j])
+			fmt.Fprintf(w, "%v_bucket%v %v\n", v.metricName, v.labelString(values[i], "le", formatFloat(le)), cumulative)
+		}
+		//并发Observe时count可能比各个桶的和先增加
+		if count < cumulative {
+			count = cumulative
+		}
+		fmt.Fprintf(w, "%v_bucket%v %v\n", v.metricName, v.labelString(values[i], "le", formatFloat(math.Inf(1))), count)
+		fmt.Fprintf(w, "%v_sum%v %v\n", v.metricName, v.labelString(values[i]), formatFloat(h.sum.Value()))
+		fmt.Fprintf(w, "%v_count%v %v\n", v.metricName, v.labelString(values[i]), count)
+	}
+}
@@ -0,0 +1,116 @@
+/*
+ * @Author: yujiaxun
+ * @Date: 2026-10-22 10:15:26
+ * @LastEditTime: 2026-10-22 10:15:26
+ * @Description: 模块的生命周期, 按注册顺序初始化, 按相反的顺序销毁
+ */
+
+package module
+
+import (
+	"fmt"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"test/logger"
+)
+
+// Module gate, login, game, db这样的模块, Run在单独的协程里执行, closeSig收到值时返回
+type Module interface {
+	OnInit()
+	OnDestroy()
+	Run(closeSig chan bool)
+}
+
+// DestroyTimeout 销毁时等待每个模块Run返回的时间, 超时后直接调用OnDestroy
+var DestroyTimeout = 10 * time.Second
+
+type module struct {
+	mi       Module
+	name     string
+	closeSig chan bool
+	done     chan bool
+}
+
+var (
+	mutex sync.Mutex
+	mods  []*module
+)
+
+// Register 在Init之前注册模块, name只用于日志
+func Register(name string, mi Module) {
+	m := new(module)
+	m.mi = mi
+	m.name = name
+	m.closeSig = make(chan bool, 1)
+	m.done = make(chan bool)
+
+	mutex.Lock()
+	mods = append(mods, m)
+	mutex.Unlock()
+}
+
+// Init 按注册顺序调用OnInit, 全部成功后每个模块在单独的协程里Run
+// 有模块OnInit panic时, 已经初始化的模块按相反顺序OnDestroy, 然后返回错误
+func Init() error {
+	mutex.Lock()
+	list := mods
+	mutex.Unlock()
+
+	for i, m := range list {
+		if err := m.call("OnInit", m.mi.OnInit); err != nil {
+			for j := i - 1; j >= 0; j-- {
+				list[j].call("OnDestroy", list[j].mi.OnDestroy)
+			}
+			mutex.Lock()
+			mods = nil
+			mutex.Unlock()
+			return err
+		}
+		logger.Release("module %v inited", m.name)
+	}
+	for _, m := range list {
+		go m.run()
+	}
+	return nil
+}
+
+// Destroy 按相反顺序通知模块关闭, 等Run返回之后调用OnDestroy
+func Destroy() {
+	mutex.Lock()
+	list := mods
+	mods = nil
+	mutex.Unlock()
+
+	for i := len(list) - 1; i >= 0; i-- {
+		m := list[i]
+		m.closeSig <- true
+		select {
+		case <-m.done:
+		case <-time.After(DestroyTimeout):
+			logger.Error("module %v not closed in %v", m.name, DestroyTimeout)
+		}
+		m.call("OnDestroy", m.mi.OnDestroy)
+		logger.Release("module %v destroyed", m.name)
+	}
+}
+
+func (m *module) run() {
+	defer close(m.done)
+	m.call("Run", func() {
+		m.mi.Run(m.closeSig)
+	})
+}
+
+// call 调用模块的方法, panic时打印堆栈并返回错误
+func (m *module) call(method string, f func()) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("module %v %v panic: %v", m.name, method, r)
+			logger.Error("%v\n%s", err, debug.Stack())
+		}
+	}()
+	f()
+	return nil
+}
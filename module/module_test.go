@@ -0,0 +1,145 @@
+/*
+ * @Author: yujiaxun
+ * @Date: 2026-10-22 10:48:03
+ * @LastEditTime: 2026-10-22 10:48:03
+ * @Description: xxx
+ */
+
+package module_test
+
+import (
+	"strings"
+	"sync"
+	"test/gate"
+	"test/module"
+	"testing"
+	"time"
+)
+
+var _ module.Module = new(gate.Gate)
+
+type recorder struct {
+	sync.Mutex
+	events []string
+}
+
+func (r *recorder) add(event string) {
+	r.Lock()
+	r.events = append(r.events, event)
+	r.Unlock()
+}
+
+func (r *recorder) String() string {
+	r.Lock()
+	defer r.Unlock()
+	return strings.Join(r.events, ",")
+}
+
+type testModule struct {
+	name      string
+	rec       *recorder
+	initPanic bool
+	runPanic  bool
+	ignore    bool //不响应closeSig
+}
+
+func (m *testModule) OnInit() {
+	if m.initPanic {
+		panic("init " + m.name)
+	}
+	m.rec.add("init " + m.name)
+}
+
+func (m *testModule) Run(closeSig chan bool) {
+	if m.runPanic {
+		panic("run " + m.name)
+	}
+	if m.ignore {
+		select {}
+	}
+	<-closeSig
+	m.rec.add("close " + m.name)
+}
+
+func (m *testModule) OnDestroy() {
+	m.rec.add("destroy " + m.name)
+}
+
+func TestLifecycle(t *testing.T) {
+	rec := new(recorder)
+	module.Register("db", &testModule{name: "db", rec: rec})
+	module.Register("game", &testModule{name: "game", rec: rec, runPanic: true})
+	module.Register("gate", &testModule{name: "gate", rec: rec})
+	if err := module.Init(); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(10 * time.Millisecond)
+	module.Destroy()
+	want := "init db,init game,init gate,close gate,destroy gate,destroy game,close db,destroy db"
+	if rec.String() != want {
+		t.Fatalf("got %v, want %v", rec, want)
+	}
+}
+
+func TestInitPanic(t *testing.T) {
+	rec := new(recorder)
+	module.Register("db", &testModule{name: "db", rec: rec})
+	module.Register("game", &testModule{name: "game", rec: rec, initPanic: true})
+	module.Register("gate", &testModule{name: "gate", rec: rec})
+	err := module.Init()
+	if err == nil || !strings.Contains(err.Error(), "game") {
+		t.Fatalf("expect init error, got %v", err)
+	}
+	if want := "init db,destroy db"; rec.String() != want {
+		t.Fatalf("got %v, want %v", rec, want)
+	}
+}
+
+func TestDestroyTimeout(t *testing.T) {
+	old := module.DestroyTimeout
+	module.DestroyTimeout = 20 * time.Millisecond
+	defer func() {
+		module.DestroyTimeout = old
+	}()
+	rec := new(recorder)
+	module.Register("stuck", &testModule{name: "stuck", rec: rec, ignore: true})
+	if err := module.Init(); err != nil {
+		t.Fatal(err)
+	}
+	module.Destroy()
+	if want := "init stuck,destroy stuck"; rec.String() != want {
+		t.Fatalf("got %v, want %v", rec, want)
+	}
+}
+
+func TestSkeleton(t *testing.T) {
+	s := module.NewSkeleton(0)
+	closeSig := make(chan bool, 1)
+	done := make(chan bool)
+	go func() {
+		s.Run(closeSig)
+		close(done)
+	}()
+
+	//在多个协程里创建定时器, 回调在Run的协程里执行, count不需要加锁
+	count := 0
+	finished := make(chan bool)
+	for i := 0; i < 10; i++ {
+		go s.Post(func() {
+			count++
+			if count == 10 {
+				close(finished)
+			}
+		})
+	}
+	select {
+	case <-finished:
+	case <-time.After(time.Second):
+		t.Fatal("callbacks not executed")
+	}
+	if _, err := s.CronFunc("bad", func() {}); err == nil {
+		t.Fatal("bad cron expr should fail")
+	}
+	closeSig <- true
+	<-done
+}
@@ -0,0 +1,70 @@
+/*
+ * @Author: yujiaxun
+ * @Date: 2026-10-22 15:20:36
+ * @LastEditTime: 2026-10-22 15:20:36
+ * @Description: 模块的骨架, 定时器的回调都在模块的协程里执行
+ */
+
+package module
+
+import (
+	"time"
+
+	"test/timer"
+)
+
+// Skeleton 嵌入到模块里使用, 模块的Run调用Skeleton.Run
+// 定时器可以在任意协程创建, 例如agent的消息处理里, 回调都在Run的协程里执行, 游戏状态不需要加锁
+//
+//	type Game struct {
+//		*module.Skeleton
+//	}
+//
+//	game := &Game{Skeleton: module.NewSkeleton(0)}
+//	game.CronFunc("0 0 5 * * *", game.dailyReset)
+type Skeleton struct {
+	dispatcher *timer.Dispatcher
+}
+
+// NewSkeleton timerLen为等待执行的回调数, 满了之后到期的定时器会等待, 默认100
+func NewSkeleton(timerLen int) *Skeleton {
+	if timerLen <= 0 {
+		timerLen = 100
+	}
+	s := new(Skeleton)
+	s.dispatcher = timer.NewDispatcher(timerLen)
+	return s
+}
+
+func (s *Skeleton) Run(closeSig chan bool) {
+	for {
+		select {
+		case <-closeSig:
+			return
+		case t := <-s.dispatcher.ChanTimer:
+			t.Cb()
+		}
+	}
+}
+
+func (s *Skeleton) AfterFunc(d time.Duration, cb func()) *timer.Timer {
+	return s.dispatcher.AfterFunc(d, cb)
+}
+
+// Post 尽快在模块的协程里执行cb
+func (s *Skeleton) Post(cb func()) {
+	s.dispatcher.AfterFunc(0, cb)
+}
+
+func (s *Skeleton) TickFunc(d time.Duration, cb func()) *timer.Cron {
+	return s.dispatcher.TickFunc(d, cb)
+}
+
+// CronFunc expr格式见timer.CronExpr
+func (s *Skeleton) CronFunc(expr string, cb func()) (*timer.Cron, error) {
+	cronExpr, err := timer.NewCronExpr(expr)
+	if err != nil {
+		return nil, err
+	}
+	return s.dispatcher.CronFunc(cronExpr, cb), nil
+}
@@ -7,6 +7,8 @@
 
 package network
 
+import "context"
+
 type Processor interface {
 	// must goroutine safe
 	Route(msg interface{}, userData interface{}) error
@@ -15,3 +17,19 @@ type Processor interface {
 	// must goroutine safe
 	Marshal(msg interface{}) ([]byte, error)
 }
+
+// 可选接口, Processor实现后可以按消息类型限流, 返回nil表示不限制
+// 在agent协程里检查, ActionThrottle时不阻塞读取, 超出速率的消息到时间后再按顺序处理
+type MsgLimiter interface {
+	MsgLimit(msg interface{}) *RateLimit
+}
+
+// 可选接口, Processor实现后消息可以转发到后端, forward为false时仍然交给Route处理
+type RouteKeyer interface {
+	RouteKey(msg interface{}) (key string, forward bool)
+}
+
+// 可选接口, Processor实现后用RouteContext代替Route, ctx在连接关闭时取消
+type ContextRouter interface {
+	RouteContext(ctx context.Context, msg interface{}, userData interface{}) error
+}
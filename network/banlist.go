@@ -0,0 +1,95 @@
+/*
+ * @Author: yujiaxun
+ * @Date: 2026-10-19 15:02:36
+ * @LastEditTime: 2026-10-19 15:02:36
+ * @Description: ip封禁列表, 支持过期和运行时管理
+ */
+
+package network
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"test/logger"
+)
+
+// Ban 一条封禁记录, Expire为零值表示永久封禁
+type Ban struct {
+	IP     string    `json:"ip"`
+	Reason string    `json:"reason"`
+	Expire time.Time `json:"expire"`
+}
+
+// BanList 协程安全的ip封禁列表
+type BanList struct {
+	sync.Mutex
+	bans map[string]Ban
+}
+
+func NewBanList() *BanList {
+	l := new(BanList)
+	l.bans = make(map[string]Ban)
+	return l
+}
+
+// Ban 封禁ip, d <= 0 表示永久封禁, 重复封禁会覆盖之前的记录
+func (l *BanList) Ban(ip string, d time.Duration, reason string) {
+	ban := Ban{IP: ip, Reason: reason}
+	if d > 0 {
+		ban.Expire = time.Now().Add(d)
+	}
+	l.Lock()
+	l.bans[ip] = ban
+	l.Unlock()
+	logger.Release("ip %v is banned for %v, reason: %v", ip, d, reason)
+}
+
+func (l *BanList) Unban(ip string) bool {
+	l.Lock()
+	defer l.Unlock()
+	if _, ok := l.bans[ip]; !ok {
+		return false
+	}
+	delete(l.bans, ip)
+	logger.Release("ip %v is unbanned", ip)
+	return true
+}
+
+func (l *BanList) IsBanned(ip string) bool {
+	l.Lock()
+	defer l.Unlock()
+	ban, ok := l.bans[ip]
+	if !ok {
+		return false
+	}
+	if ban.expired(time.Now()) {
+		delete(l.bans, ip)
+		return false
+	}
+	return true
+}
+
+// List 返回所有未过期的封禁, 按ip排序
+func (l *BanList) List() []Ban {
+	l.Lock()
+	defer l.Unlock()
+	now := time.Now()
+	bans := make([]Ban, 0, len(l.bans))
+	for ip, ban := range l.bans {
+		if ban.expired(now) {
+			delete(l.bans, ip)
+			continue
+		}
+		bans = append(bans, ban)
+	}
+	sort.Slice(bans, func(i, j int) bool {
+		return bans[i].IP < bans[j].IP
+	})
+	return bans
+}
+
+func (ban Ban) expired(now time.Time) bool {
+	return !ban.Expire.IsZero() && now.After(ban.Expire)
+}
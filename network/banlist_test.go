@@ -0,0 +1,41 @@
+/*
+ * @Author: yujiaxun
+ * @Date: 2026-10-22 16:40:05
+ * @LastEditTime: 2026-10-22 16:40:05
+ * @Description: xxx
+ */
+
+package network_test
+
+import (
+	"test/network"
+	"testing"
+	"time"
+)
+
+func TestBanListExpire(t *testing.T) {
+	l := network.NewBanList()
+	l.Ban("10.0.0.1", 30*time.Millisecond, "spam")
+	l.Ban("10.0.0.2", 0, "forever")
+	if !l.IsBanned("10.0.0.1") || !l.IsBanned("10.0.0.2") {
+		t.Fatal("ip is not banned")
+	}
+	if bans := l.List(); len(bans) != 2 || bans[0].IP != "10.0.0.1" || bans[0].Reason != "spam" {
+		t.Fatalf("bans %+v", bans)
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	if l.IsBanned("10.0.0.1") {
+		t.Fatal("ban is not expired")
+	}
+	//永久封禁不会过期
+	if bans := l.List(); len(bans) != 1 || bans[0].IP != "10.0.0.2" || !bans[0].Expire.IsZero() {
+		t.Fatalf("bans %+v", bans)
+	}
+	if l.Unban("10.0.0.1") {
+		t.Fatal("expired ban should be removed")
+	}
+	if !l.Unban("10.0.0.2") || l.IsBanned("10.0.0.2") {
+		t.Fatal("unban failed")
+	}
+}
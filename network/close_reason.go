@@ -0,0 +1,55 @@
+/*
+ * @Author: yujiaxun
+ * @Date: 2026-10-21 16:40:18
+ * @LastEditTime: 2026-10-21 16:40:18
+ * @Description: 连接关闭的原因
+ */
+
+package network
+
+import (
+	"errors"
+	"net"
+	"strings"
+
+	"github.com/gorilla/websocket"
+)
+
+// CloseReason 连接关闭的原因, 同时用作监控指标的标签, 只记录第一个
+type CloseReason string
+
+const (
+	CloseClientClosed  CloseReason = "client_closed"   //客户端发送了关闭帧
+	CloseReadTimeout   CloseReason = "read_timeout"    //心跳超时
+	CloseReadError     CloseReason = "read_error"      //没有关闭帧就断开了, 例如网络中断
+	CloseWriteError    CloseReason = "write_error"     //写失败
+	CloseReadQueueFull CloseReason = "read_queue_full" //上层处理不过来
+	CloseKicked        CloseReason = "kicked"          //发送关闭码后断开, 包括限流和重复登录
+	CloseShutdown      CloseReason = "server_shutdown" //服务器关闭或者排空
+	CloseProtocolError CloseReason = "protocol_error"  //websocket协议错误, 或者上层无法解析消息
+	CloseByServer      CloseReason = "closed"          //上层主动关闭
+)
+
+func (reason CloseReason) String() string {
+	return string(reason)
+}
+
+func readErrorReason(err error) CloseReason {
+	var closeErr *websocket.CloseError
+	if errors.As(err, &closeErr) {
+		//没有收到关闭帧就断开时gorilla返回1006
+		if closeErr.Code == websocket.CloseAbnormalClosure {
+			return CloseReadError
+		}
+		return CloseClientClosed
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return CloseReadTimeout
+	}
+	//gorilla的协议错误没有导出的类型, 只能根据前缀判断
+	if err == websocket.ErrReadLimit || strings.HasPrefix(err.Error(), "websocket: ") {
+		return CloseProtocolError
+	}
+	return CloseReadError
+}
@@ -8,6 +8,7 @@
 package network
 
 import (
+	"context"
 	"net"
 )
 
@@ -19,4 +20,12 @@ type Conn interface {
 	LocalAddr() net.Addr
 	RemoteAddr() net.Addr
 	Close()
+	CloseWithCode(code int, text string)
+	// 写缓冲区里还没发出去的消息数
+	PendingWrite() int
+	// 连接关闭时取消
+	Context() context.Context
+	// 关闭的原因, 只记录第一个
+	SetCloseReason(reason CloseReason)
+	CloseReason() CloseReason
 }
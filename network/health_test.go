@@ -0,0 +1,75 @@
+/*
+ * @Author: yujiaxun
+ * @Date: 2026-10-22 18:05:49
+ * @LastEditTime: 2026-10-22 18:05:49
+ * @Description: xxx
+ */
+
+package network_test
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"test/network"
+	"testing"
+)
+
+func httpGet(t *testing.T, wsServer *network.WSServer, path string) (int, string) {
+	t.Helper()
+	waitListen(t, wsServer)
+	resp, err := http.Get("http://" + wsServer.ListenAddr().String() + path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, string(body)
+}
+
+func TestHealth(t *testing.T) {
+	wsServer := &network.WSServer{}
+	startWSServer(t, wsServer)
+	if status, body := httpGet(t, wsServer, "/healthz"); status != http.StatusOK || body != "ok\n" {
+		t.Fatalf("healthz %v %q", status, body)
+	}
+	//排空时进程还活着
+	wsServer.SetDraining(true)
+	if status, _ := httpGet(t, wsServer, "/healthz"); status != http.StatusOK {
+		t.Fatalf("healthz while draining %v", status)
+	}
+}
+
+func TestReady(t *testing.T) {
+	var notReady atomic.Value
+	notReady.Store("")
+	wsServer := &network.WSServer{
+		ReadyCheck: func() error {
+			if s := notReady.Load().(string); s != "" {
+				return errors.New(s)
+			}
+			return nil
+		},
+	}
+	startWSServer(t, wsServer)
+	if status, body := httpGet(t, wsServer, "/readyz"); status != http.StatusOK || body != "ok\n" {
+		t.Fatalf("readyz %v %q", status, body)
+	}
+
+	notReady.Store("backend down")
+	if status, body := httpGet(t, wsServer, "/readyz"); status != http.StatusServiceUnavailable || !strings.Contains(body, "backend down") {
+		t.Fatalf("readyz with failed check %v %q", status, body)
+	}
+	notReady.Store("")
+
+	wsServer.SetDraining(true)
+	if status, body := httpGet(t, wsServer, "/readyz"); status != http.StatusServiceUnavailable || !strings.Contains(body, "draining") {
+		t.Fatalf("readyz while draining %v %q", status, body)
+	}
+	wsServer.SetDraining(false)
+	if status, _ := httpGet(t, wsServer, "/readyz"); status != http.StatusOK {
+		t.Fatalf("readyz after draining %v", status)
+	}
+}
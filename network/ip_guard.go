@@ -0,0 +1,112 @@
+/*
+ * @Author: yujiaxun
+ * @Date: 2026-10-19 15:10:52
+ * @LastEditTime: 2026-10-19 15:10:52
+ * @Description: 升级websocket之前按ip检查连接数和升级频率
+ */
+
+package network
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"time"
+)
+
+const ipSweepInterval = time.Minute
+
+var (
+	errMaxConn     = errors.New("server is reached the max connectNum")
+	errMaxIPConn   = errors.New("ip is reached the max connectNum")
+	errUpgradeRate = errors.New("ip upgrade too frequently")
+)
+
+// ipState 同一个ip的连接数和限流状态, 由server的锁保护
+type ipState struct {
+	conns    int
+	limiter  *Limiter     //上行消息限流, 所有连接共享
+	upgrades *TokenBucket //升级频率限制
+	lastSeen time.Time
+}
+
+// acquireConn 升级之前占用一个连接名额, 成功后连接关闭时要调用releaseConn
+func (server *WSServer) acquireConn(ip string) (*Limiter, error) {
+	server.Lock()
+	defer server.Unlock()
+	now := time.Now()
+	server.sweepIPStates(now)
+
+	state, ok := server.ipStates[ip]
+	if !ok {
+		state = new(ipState)
+		if server.UpgradePerSec > 0 {
+			state.upgrades = NewTokenBucket(server.UpgradePerSec, server.UpgradeBurst)
+		}
+		server.ipStates[ip] = state
+	}
+	state.lastSeen = now
+
+	if state.upgrades != nil && !state.upgrades.Allow(1, now) {
+		return nil, errUpgradeRate
+	}
+	if server.connNum >= server.MaxConnNum {
+		return nil, errMaxConn
+	}
+	if server.MaxConnPerIP > 0 && state.conns >= server.MaxConnPerIP {
+		return nil, errMaxIPConn
+	}
+	server.connNum++
+	state.conns++
+	if state.limiter == nil {
+		//没有限流时也创建, 运行时可以通过SetRateLimits开启
+		state.limiter = NewLimiter(server.IPRateLimit)
+		state.limiter.SetMaxDelayed(server.PendingReadNum)
+	}
+	return state.limiter, nil
+}
+
+func (server *WSServer) releaseConn(ip string) {
+	server.Lock()
+	defer server.Unlock()
+	server.connNum--
+	state, ok := server.ipStates[ip]
+	if !ok {
+		return
+	}
+	state.conns--
+	if state.conns <= 0 {
+		state.conns = 0
+		//连接都断开后不再共享限流状态
+		state.limiter = nil
+		state.lastSeen = time.Now()
+	}
+}
+
+// sweepIPStates 定期清理没有连接并且已经空闲的ip
+func (server *WSServer) sweepIPStates(now time.Time) {
+	if now.Sub(server.lastSweep) < ipSweepInterval {
+		return
+	}
+	server.lastSweep = now
+	for ip, state := range server.ipStates {
+		if state.conns == 0 && now.Sub(state.lastSeen) >= ipSweepInterval {
+			delete(server.ipStates, ip)
+		}
+	}
+}
+
+func rejectStatus(err error) int {
+	if err == errMaxConn {
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusTooManyRequests
+}
+
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
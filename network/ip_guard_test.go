@@ -0,0 +1,101 @@
+/*
+ * @Author: yujiaxun
+ * @Date: 2026-10-22 16:48:31
+ * @LastEditTime: 2026-10-22 16:48:31
+ * @Description: xxx
+ */
+
+package network_test
+
+import (
+	"net/http"
+	"test/network"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// tryDial 连接失败时返回http状态码
+func tryDial(t *testing.T, wsServer *network.WSServer) (*websocket.Conn, int) {
+	t.Helper()
+	waitListen(t, wsServer)
+	c, resp, err := websocket.DefaultDialer.Dial("ws://"+wsServer.ListenAddr().String()+"/", nil)
+	if err == nil {
+		t.Cleanup(func() { c.Close() })
+		return c, http.StatusSwitchingProtocols
+	}
+	if resp == nil {
+		t.Fatal(err)
+	}
+	return nil, resp.StatusCode
+}
+
+func TestMaxConnPerIP(t *testing.T) {
+	wsServer := &network.WSServer{MaxConnPerIP: 2}
+	startWSServer(t, wsServer)
+	waitListen(t, wsServer)
+
+	//升级失败时归还名额
+	resp, err := http.Get("http://" + wsServer.ListenAddr().String() + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("plain http request status %v", resp.StatusCode)
+	}
+
+	c1, _ := tryDial(t, wsServer)
+	if c1 == nil {
+		t.Fatal("first dial failed")
+	}
+	if c, _ := tryDial(t, wsServer); c == nil {
+		t.Fatal("second dial failed")
+	}
+	if _, status := tryDial(t, wsServer); status != http.StatusTooManyRequests {
+		t.Fatalf("third dial status %v", status)
+	}
+
+	//连接关闭后可以再连
+	c1.Close()
+	for i := 0; ; i++ {
+		c, _ := tryDial(t, wsServer)
+		if c != nil {
+			break
+		}
+		if i == 100 {
+			t.Fatal("conn is not released")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestUpgradeRate(t *testing.T) {
+	wsServer := &network.WSServer{UpgradePerSec: 0.001, UpgradeBurst: 2}
+	startWSServer(t, wsServer)
+	for i := 0; i < 2; i++ {
+		c, status := tryDial(t, wsServer)
+		if c == nil {
+			t.Fatalf("dial %v status %v", i, status)
+		}
+		c.Close()
+	}
+	//连接关闭了也不能超过升级频率
+	if _, status := tryDial(t, wsServer); status != http.StatusTooManyRequests {
+		t.Fatalf("dial status %v", status)
+	}
+}
+
+func TestBannedIP(t *testing.T) {
+	wsServer := &network.WSServer{BanList: network.NewBanList()}
+	wsServer.BanList.Ban("127.0.0.1", 50*time.Millisecond, "test")
+	startWSServer(t, wsServer)
+	if _, status := tryDial(t, wsServer); status != http.StatusForbidden {
+		t.Fatalf("banned dial status %v", status)
+	}
+	time.Sleep(60 * time.Millisecond)
+	if c, status := tryDial(t, wsServer); c == nil {
+		t.Fatalf("dial after ban expired status %v", status)
+	}
+}
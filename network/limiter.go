@@ -0,0 +1,264 @@
+/*
+ * @Author: yujiaxun
+ * @Date: 2026-10-19 13:20:05
+ * @LastEditTime: 2026-10-19 13:20:05
+ * @Description: 令牌桶限流
+ */
+
+package network
+
+import (
+	"sync"
+	"time"
+)
+
+// LimitAction 超出限制时的处理方式
+type LimitAction int
+
+const (
+	ActionThrottle LimitAction = iota //延后处理超出速率的消息
+	ActionDrop                        //丢弃超出的消息
+	ActionWarnKick                    //丢弃并警告, 超过MaxWarn次后踢掉
+	ActionBan                         //踢掉并封禁ip BanTime
+)
+
+// RateLimit 限流配置, 速率为0表示不限制
+type RateLimit struct {
+	MsgPerSec   float64
+	MsgBurst    int
+	BytesPerSec float64
+	BytesBurst  int
+	Action      LimitAction
+	MaxWarn     int
+	BanTime     time.Duration
+}
+
+// LimitResult 一条消息的检查结果
+type LimitResult int
+
+const (
+	LimitPass    LimitResult = iota //通过
+	LimitDelay                      //等待后通过
+	LimitDiscard                    //丢弃
+	LimitWarn                       //丢弃并警告
+	LimitKick                       //踢掉连接
+	LimitBanned                     //踢掉并封禁ip
+)
+
+// TokenBucket 令牌桶, rate为每秒产生的令牌数, burst为桶的容量
+type TokenBucket struct {
+	rate    float64
+	burst   float64
+	tokens  float64
+	maxDebt float64 //Reserve最多预支的令牌数, 默认为burst
+	last    time.Time
+}
+
+func NewTokenBucket(rate float64, burst int) *TokenBucket {
+	if burst <= 0 {
+		burst = int(rate)
+		if burst <= 0 {
+			burst = 1
+		}
+	}
+	b := new(TokenBucket)
+	b.rate = rate
+	b.burst = float64(burst)
+	b.tokens = b.burst
+	b.maxDebt = b.burst
+	b.last = time.Now()
+	return b
+}
+
+// SetMaxDebt 设置Reserve最多预支的令牌数, 限制等待时间不超过debt/rate
+func (b *TokenBucket) SetMaxDebt(debt float64) {
+	if debt < 0 {
+		debt = 0
+	}
+	b.maxDebt = debt
+}
+
+func (b *TokenBucket) refill(now time.Time) {
+	if !now.After(b.last) {
+		return
+	}
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+}
+
+// Allow 令牌足够时取走n个令牌
+func (b *TokenBucket) Allow(n float64, now time.Time) bool {
+	b.refill(now)
+	if b.tokens < n {
+		return false
+	}
+	b.tokens -= n
+	return true
+}
+
+// Reserve 取走n个令牌, 返回需要等待的时间; 预支超过maxDebt时不取令牌, 返回false
+func (b *TokenBucket) Reserve(n float64, now time.Time) (time.Duration, bool) {
+	b.refill(now)
+	if b.tokens-n < -b.maxDebt {
+		return 0, false
+	}
+	b.tokens -= n
+	if b.tokens >= 0 {
+		return 0, true
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second)), true
+}
+
+// Refund 退还n个令牌, 用于取了令牌但最终没有处理的消息
+func (b *TokenBucket) Refund(n float64) {
+	b.tokens += n
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+}
+
+// Limiter 按照RateLimit同时限制消息数和字节数, 协程安全
+type Limiter struct {
+	sync.Mutex
+	limit      *RateLimit
+	msgs       *TokenBucket
+	bytes      *TokenBucket
+	warns      int
+	maxDelayed int //ActionThrottle时最多延后的消息数, 0表示MsgBurst
+}
+
+// NewLimiter limit为nil时不限制, 之后可以用SetLimit修改
+func NewLimiter(limit *RateLimit) *Limiter {
+	l := new(Limiter)
+	l.setLimit(limit)
+	return l
+}
+
+func (l *Limiter) setLimit(limit *RateLimit) {
+	l.limit = limit
+	l.msgs = nil
+	l.bytes = nil
+	l.warns = 0
+	if limit == nil {
+		return
+	}
+	if limit.MsgPerSec > 0 {
+		l.msgs = NewTokenBucket(limit.MsgPerSec, limit.MsgBurst)
+	}
+	if limit.BytesPerSec > 0 {
+		l.bytes = NewTokenBucket(limit.BytesPerSec, limit.BytesBurst)
+	}
+	if l.msgs != nil && l.maxDelayed > 0 {
+		l.msgs.SetMaxDebt(float64(l.maxDelayed))
+	}
+}
+
+// SetMaxDelayed ActionThrottle时最多预支n条消息的令牌, 超过时丢弃, 避免持续超速的客户端积累很长的等待时间
+// 字节数最多预支一个BytesBurst
+func (l *Limiter) SetMaxDelayed(n int) {
+	l.Lock()
+	l.maxDelayed = n
+	if l.msgs != nil && n > 0 {
+		l.msgs.SetMaxDebt(float64(n))
+	}
+	l.Unlock()
+}
+
+// SetLimit 运行时修改限流配置, 令牌桶重新装满
+func (l *Limiter) SetLimit(limit *RateLimit) {
+	l.Lock()
+	l.setLimit(limit)
+	l.Unlock()
+}
+
+func (l *Limiter) Limit() *RateLimit {
+	l.Lock()
+	defer l.Unlock()
+	return l.limit
+}
+
+// Check 检查一条n字节的消息, LimitDelay时需要等待返回的时间后再处理
+// ActionThrottle时预支的令牌超过上限返回LimitDiscard, 不取令牌
+func (l *Limiter) Check(n int) (LimitResult, time.Duration) {
+	l.Lock()
+	defer l.Unlock()
+	if l.limit == nil {
+		return LimitPass, 0
+	}
+	now := time.Now()
+	if l.limit.Action == ActionThrottle {
+		var wait time.Duration
+		if l.msgs != nil {
+			w, ok := l.msgs.Reserve(1, now)
+			if !ok {
+				return LimitDiscard, 0
+			}
+			wait = w
+		}
+		if l.bytes != nil {
+			w, ok := l.bytes.Reserve(float64(n), now)
+			if !ok {
+				if l.msgs != nil {
+					l.msgs.Refund(1)
+				}
+				return LimitDiscard, 0
+			}
+			if w > wait {
+				wait = w
+			}
+		}
+		if wait > 0 {
+			return LimitDelay, wait
+		}
+		return LimitPass, 0
+	}
+
+	if l.allow(n, now) {
+		return LimitPass, 0
+	}
+	switch l.limit.Action {
+	case ActionWarnKick:
+		l.warns++
+		if l.warns > l.limit.MaxWarn {
+			return LimitKick, 0
+		}
+		return LimitWarn, 0
+	case ActionBan:
+		return LimitBanned, 0
+	default:
+		return LimitDiscard, 0
+	}
+}
+
+// Refund 退还一条n字节的消息取走的令牌, 消息通过检查但最终被丢弃时调用
+func (l *Limiter) Refund(n int) {
+	l.Lock()
+	defer l.Unlock()
+	if l.msgs != nil {
+		l.msgs.Refund(1)
+	}
+	if l.bytes != nil {
+		l.bytes.Refund(float64(n))
+	}
+}
+
+func (l *Limiter) allow(n int, now time.Time) bool {
+	if l.msgs != nil && l.bytes != nil {
+		//两个桶都够才取令牌
+		l.msgs.refill(now)
+		l.bytes.refill(now)
+		if l.msgs.tokens < 1 || l.bytes.tokens < float64(n) {
+			return false
+		}
+	}
+	if l.msgs != nil && !l.msgs.Allow(1, now) {
+		return false
+	}
+	if l.bytes != nil && !l.bytes.Allow(float64(n), now) {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,112 @@
+/*
+ * @Author: yujiaxun
+ * @Date: 2026-10-19 14:20:11
+ * @LastEditTime: 2026-10-19 14:20:11
+ * @Description: xxx
+ */
+
+package network_test
+
+import (
+	"test/network"
+	"testing"
+	"time"
+)
+
+func TestTokenBucket(t *testing.T) {
+	b := network.NewTokenBucket(10, 5)
+	now := time.Now()
+	for i := 0; i < 5; i++ {
+		if !b.Allow(1, now) {
+			t.Fatalf("token %v should be allowed", i)
+		}
+	}
+	if b.Allow(1, now) {
+		t.Fatal("bucket should be empty")
+	}
+	if !b.Allow(1, now.Add(100*time.Millisecond)) {
+		t.Fatal("bucket should refill")
+	}
+	if wait, ok := b.Reserve(1, now.Add(100*time.Millisecond)); !ok || wait != 100*time.Millisecond {
+		t.Fatalf("wait %v %v, want 100ms", wait, ok)
+	}
+}
+
+func TestTokenBucketDebt(t *testing.T) {
+	b := network.NewTokenBucket(10, 2)
+	b.SetMaxDebt(3)
+	now := time.Now()
+	for i := 0; i < 5; i++ {
+		if _, ok := b.Reserve(1, now); !ok {
+			t.Fatalf("reserve %v refused", i)
+		}
+	}
+	if _, ok := b.Reserve(1, now); ok {
+		t.Fatal("reserve over max debt")
+	}
+	b.Refund(1)
+	if wait, ok := b.Reserve(1, now); !ok || wait != 300*time.Millisecond {
+		t.Fatalf("wait %v %v after refund, want 300ms", wait, ok)
+	}
+}
+
+func TestLimiterMaxDelayed(t *testing.T) {
+	l := network.NewLimiter(&network.RateLimit{MsgPerSec: 10, MsgBurst: 2, Action: network.ActionThrottle})
+	l.SetMaxDelayed(3)
+	for i := 0; i < 5; i++ {
+		if r, _ := l.Check(10); r != network.LimitPass && r != network.LimitDelay {
+			t.Fatalf("check %v got %v", i, r)
+		}
+	}
+	if r, _ := l.Check(10); r != network.LimitDiscard {
+		t.Fatalf("got %v, want discard over max delayed", r)
+	}
+	l.Refund(10)
+	if r, wait := l.Check(10); r != network.LimitDelay || wait > 300*time.Millisecond {
+		t.Fatalf("got %v %v after refund", r, wait)
+	}
+}
+
+func TestLimiterWarnKick(t *testing.T) {
+	l := network.NewLimiter(&network.RateLimit{MsgPerSec: 1, MsgBurst: 1, Action: network.ActionWarnKick, MaxWarn: 2})
+	want := []network.LimitResult{network.LimitPass, network.LimitWarn, network.LimitWarn, network.LimitKick}
+	for i, w := range want {
+		if r, _ := l.Check(10); r != w {
+			t.Fatalf("check %v got %v, want %v", i, r, w)
+		}
+	}
+}
+
+func TestLimiterBytes(t *testing.T) {
+	l := network.NewLimiter(&network.RateLimit{BytesPerSec: 100, BytesBurst: 100, Action: network.ActionDrop})
+	if r, _ := l.Check(80); r != network.LimitPass {
+		t.Fatalf("got %v, want pass", r)
+	}
+	if r, _ := l.Check(80); r != network.LimitDiscard {
+		t.Fatalf("got %v, want discard", r)
+	}
+
+	l = network.NewLimiter(&network.RateLimit{BytesPerSec: 100, BytesBurst: 100, Action: network.ActionThrottle})
+	l.Check(100)
+	if r, wait := l.Check(50); r != network.LimitDelay || wait <= 0 {
+		t.Fatalf("got %v %v, want delay", r, wait)
+	}
+}
+
+func TestLimiterSetLimit(t *testing.T) {
+	l := network.NewLimiter(nil)
+	for i := 0; i < 10; i++ {
+		if r, _ := l.Check(10); r != network.LimitPass {
+			t.Fatalf("no limit got %v", r)
+		}
+	}
+	l.SetLimit(&network.RateLimit{MsgPerSec: 1, MsgBurst: 1, Action: network.ActionDrop})
+	l.Check(10)
+	if r, _ := l.Check(10); r != network.LimitDiscard {
+		t.Fatalf("got %v, want discard", r)
+	}
+	l.SetLimit(nil)
+	if r, _ := l.Check(10); r != network.LimitPass {
+		t.Fatalf("got %v after removing limit", r)
+	}
+}
@@ -0,0 +1,39 @@
+/*
+ * @Author: yujiaxun
+ * @Date: 2026-10-20 16:22:05
+ * @LastEditTime: 2026-10-20 16:22:05
+ * @Description: 连接层的监控指标
+ */
+
+package network
+
+import (
+	"test/metrics"
+)
+
+var (
+	connAccepted  = metrics.Default.Counter("gate_ws_connections_accepted_total", "WebSocket connections upgraded.").With()
+	connRejected  = metrics.Default.Counter("gate_ws_connections_rejected_total", "Connection attempts rejected before or during upgrade.", "reason")
+	connCurrent   = metrics.Default.Gauge("gate_ws_connections", "Current WebSocket connections.").With()
+	msgTotal      = metrics.Default.Counter("gate_ws_messages_total", "WebSocket data messages.", "dir")
+	bytesTotal    = metrics.Default.Counter("gate_ws_bytes_total", "WebSocket data message bytes.", "dir")
+	writeQueue    = metrics.Default.Gauge("gate_ws_write_queue", "Messages waiting in connection write queues.").With()
+	droppedTotal  = metrics.Default.Counter("gate_ws_dropped_total", "Messages dropped by the connection layer.", "reason")
+	closedTotal   = metrics.Default.Counter("gate_ws_closed_total", "Closed connections by reason.", "reason")
+	msgInTotal    = msgTotal.With("in")
+	msgOutTotal   = msgTotal.With("out")
+	bytesInTotal  = bytesTotal.With("in")
+	bytesOutTotal = bytesTotal.With("out")
+)
+
+func rejectReason(err error) string {
+	switch err {
+	case errMaxConn:
+		return "max_conn"
+	case errMaxIPConn:
+		return "max_ip_conn"
+	case errUpgradeRate:
+		return "upgrade_rate"
+	}
+	return "unknown"
+}
@@ -0,0 +1,79 @@
+/*
+ * @Author: yujiaxun
+ * @Date: 2026-10-22 17:35:12
+ * @LastEditTime: 2026-10-22 17:35:12
+ * @Description: xxx
+ */
+
+package network_test
+
+import (
+	"bytes"
+	"test/network"
+	"testing"
+)
+
+func TestMsgParser(t *testing.T) {
+	cases := []struct {
+		lenMsgLen    int
+		littleEndian bool
+		head         []byte //"hello world"的长度头
+	}{
+		{1, false, []byte{11}},
+		{2, false, []byte{0, 11}},
+		{2, true, []byte{11, 0}},
+		{4, false, []byte{0, 0, 0, 11}},
+		{4, true, []byte{11, 0, 0, 0}},
+	}
+	for _, c := range cases {
+		p := network.NewMsgParser()
+		p.SetMsgLen(c.lenMsgLen, 1, 1024)
+		p.SetByteOrder(c.littleEndian)
+		var buf bytes.Buffer
+		//多个参数拼成一条消息
+		if err := p.Write(&buf, []byte("hello"), []byte(" "), []byte("world")); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.HasPrefix(buf.Bytes(), c.head) {
+			t.Fatalf("len %v little %v: head %v", c.lenMsgLen, c.littleEndian, buf.Bytes()[:c.lenMsgLen])
+		}
+		data, err := p.Read(&buf)
+		if err != nil || string(data) != "hello world" {
+			t.Fatalf("len %v little %v: read %q %v", c.lenMsgLen, c.littleEndian, data, err)
+		}
+	}
+}
+
+func TestMsgParserLen(t *testing.T) {
+	p := network.NewMsgParser()
+	p.SetMsgLen(2, 2, 8)
+	var buf bytes.Buffer
+	if err := p.Write(&buf, []byte("x")); err == nil {
+		t.Fatal("write too short message should fail")
+	}
+	if err := p.Write(&buf, make([]byte, 9)); err == nil {
+		t.Fatal("write too long message should fail")
+	}
+	if buf.Len() != 0 {
+		t.Fatal("failed write should not write anything")
+	}
+	if _, err := p.Read(bytes.NewReader([]byte{0, 9})); err == nil {
+		t.Fatal("read too long message should fail")
+	}
+	if _, err := p.Read(bytes.NewReader([]byte{0, 1, 'x'})); err == nil {
+		t.Fatal("read too short message should fail")
+	}
+	//数据不完整
+	if _, err := p.Read(bytes.NewReader([]byte{0, 4, 'a', 'b'})); err == nil {
+		t.Fatal("read truncated message should fail")
+	}
+
+	//最大长度不能超过长度头能表示的范围
+	p.SetMsgLen(1, 0, 1000)
+	if err := p.Write(&buf, make([]byte, 255)); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Write(&buf, make([]byte, 256)); err == nil {
+		t.Fatal("message longer than 255 should fail with 1 byte len")
+	}
+}
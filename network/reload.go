@@ -0,0 +1,106 @@
+/*
+ * @Author: yujiaxun
+ * @Date: 2026-10-21 16:32:09
+ * @LastEditTime: 2026-10-21 16:32:09
+ * @Description: 运行时修改限流, Origin白名单和证书, 不影响已有的连接
+ */
+
+package network
+
+import (
+	"crypto/tls"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// SetRateLimits 修改上行限流, nil表示不限制, 已有的连接也会使用新的配置
+func (server *WSServer) SetRateLimits(conn *RateLimit, ip *RateLimit) {
+	server.Lock()
+	defer server.Unlock()
+	server.ConnRateLimit = conn
+	server.IPRateLimit = ip
+	for wsConn := range server.conns {
+		wsConn.limiter.SetLimit(conn)
+	}
+	for _, state := range server.ipStates {
+		if state.limiter != nil {
+			state.limiter.SetLimit(ip)
+		}
+	}
+}
+
+// SetConnLimits 修改每个ip的连接数和升级频率, 已有的连接不会断开
+func (server *WSServer) SetConnLimits(maxConnPerIP int, upgradePerSec float64, upgradeBurst int) {
+	server.Lock()
+	defer server.Unlock()
+	server.MaxConnPerIP = maxConnPerIP
+	server.UpgradePerSec = upgradePerSec
+	server.UpgradeBurst = upgradeBurst
+	for _, state := range server.ipStates {
+		state.upgrades = nil
+		if upgradePerSec > 0 {
+			state.upgrades = NewTokenBucket(upgradePerSec, upgradeBurst)
+		}
+	}
+}
+
+func (server *WSServer) connRateLimit() *RateLimit {
+	server.Lock()
+	defer server.Unlock()
+	return server.ConnRateLimit
+}
+
+func (server *WSServer) SetAllowedOrigins(origins []string) {
+	server.Lock()
+	server.AllowedOrigins = origins
+	server.Unlock()
+}
+
+// checkOrigin 浏览器发起的请求才有Origin头, 按AllowedOrigins检查
+func (server *WSServer) checkOrigin(r *http.Request) bool {
+	origin := strings.ToLower(r.Header.Get("Origin"))
+	server.Lock()
+	origins := server.AllowedOrigins
+	server.Unlock()
+	if origin == "" || len(origins) == 0 {
+		return true
+	}
+	for _, pattern := range origins {
+		pattern = strings.ToLower(pattern)
+		if pattern == origin {
+			return true
+		}
+		if ok, _ := path.Match(pattern, origin); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// ReloadCert 重新读取CertFile和KeyFile, 证书更新之后调用, 失败时继续使用旧证书
+func (server *WSServer) ReloadCert() error {
+	server.Lock()
+	certFile, keyFile := server.CertFile, server.KeyFile
+	server.Unlock()
+	return server.SetCertFiles(certFile, keyFile)
+}
+
+// SetCertFiles 修改证书文件并重新读取, 新的tls握手使用新证书
+func (server *WSServer) SetCertFiles(certFile, keyFile string) error {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return err
+	}
+	server.Lock()
+	server.CertFile, server.KeyFile = certFile, keyFile
+	server.cert = &cert
+	server.Unlock()
+	return nil
+}
+
+func (server *WSServer) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	server.Lock()
+	defer server.Unlock()
+	return server.cert, nil
+}
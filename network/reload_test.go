@@ -0,0 +1,251 @@
+/*
+ * @Author: yujiaxun
+ * @Date: 2026-10-22 12:10:26
+ * @LastEditTime: 2026-10-22 12:10:26
+ * @Description: xxx
+ */
+
+package network_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"test/network"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func startWSServer(t *testing.T, wsServer *network.WSServer) {
+	if wsServer.Addr == "" {
+		wsServer.Addr = "127.0.0.1:0"
+	}
+	if wsServer.ReadBufferSize == 0 {
+		wsServer.ReadBufferSize = 1024
+		wsServer.WriteBufferSize = 1024
+	}
+	wsServer.Init()
+	done := make(chan error, 1)
+	go func() {
+		done <- wsServer.Serve(context.Background())
+	}()
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		wsServer.Shutdown(ctx)
+		<-done
+	})
+}
+
+func TestSetRateLimits(t *testing.T) {
+	conns := make(chan *network.WSConn, 1)
+	wsServer := &network.WSServer{
+		NewAgent: func(wsConn *network.WSConn) network.Agent {
+			conns <- wsConn
+			return nil
+		},
+	}
+	startWSServer(t, wsServer)
+	client := dialWS(t, wsServer)
+	defer client.Close()
+	wsConn := <-conns
+
+	for i := 0; i < 5; i++ {
+		client.WriteMessage(websocket.BinaryMessage, []byte("x"))
+	}
+	for i := 0; i < 5; i++ {
+		if _, err := wsConn.ReadMsg(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	//已有的连接也使用新的限流
+	wsServer.SetRateLimits(&network.RateLimit{MsgPerSec: 0.001, MsgBurst: 1, Action: network.ActionBan, BanTime: time.Minute}, nil)
+	for i := 0; i < 3; i++ {
+		client.WriteMessage(websocket.BinaryMessage, []byte("x"))
+	}
+	client.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, _, err := client.ReadMessage()
+	if !websocket.IsCloseError(err, websocket.ClosePolicyViolation) {
+		t.Fatalf("expect policy violation close, got %v", err)
+	}
+	if !wsServer.BanList.IsBanned("127.0.0.1") {
+		t.Fatal("ip should be banned")
+	}
+}
+
+func TestCheckOrigin(t *testing.T) {
+	wsServer := &network.WSServer{AllowedOrigins: []string{"https://*.example.com", "https://game.test"}}
+	startWSServer(t, wsServer)
+	waitListen(t, wsServer)
+	url := "ws://" + wsServer.ListenAddr().String() + "/"
+
+	cases := []struct {
+		origin string
+		ok     bool
+	}{
+		{"", true}, //不是浏览器发起的
+		{"https://a.example.com", true},
+		{"HTTPS://B.EXAMPLE.COM", true},
+		{"https://game.test", true},
+		{"https://example.com", false},
+		{"http://a.example.com", false},
+		{"https://evil.test", false},
+	}
+	for _, c := range cases {
+		header := http.Header{}
+		if c.origin != "" {
+			header.Set("Origin", c.origin)
+		}
+		conn, resp, err := websocket.DefaultDialer.Dial(url, header)
+		if c.ok {
+			if err != nil {
+				t.Fatalf("origin %q: %v", c.origin, err)
+			}
+			conn.Close()
+			continue
+		}
+		if err == nil || resp == nil || resp.StatusCode != http.StatusForbidden {
+			t.Fatalf("origin %q should be rejected, got %v", c.origin, err)
+		}
+	}
+
+	wsServer.SetAllowedOrigins(nil)
+	conn, _, err := websocket.DefaultDialer.Dial(url, http.Header{"Origin": {"https://evil.test"}})
+	if err != nil {
+		t.Fatalf("empty AllowedOrigins should allow all: %v", err)
+	}
+	conn.Close()
+}
+
+// writeCert 生成自签名证书, 返回证书和私钥文件
+func writeCert(t *testing.T, dir string, name string) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile := filepath.Join(dir, name+".crt")
+	keyFile := filepath.Join(dir, name+".key")
+	os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600)
+	return certFile, keyFile
+}
+
+func waitListen(t *testing.T, wsServer *network.WSServer) {
+	for i := 0; i < 100 && wsServer.ListenAddr() == nil; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if wsServer.ListenAddr() == nil {
+		t.Fatal("server is not listening")
+	}
+}
+
+func TestSetCertFiles(t *testing.T) {
+	dir := t.TempDir()
+	cert1, key1 := writeCert(t, dir, "gate1")
+	cert2, key2 := writeCert(t, dir, "gate2")
+	wsServer := &network.WSServer{HttpsFlag: true, CertFile: cert1, KeyFile: key1}
+	startWSServer(t, wsServer)
+	waitListen(t, wsServer)
+	addr := wsServer.ListenAddr().String()
+
+	serverName := func() string {
+		conn, err := tls.Dial("tcp", addr, &tls.Config{InsecureSkipVerify: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		return conn.ConnectionState().PeerCertificates[0].Subject.CommonName
+	}
+	if name := serverName(); name != "gate1" {
+		t.Fatalf("got cert %v", name)
+	}
+	if err := wsServer.SetCertFiles(cert2, key2); err != nil {
+		t.Fatal(err)
+	}
+	if name := serverName(); name != "gate2" {
+		t.Fatalf("got cert %v after reload", name)
+	}
+	//读取失败时继续使用旧证书
+	if err := wsServer.SetCertFiles(filepath.Join(dir, "missing.crt"), key1); err == nil {
+		t.Fatal("set missing cert should fail")
+	}
+	if name := serverName(); name != "gate2" {
+		t.Fatalf("got cert %v after failed reload", name)
+	}
+}
+
+func TestThrottle(t *testing.T) {
+	conns := make(chan *network.WSConn, 1)
+	wsServer := &network.WSServer{
+		ConnRateLimit: &network.RateLimit{MsgPerSec: 10, MsgBurst: 1, Action: network.ActionThrottle},
+		NewAgent: func(wsConn *network.WSConn) network.Agent {
+			conns <- wsConn
+			return nil
+		},
+	}
+	startWSServer(t, wsServer)
+	client := dialWS(t, wsServer)
+	defer client.Close()
+	wsConn := <-conns
+
+	pong := make(chan bool, 1)
+	client.SetPongHandler(func(string) error {
+		pong <- true
+		return nil
+	})
+	go func() {
+		for {
+			if _, _, err := client.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		client.WriteMessage(websocket.BinaryMessage, []byte{byte(i)})
+	}
+	//限流等待期间仍然处理心跳
+	client.WriteControl(websocket.PingMessage, nil, time.Now().Add(time.Second))
+	select {
+	case <-pong:
+	case <-time.After(200 * time.Millisecond):
+		t.Fatal("ping is blocked by throttle")
+	}
+	//延后的消息按顺序送达
+	for i := 0; i < 5; i++ {
+		data, err := wsConn.ReadMsg()
+		if err != nil || data[0] != byte(i) {
+			t.Fatalf("read %v %v, want %v", data, err, i)
+		}
+	}
+	if d := time.Since(start); d < 350*time.Millisecond {
+		t.Fatalf("5 messages at 10/s read in %v", d)
+	}
+}
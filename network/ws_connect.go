@@ -8,8 +8,10 @@
 package network
 
 import (
+	"context"
 	"errors"
 	"net"
+	"net/http"
 	"sync"
 	"test/logger"
 	"time"
@@ -25,19 +27,39 @@ type WSConn struct {
 	readChan  chan []byte //写消息缓冲区
 	maxMsgLen uint32
 	closeFlag bool
+	closing   bool   //已经请求关闭, 等待WritePump发送关闭帧
+	closeCode int    //关闭帧的状态码
+	closeText string //关闭帧的原因
 	connId    int
+	request   *http.Request //升级时的http请求, 上层可以从中取参数
+	ip        string
+	limiter   *Limiter      //连接的限流
+	ipLimiter *Limiter      //ip的限流, 同一个ip的连接共享
+	onPong    func()        //收到pong时调用, 上层用来刷新在线状态
+	reason    CloseReason   //关闭的原因
 	PongWait  time.Duration //心跳检测时间
+	ctx       context.Context
+	cancel    context.CancelFunc
+	delayed   []delayedMsg //限流等待中的消息, 到时间后按顺序放进readChan
+	dueTimer  *time.Timer  //delayed里第一条消息到时间时触发
 }
 
-func newWsConn(conn *websocket.Conn, pendingWriteNum int, maxMsgLen uint32, pendingReadNum int, connId int, server *WSServer) *WSConn {
+type delayedMsg struct {
+	data []byte
+	due  time.Time
+}
+
+func newWsConn(conn *websocket.Conn, pendingWriteNum int, maxMsgLen uint32, pendingReadNum int, connId int, server *WSServer, request *http.Request) *WSConn {
 	wsConn := new(WSConn)
 	wsConn.conn = conn
+	wsConn.request = request
 	wsConn.writeChan = make(chan []byte, pendingWriteNum)
 	wsConn.readChan = make(chan []byte, pendingReadNum)
 	wsConn.maxMsgLen = maxMsgLen
 	wsConn.connId = connId
 	wsConn.server = server
 	wsConn.PongWait = server.PongWait
+	wsConn.ctx, wsConn.cancel = context.WithCancel(context.Background())
 	return wsConn
 }
 
@@ -51,6 +73,12 @@ func (wsConn *WSConn) ReadPump() {
 	wsConn.conn.SetPongHandler(func(string) error {
 		logger.Debug("connect %v receive PongMsg", wsConn.connId)
 		wsConn.conn.SetReadDeadline(time.Now().Add(wsConn.PongWait))
+		wsConn.Lock()
+		onPong := wsConn.onPong
+		wsConn.Unlock()
+		if onPong != nil {
+			onPong()
+		}
 		return nil
 	})
 	wsConn.conn.SetPingHandler(func(string) error {
@@ -62,15 +90,152 @@ func (wsConn *WSConn) ReadPump() {
 		_, data, err := wsConn.conn.ReadMessage()
 		if err != nil {
 			logger.Debug("connect %v close ReadPump, read fail, err %v", wsConn.connId, err)
+			wsConn.setReason(readErrorReason(err))
 			break
 		}
+		msgInTotal.Inc()
+		bytesInTotal.Add(float64(len(data)))
+		ok, wait := wsConn.checkLimit(wsConn.limiter, len(data))
+		if !ok {
+			continue
+		}
+		ok, ipWait := wsConn.checkLimit(wsConn.ipLimiter, len(data))
+		if !ok {
+			//连接的限流已经取了令牌, 退还
+			if wsConn.limiter != nil {
+				wsConn.limiter.Refund(len(data))
+			}
+			continue
+		}
+		if ipWait > wait {
+			wait = ipWait
+		}
+		if !wsConn.push(data, wait) {
+			break
+		}
+	}
+}
+
+// push 把消息放进readChan, wait大于0时延后放入, 返回false时ReadPump退出
+// 限流等待期间继续读取, 心跳和关闭帧不受影响
+func (wsConn *WSConn) push(data []byte, wait time.Duration) bool {
+	//加锁防止写入时readChan被其他协程关闭
+	wsConn.Lock()
+	if wsConn.closeFlag {
+		wsConn.Unlock()
+		return false
+	}
+	if wsConn.closing {
+		//正在关闭, 不再处理新消息
+		wsConn.Unlock()
+		droppedTotal.With("closing").Inc()
+		wsConn.refund(len(data))
+		return true
+	}
+	if wait > 0 || len(wsConn.delayed) > 0 {
+		//前面有消息在等待时也要排队, 保证顺序
+		if len(wsConn.delayed) >= cap(wsConn.readChan) {
+			wsConn.Unlock()
+			logger.Debug("connect %v throttle queue is full, drop msg", wsConn.connId)
+			droppedTotal.With("rate_limit").Inc()
+			wsConn.refund(len(data))
+			return true
+		}
+		due := time.Now().Add(wait)
+		if n := len(wsConn.delayed); n > 0 && due.Before(wsConn.delayed[n-1].due) {
+			due = wsConn.delayed[n-1].due
+		}
+		wsConn.delayed = append(wsConn.delayed, delayedMsg{data: data, due: due})
+		if wsConn.dueTimer == nil {
+			wsConn.dueTimer = time.AfterFunc(time.Until(wsConn.delayed[0].due), wsConn.flushDelayed)
+		}
+		wsConn.Unlock()
+		return true
+	}
+	if len(wsConn.readChan) == cap(wsConn.readChan) {
+		wsConn.Unlock()
+		logger.Debug("connect %v close ReadPump, readChan is full", wsConn.connId)
+		wsConn.setReason(CloseReadQueueFull)
+		return false
+	}
+	logger.Debug("connect %v receive data %v", wsConn.connId, data)
+	wsConn.readChan <- data
+	wsConn.Unlock()
+	return true
+}
+
+// flushDelayed 把到时间的消息放进readChan, 还有等待的消息时继续定时
+func (wsConn *WSConn) flushDelayed() {
+	wsConn.Lock()
+	wsConn.dueTimer = nil
+	if wsConn.closeFlag || wsConn.closing {
+		wsConn.delayed = nil
+		wsConn.Unlock()
+		return
+	}
+	now := time.Now()
+	full := false
+	for len(wsConn.delayed) > 0 && !wsConn.delayed[0].due.After(now) {
 		if len(wsConn.readChan) == cap(wsConn.readChan) {
-			logger.Debug("connect %v close ReadPump, readChan is full", wsConn.connId)
+			full = true
 			break
 		}
-		logger.Debug("connect %v receive data %v", wsConn.connId, data)
-		wsConn.readChan <- data
+		wsConn.readChan <- wsConn.delayed[0].data
+		wsConn.delayed = wsConn.delayed[1:]
+	}
+	if !full && len(wsConn.delayed) > 0 {
+		wsConn.dueTimer = time.AfterFunc(wsConn.delayed[0].due.Sub(now), wsConn.flushDelayed)
+	}
+	wsConn.Unlock()
+	if full {
+		logger.Debug("connect %v readChan is full", wsConn.connId)
+		wsConn.setReason(CloseReadQueueFull)
+		wsConn.Close()
+	}
+}
+
+// refund 消息通过限流后被丢弃, 退还连接和ip限流取走的令牌
+func (wsConn *WSConn) refund(n int) {
+	if wsConn.limiter != nil {
+		wsConn.limiter.Refund(n)
+	}
+	if wsConn.ipLimiter != nil {
+		wsConn.ipLimiter.Refund(n)
+	}
+}
+
+// checkLimit 上行限流, 返回false时丢弃这条消息, wait大于0时需要延后处理
+func (wsConn *WSConn) checkLimit(limiter *Limiter, n int) (bool, time.Duration) {
+	if limiter == nil {
+		return true, 0
+	}
+	result, wait := limiter.Check(n)
+	switch result {
+	case LimitDelay:
+		return true, wait
+	case LimitDiscard:
+		logger.Debug("connect %v exceed rate limit, drop msg", wsConn.connId)
+		droppedTotal.With("rate_limit").Inc()
+		return false, 0
+	case LimitWarn:
+		logger.Release("connect %v[%v] exceed rate limit, warning", wsConn.connId, wsConn.ip)
+		droppedTotal.With("rate_limit").Inc()
+		return false, 0
+	case LimitKick:
+		logger.Release("connect %v[%v] exceed rate limit, kick", wsConn.connId, wsConn.ip)
+		wsConn.CloseWithCode(websocket.ClosePolicyViolation, "rate limit")
+		return false, 0
+	case LimitBanned:
+		logger.Release("connect %v[%v] exceed rate limit, ban", wsConn.connId, wsConn.ip)
+		var banTime time.Duration
+		if limit := limiter.Limit(); limit != nil {
+			banTime = limit.BanTime
+		}
+		wsConn.server.BanList.Ban(wsConn.ip, banTime, "rate limit")
+		wsConn.CloseWithCode(websocket.ClosePolicyViolation, "rate limit")
+		return false, 0
 	}
+	return true, 0
 }
 
 func (wsConn *WSConn) WritePump() {
@@ -78,40 +243,68 @@ func (wsConn *WSConn) WritePump() {
 	defer func() {
 		ticker.Stop()
 		wsConn.Close()
+		//Close之后writeChan已经关闭, 没发出去的消息不再计入队列长度
+		for msg := range wsConn.writeChan {
+			if msg != nil {
+				writeQueue.Dec()
+			}
+		}
 	}()
 	logger.Debug("connect %v start writePump", wsConn.connId)
 	//从writeChan中获取要写的消息，如果是nil，表示主动关闭
-	select {
-	case msg, ok := <-wsConn.writeChan:
-		if !ok {
-			logger.Debug("connect %v close WritePump, writeChan is closed", wsConn.connId)
-			//writeChan已经关闭
-			return
-		}
-		if msg == nil {
-			logger.Debug("connect %v close WritePump, receive close msg", wsConn.connId)
-			//TODO 连接正在关闭记log
-			return
-		}
-		wsConn.conn.SetWriteDeadline(time.Now().Add(wsConn.PongWait))
-		err := wsConn.conn.WriteMessage(websocket.BinaryMessage, msg)
-		if err != nil {
-			logger.Debug("connect %v close WritePump, write fail", wsConn.connId)
-			//TODO 写消息失败，记log
-			break
-		}
-	case <-ticker.C:
-		wsConn.conn.SetWriteDeadline(time.Now().Add(wsConn.PongWait))
-		if err := wsConn.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
-			return
+	for {
+		select {
+		case msg, ok := <-wsConn.writeChan:
+			if !ok {
+				logger.Debug("connect %v close WritePump, writeChan is closed", wsConn.connId)
+				//writeChan已经关闭
+				return
+			}
+			if msg == nil {
+				logger.Debug("connect %v close WritePump, receive close msg", wsConn.connId)
+				wsConn.writeCloseFrame()
+				return
+			}
+			writeQueue.Dec()
+			wsConn.conn.SetWriteDeadline(time.Now().Add(wsConn.PongWait))
+			err := wsConn.conn.WriteMessage(websocket.BinaryMessage, msg)
+			if err != nil {
+				logger.Debug("connect %v close WritePump, write fail, err %v", wsConn.connId, err)
+				wsConn.setReason(CloseWriteError)
+				return
+			}
+			msgOutTotal.Inc()
+			bytesOutTotal.Add(float64(len(msg)))
+		case <-ticker.C:
+			wsConn.conn.SetWriteDeadline(time.Now().Add(wsConn.PongWait))
+			if err := wsConn.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				wsConn.setReason(CloseWriteError)
+				return
+			}
+			logger.Debug("connect %v send PingMsg", wsConn.connId)
 		}
-		logger.Debug("connect %v send PingMsg", wsConn.connId)
+	}
+}
+
+func (wsConn *WSConn) writeCloseFrame() {
+	wsConn.Lock()
+	code, text := wsConn.closeCode, wsConn.closeText
+	wsConn.Unlock()
+	if code == 0 {
+		return
+	}
+	deadline := time.Now().Add(wsConn.PongWait)
+	err := wsConn.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, text), deadline)
+	if err != nil {
+		logger.Debug("connect %v write close frame fail, err %v", wsConn.connId, err)
 	}
 }
 
 //将消息安全地写入writeChan
 func (wsConn *WSConn) WriteMsg(msg []byte) error {
-	if wsConn.closeFlag {
+	wsConn.Lock()
+	defer wsConn.Unlock()
+	if wsConn.closeFlag || wsConn.closing {
 		//连接已关闭
 		return errors.New("conn is closed")
 	}
@@ -122,14 +315,19 @@ func (wsConn *WSConn) WriteMsg(msg []byte) error {
 	//这样可以防止writeChan满了导致卡住
 	select {
 	case wsConn.writeChan <- msg:
+		writeQueue.Inc()
 		return nil
 	default:
+		droppedTotal.With("write_queue_full").Inc()
 		return errors.New("channel is full")
 	}
 }
 
 func (wsConn *WSConn) ReadMsg() ([]byte, error) {
-	if wsConn.closeFlag {
+	wsConn.Lock()
+	closeFlag := wsConn.closeFlag
+	wsConn.Unlock()
+	if closeFlag {
 		//连接已关闭
 		return nil, errors.New("conn is closed")
 	}
@@ -147,6 +345,50 @@ func (wsConn *WSConn) RemoteAddr() net.Addr {
 	return wsConn.conn.RemoteAddr()
 }
 
+//升级成websocket时的http请求
+func (wsConn *WSConn) Request() *http.Request {
+	return wsConn.request
+}
+
+func (wsConn *WSConn) PendingWrite() int {
+	return len(wsConn.writeChan)
+}
+
+// Context 连接关闭时取消, 处理消息时可以用它中止已经断开的客户端的请求
+func (wsConn *WSConn) Context() context.Context {
+	return wsConn.ctx
+}
+
+// SetOnPong 设置收到pong时的回调, 在ReadPump协程里调用
+func (wsConn *WSConn) SetOnPong(f func()) {
+	wsConn.Lock()
+	wsConn.onPong = f
+	wsConn.Unlock()
+}
+
+//等writeChan里的消息发完, 再发送关闭帧并关闭连接, code为websocket的关闭码
+func (wsConn *WSConn) CloseWithCode(code int, text string) {
+	wsConn.Lock()
+	if wsConn.closeFlag || wsConn.closing {
+		wsConn.Unlock()
+		return
+	}
+	wsConn.closing = true
+	wsConn.closeCode = code
+	wsConn.closeText = text
+	if wsConn.reason == "" {
+		wsConn.reason = CloseKicked
+	}
+	select {
+	case wsConn.writeChan <- nil:
+		wsConn.Unlock()
+	default:
+		//writeChan满了, 直接关闭
+		wsConn.Unlock()
+		wsConn.Close()
+	}
+}
+
 func (wsConn *WSConn) Close() {
 	defer func() {
 		wsConn.Unlock()
@@ -156,11 +398,44 @@ func (wsConn *WSConn) Close() {
 		return
 	}
 	wsConn.closeFlag = true
+	wsConn.cancel()
+	if wsConn.dueTimer != nil {
+		wsConn.dueTimer.Stop()
+		wsConn.dueTimer = nil
+	}
+	wsConn.delayed = nil
 	wsConn.conn.Close()
 	//关闭readChan, 上层的agent就会关闭
 	//关闭writeChan, WritePump就会关闭
 	close(wsConn.readChan)
 	close(wsConn.writeChan)
-	wsConn.server.unregisterChan <- wsConn
-	logger.Debug("connect %v close", wsConn.connId)
+	wsConn.server.releaseConn(wsConn.ip)
+	wsConn.server.unregister(wsConn)
+	if wsConn.reason == "" {
+		wsConn.reason = CloseByServer
+	}
+	connCurrent.Dec()
+	closedTotal.With(string(wsConn.reason)).Inc()
+	logger.Debug("connect %v close, reason %v", wsConn.connId, wsConn.reason)
+}
+
+// setReason 记录连接关闭的原因, 已经有原因时不覆盖
+func (wsConn *WSConn) setReason(reason CloseReason) {
+	wsConn.Lock()
+	if wsConn.reason == "" {
+		wsConn.reason = reason
+	}
+	wsConn.Unlock()
+}
+
+// SetCloseReason 关闭之前由上层设置原因, 例如消息无法解析时设置CloseProtocolError, 已经有原因时不覆盖
+func (wsConn *WSConn) SetCloseReason(reason CloseReason) {
+	wsConn.setReason(reason)
+}
+
+// CloseReason 连接关闭的原因, 还没有关闭时可能为空
+func (wsConn *WSConn) CloseReason() CloseReason {
+	wsConn.Lock()
+	defer wsConn.Unlock()
+	return wsConn.reason
 }
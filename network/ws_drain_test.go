@@ -0,0 +1,85 @@
+/*
+ * @Author: yujiaxun
+ * @Date: 2026-10-20 20:41:06
+ * @LastEditTime: 2026-10-20 20:41:06
+ * @Description: xxx
+ */
+
+package network_test
+
+import (
+	"net"
+	"net/http"
+	"test/network"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func freeAddr(t *testing.T) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	return ln.Addr().String()
+}
+
+func TestWSServerDrain(t *testing.T) {
+	conns := make(chan *network.WSConn, 1)
+	wsServer := &network.WSServer{
+		Addr:            freeAddr(t),
+		MaxConnNum:      10,
+		PendingWriteNum: 10,
+		PendingReadNum:  10,
+		ReadBufferSize:  1024,
+		WriteBufferSize: 1024,
+		PongWait:        10 * time.Second,
+		NewAgent: func(wsConn *network.WSConn) network.Agent {
+			conns <- wsConn
+			return nil
+		},
+	}
+	wsServer.Init()
+	go wsServer.Start()
+
+	url := "ws://" + wsServer.Addr + "/"
+	var client *websocket.Conn
+	var err error
+	for i := 0; i < 50; i++ {
+		if client, _, err = websocket.DefaultDialer.Dial(url, nil); err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	wsConn := <-conns
+
+	//排空之前写进队列的消息要先发出去
+	wsConn.WriteMsg([]byte("hello"))
+	wsServer.Drain(websocket.CloseGoingAway, "reconnect to gate2", time.Second)
+	if n := wsServer.ConnNum(); n != 0 {
+		t.Fatalf("connNum %v after drain", n)
+	}
+
+	_, data, err := client.ReadMessage()
+	if err != nil || string(data) != "hello" {
+		t.Fatalf("read %q, %v", data, err)
+	}
+	_, _, err = client.ReadMessage()
+	if !websocket.IsCloseError(err, websocket.CloseGoingAway) {
+		t.Fatalf("expect going away close, got %v", err)
+	}
+	if text := err.(*websocket.CloseError).Text; text != "reconnect to gate2" {
+		t.Fatalf("close text %q", text)
+	}
+
+	_, resp, err := websocket.DefaultDialer.Dial(url, nil)
+	if err == nil || resp == nil || resp.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("dial while draining: %v", err)
+	}
+}
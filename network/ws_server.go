@@ -8,7 +8,11 @@
 package network
 
 import (
+	"context"
+	"crypto/tls"
+	"errors"
 	"log"
+	"net"
 	"net/http"
 	"sync"
 	"test/logger"
@@ -29,13 +33,31 @@ type WSServer struct {
 	ReadBufferSize  int
 	WriteBufferSize int
 	HttpsFlag       bool
-	conns           map[*WSConn]bool //连接中的客户端
-	unregisterChan  chan *WSConn
-	registerChan    chan *WSConn
+	conns           map[*WSConn]bool //连接中的客户端, 由server的锁保护
 	CloseChan       chan bool
 	ClientsWG       sync.WaitGroup
 	curConnectId    int           //当前的conn的id
 	PongWait        time.Duration //心跳检测时间
+	DrainTimeout    time.Duration //关闭时等待写队列发完的时间, 超时后强制关闭, 默认10秒
+	ConnRateLimit   *RateLimit    //每个连接的上行限流
+	IPRateLimit     *RateLimit    //同一个ip所有连接共享的上行限流
+	MaxConnPerIP    int           //每个ip最多的连接数, 0表示不限制
+	UpgradePerSec   float64       //每个ip每秒最多升级的次数, 0表示不限制
+	UpgradeBurst    int           //升级频率的突发量
+	BanList         *BanList      //封禁的ip, 升级之前检查
+	connNum         int           //已经占用的连接数, 包括正在升级的
+	ipStates        map[string]*ipState
+	lastSweep       time.Time
+	draining        bool         //不再接受新连接
+	listening       bool         //监听已经建立
+	Listener        net.Listener //外部创建的监听, 例如热重启时从父进程继承的, 设置后不再监听Addr
+	stopAccept      bool         //主动关闭了监听, Serve返回的错误不用处理
+	ReadyCheck      func() error //readyz时调用, 返回错误表示还不能接收流量, 例如后端不可用
+	AllowedOrigins  []string     //允许的Origin, 支持*通配符, 为空时不检查, 没有Origin头的请求不检查
+	cert            *tls.Certificate
+	httpServer      *http.Server
+	shutdown        bool          //Shutdown已经完成
+	shutdownDone    chan struct{} //Shutdown完成后关闭, Serve随之返回
 	sync.Mutex
 }
 
@@ -52,93 +74,392 @@ func (server *WSServer) genConnId() int {
 }
 
 func (server *WSServer) Init() {
-	server.registerChan = make(chan *WSConn, server.MaxConnNum*2)
-	server.unregisterChan = make(chan *WSConn, server.MaxConnNum*2)
+	if server.MaxConnNum <= 0 {
+		server.MaxConnNum = 100
+		logger.Release("invalid MaxConnNum, reset to %v", server.MaxConnNum)
+	}
+	if server.PendingWriteNum <= 0 {
+		server.PendingWriteNum = 100
+		logger.Release("invalid PendingWriteNum, reset to %v", server.PendingWriteNum)
+	}
+	if server.PendingReadNum <= 0 {
+		server.PendingReadNum = 100
+		logger.Release("invalid PendingReadNum, reset to %v", server.PendingReadNum)
+	}
+	if server.PongWait <= 0 {
+		//为0时心跳的ticker会panic, 读超时也会立刻触发
+		server.PongWait = 60 * time.Second
+		logger.Release("invalid PongWait, reset to %v", server.PongWait)
+	}
 	server.CloseChan = make(chan bool, 1)
+	server.shutdownDone = make(chan struct{})
 	server.conns = make(map[*WSConn]bool)
+	server.ipStates = make(map[string]*ipState)
+	if server.BanList == nil {
+		server.BanList = NewBanList()
+	}
+	if server.DrainTimeout <= 0 {
+		server.DrainTimeout = 10 * time.Second
+	}
 	server.curConnectId = 0
 }
 
+// Start 阻塞到CloseChan收到值并且连接都关闭, 监听失败时退出进程
+// 需要处理错误时用Serve和Shutdown
 func (server *WSServer) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-server.CloseChan:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	if err := server.Serve(ctx); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// Serve 监听Addr并处理连接, 阻塞到ctx取消或者Shutdown完成
+// ctx取消时按DrainTimeout排空连接, 监听失败或者证书加载失败时返回错误
+func (server *WSServer) Serve(ctx context.Context) error {
+	if server.conns == nil {
+		server.Init()
+	}
+	httpServer, ln, err := server.listen()
+	if err != nil {
+		return err
+	}
+	serveErr := make(chan error, 1)
+	go func() {
+		if server.HttpsFlag {
+			serveErr <- httpServer.ServeTLS(ln, "", "")
+		} else {
+			serveErr <- httpServer.Serve(ln)
+		}
+	}()
+	for {
+		select {
+		case err := <-serveErr:
+			serveErr = nil
+			if server.acceptStopped() {
+				//StopAccept或者Shutdown关闭了监听, 已有的连接还要继续处理
+				continue
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), server.DrainTimeout)
+			server.Shutdown(ctx)
+			cancel()
+			return err
+		case <-server.shutdownDone:
+			return nil
+		case <-ctx.Done():
+			ctx, cancel := context.WithTimeout(context.Background(), server.DrainTimeout)
+			server.Shutdown(ctx)
+			cancel()
+			return nil
+		}
+	}
+}
 
+// listen 建立监听, readyz要等监听成功之后才返回ready
+func (server *WSServer) listen() (*http.Server, net.Listener, error) {
 	serverMux := http.NewServeMux()
 	serverMux.HandleFunc("/", server.handleRequest)
+	serverMux.HandleFunc("/healthz", server.handleHealth)
+	serverMux.HandleFunc("/readyz", server.handleReady)
 	httpServer := &http.Server{Addr: server.Addr, Handler: serverMux}
-	logger.Debug("ws server start, addr %v", server.Addr)
 	if server.HttpsFlag {
 		// HTTPS服务器
 		// cert.pem和key.pem是自己生成的证书和私钥文件
 		logger.Debug("open https")
-		go func() {
-			err := httpServer.ListenAndServeTLS(server.CertFile, server.KeyFile)
-			if err != nil {
-				log.Fatal(err)
-			}
-		}()
+		if err := server.ReloadCert(); err != nil {
+			return nil, nil, err
+		}
+		//证书通过GetCertificate获取, ReloadCert之后新的握手使用新证书
+		httpServer.TLSConfig = &tls.Config{GetCertificate: server.getCertificate}
+	}
+	ln := server.Listener
+	if ln == nil {
+		var err error
+		ln, err = net.Listen("tcp", server.Addr)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	server.Lock()
+	defer server.Unlock()
+	if server.stopAccept {
+		ln.Close()
+		return nil, nil, http.ErrServerClosed
+	}
+	server.Listener = ln
+	server.httpServer = httpServer
+	server.listening = true
+	logger.Debug("ws server start, addr %v", ln.Addr())
+	return httpServer, ln, nil
+}
 
-	} else {
-		go func() {
-			err := httpServer.ListenAndServe()
-			if err != nil {
-				log.Fatal(err)
-			}
-		}()
+// ListenAddr 实际监听的地址, Addr的端口为0时可以用它取得分配的端口, 还没有监听时返回nil
+func (server *WSServer) ListenAddr() net.Addr {
+	server.Lock()
+	defer server.Unlock()
+	if server.Listener == nil {
+		return nil
 	}
+	return server.Listener.Addr()
+}
 
-	go func() {
-		for {
-			select {
-			case wsConn := <-server.unregisterChan:
-				delete(server.conns, wsConn)
-				logger.Debug("a connection:%v[%v] is closed, leftNum %v", wsConn.connId, wsConn.RemoteAddr(), len(server.conns))
-				server.ClientsWG.Done()
-				if len(server.conns) == 0 {
-					logger.Debug("all connection is closed")
-					return
-				}
-			case wsConn := <-server.registerChan:
-				server.conns[wsConn] = true
-				server.ClientsWG.Add(1)
-				logger.Debug("new connection:%v[%v] is established, connNum: %v", wsConn.connId, wsConn.RemoteAddr(), len(server.conns))
-			}
-		}
-	}()
-	server.Close()
+// register 记录新连接, 已经在排空时返回false
+func (server *WSServer) register(wsConn *WSConn) bool {
+	server.Lock()
+	defer server.Unlock()
+	if server.draining {
+		return false
+	}
+	server.conns[wsConn] = true
+	server.ClientsWG.Add(1)
+	logger.Debug("new connection:%v[%v] is established, connNum: %v", wsConn.connId, wsConn.RemoteAddr(), len(server.conns))
+	return true
 }
 
-func (server *WSServer) Close() {
-	<-server.CloseChan
-	for client := range server.conns {
-		client.Close()
+// unregister 连接关闭时调用, 每个连接只会Done一次
+func (server *WSServer) unregister(wsConn *WSConn) {
+	server.Lock()
+	defer server.Unlock()
+	if !server.conns[wsConn] {
+		return
 	}
-	logger.Debug("start close server, connNum: %v", len(server.conns))
+	delete(server.conns, wsConn)
+	server.ClientsWG.Done()
+	logger.Debug("a connection:%v[%v] is closed, leftNum %v", wsConn.connId, wsConn.RemoteAddr(), len(server.conns))
+	if len(server.conns) == 0 {
+		logger.Debug("all connection is closed")
+	}
+}
+
+func (server *WSServer) connList() []*WSConn {
+	server.Lock()
+	defer server.Unlock()
+	conns := make([]*WSConn, 0, len(server.conns))
+	for wsConn := range server.conns {
+		conns = append(conns, wsConn)
+	}
+	return conns
+}
+
+func (server *WSServer) ConnNum() int {
+	server.Lock()
+	defer server.Unlock()
+	return len(server.conns)
+}
+
+// Shutdown 关闭监听, 给所有连接发送关闭帧, 等写队列里的消息发完之后断开
+// ctx到期时强制关闭剩下的连接并返回ctx的错误, Serve在Shutdown完成之后返回
+func (server *WSServer) Shutdown(ctx context.Context) error {
+	logger.Debug("start close server, connNum: %v", server.ConnNum())
+	server.StopAccept()
+	server.Lock()
+	httpServer := server.httpServer
+	server.Unlock()
+	if httpServer != nil {
+		//同时关掉还在处理的http请求, 例如readyz
+		httpServer.Close()
+	}
+	forced := server.drain(ctx, websocket.CloseGoingAway, "server shutdown")
 	server.ClientsWG.Wait()
+	server.Lock()
+	if !server.shutdown && server.shutdownDone != nil {
+		server.shutdown = true
+		close(server.shutdownDone)
+	}
+	server.Unlock()
+	if forced > 0 {
+		return ctx.Err()
+	}
 	logger.Debug("server closed gracefully")
+	return nil
+}
+
+// Close 按DrainTimeout关闭服务器, 阻塞到连接都关闭
+//
+// Deprecated: 使用Shutdown, 可以用ctx控制等待的时间并拿到错误
+func (server *WSServer) Close() {
+	ctx, cancel := context.WithTimeout(context.Background(), server.DrainTimeout)
+	defer cancel()
+	server.Shutdown(ctx)
+}
+
+// Drain 不再接受新连接, 给所有连接发送code和text的关闭帧
+// 关闭帧排在写队列的最后, 等队列里的消息发完之后才断开, 超过timeout还没断开的连接强制关闭
+func (server *WSServer) Drain(code int, text string, timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	server.drain(ctx, code, text)
+}
+
+// drain 排空连接直到ctx到期, 返回强制关闭的连接数
+func (server *WSServer) drain(ctx context.Context, code int, text string) int {
+	server.SetDraining(true)
+	for _, wsConn := range server.connList() {
+		wsConn.setReason(CloseShutdown)
+		wsConn.CloseWithCode(code, text)
+	}
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+	for server.ConnNum() > 0 && ctx.Err() == nil {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+		}
+	}
+	conns := server.connList()
+	if len(conns) > 0 {
+		logger.Release("drain timeout, force close %v connections", len(conns))
+	}
+	for _, wsConn := range conns {
+		wsConn.Close()
+	}
+	return len(conns)
+}
+
+// StopAccept 关闭监听, 不再接受新连接, 已有的连接不受影响
+// 热重启时监听已经交给了新进程, 旧进程关掉自己的之后新连接都由新进程接受
+func (server *WSServer) StopAccept() {
+	server.Lock()
+	ln := server.Listener
+	server.stopAccept = true
+	server.listening = false
+	server.Unlock()
+	if ln != nil {
+		ln.Close()
+	}
+}
+
+func (server *WSServer) acceptStopped() bool {
+	server.Lock()
+	defer server.Unlock()
+	return server.stopAccept
+}
+
+// SetDraining 开始或者停止拒绝新连接, 已有的连接不受影响
+func (server *WSServer) SetDraining(draining bool) {
+	server.Lock()
+	server.draining = draining
+	server.Unlock()
+}
+
+func (server *WSServer) Draining() bool {
+	server.Lock()
+	defer server.Unlock()
+	return server.draining
+}
+
+// handleHealth 进程存活就返回200
+func (server *WSServer) handleHealth(w http.ResponseWriter, r *http.Request) {
+	w.Write([]byte("ok\n"))
+}
 
+// handleReady 监听已经建立, 没有在排空, 并且ReadyCheck通过时返回200, 否则返回503
+// 负载均衡器根据它把排空中的节点摘掉
+func (server *WSServer) handleReady(w http.ResponseWriter, r *http.Request) {
+	if err := server.ready(); err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	w.Write([]byte("ok\n"))
+}
+
+func (server *WSServer) ready() error {
+	server.Lock()
+	listening, draining := server.listening, server.draining
+	server.Unlock()
+	if !listening {
+		return errors.New("not listening")
+	}
+	if draining {
+		return errors.New("draining")
+	}
+	if server.ReadyCheck != nil {
+		return server.ReadyCheck()
+	}
+	return nil
 }
 
 func (server *WSServer) handleRequest(w http.ResponseWriter, r *http.Request) {
+	if server.Draining() {
+		connRejected.With("draining").Inc()
+		http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+		return
+	}
+	//升级之前检查, 被拒绝的ip不会进行websocket握手
+	ip := remoteIP(r)
+	if server.BanList.IsBanned(ip) {
+		logger.Debug("reject banned ip %v", ip)
+		connRejected.With("banned").Inc()
+		http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		return
+	}
+	if !server.checkOrigin(r) {
+		logger.Debug("reject ip %v, origin %v is not allowed", ip, r.Header.Get("Origin"))
+		connRejected.With("origin").Inc()
+		http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		return
+	}
+	ipLimiter, err := server.acquireConn(ip)
+	if err != nil {
+		logger.Debug("reject ip %v: %v", ip, err)
+		connRejected.With(rejectReason(err)).Inc()
+		status := rejectStatus(err)
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+
 	upgrader := websocket.Upgrader{
 		ReadBufferSize:  server.ReadBufferSize,
 		WriteBufferSize: server.WriteBufferSize,
 		CheckOrigin: func(r *http.Request) bool {
+			//升级之前已经检查过AllowedOrigins
 			return true
 		},
 	}
 
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
+		server.releaseConn(ip)
+		connRejected.With("upgrade_error").Inc()
 		log.Println(err)
 		return
 	}
-
-	if len(server.conns) >= server.MaxConnNum {
-		logger.Debug("server is reached the max connectNum: %v", len(server.conns))
+	wsConn := newWsConn(conn, server.PendingWriteNum, uint32(server.WriteBufferSize), server.PendingReadNum, server.genConnId(), server, r)
+	wsConn.ip = ip
+	wsConn.limiter = NewLimiter(server.connRateLimit())
+	wsConn.limiter.SetMaxDelayed(server.PendingReadNum)
+	wsConn.ipLimiter = ipLimiter
+	if !server.register(wsConn) {
+		//升级期间开始了排空
+		server.releaseConn(ip)
+		connRejected.With("draining").Inc()
+		conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseGoingAway, "server draining"), time.Now().Add(time.Second))
+		conn.Close()
 		return
 	}
-
-	wsConn := newWsConn(conn, server.PendingWriteNum, uint32(server.WriteBufferSize), server.PendingReadNum, server.genConnId(), server)
-	server.registerChan <- wsConn
+	connAccepted.Inc()
+	connCurrent.Inc()
 	go wsConn.ReadPump()
 	go wsConn.WritePump()
+
+	if server.NewAgent == nil {
+		return
+	}
+	agent := server.NewAgent(wsConn)
+	if agent == nil {
+		return
+	}
+	go func() {
+		agent.Run()
+		//agent退出时连接可能还没关闭
+		wsConn.Close()
+		agent.OnClose()
+	}()
 }
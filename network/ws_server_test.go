@@ -1,25 +1,44 @@
 /*
  * @Author: yujiaxun
  * @Date: 2023-12-02 17:38:34
- * @LastEditTime: 2023-12-02 20:49:00
+ * @LastEditTime: 2026-10-19 15:54:51
  * @Description: xxx
  */
 
 package network_test
 
 import (
-	"os"
-	"os/signal"
-	"test/logger"
+	"context"
+	"net"
 	"test/network"
 	"testing"
 	"time"
+
+	"github.com/gorilla/websocket"
 )
 
+func dialWS(t *testing.T, wsServer *network.WSServer) *websocket.Conn {
+	var addr net.Addr
+	for i := 0; i < 100 && addr == nil; i++ {
+		if addr = wsServer.ListenAddr(); addr == nil {
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	if addr == nil {
+		t.Fatal("server is not listening")
+	}
+	client, _, err := websocket.DefaultDialer.Dial("ws://"+addr.String()+"/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
 //WSServer单元测试
 func TestWSServer(t *testing.T) {
+	conns := make(chan *network.WSConn, 1)
 	wsServer := network.WSServer{
-		Addr:            "10.215.40.10:8880",
+		Addr:            "127.0.0.1:0",
 		MaxConnNum:      1000000,
 		PendingWriteNum: 1024,
 		PendingReadNum:  1024,
@@ -27,6 +46,7 @@ func TestWSServer(t *testing.T) {
 		CertFile:        "",
 		KeyFile:         "",
 		NewAgent: func(wsConn *network.WSConn) network.Agent {
+			conns <- wsConn
 			return nil
 		},
 		ReadBufferSize:  1024,
@@ -35,17 +55,135 @@ func TestWSServer(t *testing.T) {
 		PongWait:        60 * time.Second,
 	}
 	wsServer.Init()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
 	go func() {
-		//监控关闭信号
-		c := make(chan os.Signal)
-		//监听所有信号
-		signal.Notify(c)
-		//阻塞直qidong
-		logger.Debug("listening exit signal")
-		s := <-c
-		logger.Debug("catch the exit signal %v", s)
-		wsServer.CloseChan <- true
-		logger.Debug("notify server to close")
+		done <- wsServer.Serve(ctx)
 	}()
-	wsServer.Start()
+
+	client := dialWS(t, &wsServer)
+	defer client.Close()
+	wsConn := <-conns
+	connCtx := wsConn.Context()
+	if connCtx.Err() != nil {
+		t.Fatal("conn context is canceled before close")
+	}
+
+	//取消ctx相当于收到关闭信号
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("serve: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("serve does not return after cancel")
+	}
+	if connCtx.Err() == nil {
+		t.Fatal("conn context is not canceled after close")
+	}
+	if reason := wsConn.CloseReason(); reason != network.CloseShutdown {
+		t.Fatalf("close reason %v", reason)
+	}
+	_, _, err := client.ReadMessage()
+	if !websocket.IsCloseError(err, websocket.CloseGoingAway) {
+		t.Fatalf("expect going away close, got %v", err)
+	}
+}
+
+func TestWSServerListenError(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	wsServer := &network.WSServer{Addr: ln.Addr().String()}
+	if err := wsServer.Serve(context.Background()); err == nil {
+		t.Fatal("serve on a used address should fail")
+	}
+}
+
+func TestWSServerShutdown(t *testing.T) {
+	wsServer := &network.WSServer{Addr: "127.0.0.1:0"}
+	wsServer.Init()
+	done := make(chan error, 1)
+	go func() {
+		done <- wsServer.Serve(context.Background())
+	}()
+	client := dialWS(t, wsServer)
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := wsServer.Shutdown(ctx); err != nil {
+		t.Fatalf("shutdown: %v", err)
+	}
+	if err := <-done; err != nil {
+		t.Fatalf("serve: %v", err)
+	}
+	if n := wsServer.ConnNum(); n != 0 {
+		t.Fatalf("connNum %v after shutdown", n)
+	}
+}
+
+func TestWSConnCloseReason(t *testing.T) {
+	conns := make(chan *network.WSConn, 1)
+	wsServer := &network.WSServer{
+		Addr: "127.0.0.1:0",
+		NewAgent: func(wsConn *network.WSConn) network.Agent {
+			conns <- wsConn
+			return nil
+		},
+		ReadBufferSize:  1024,
+		WriteBufferSize: 1024,
+	}
+	wsServer.Init()
+	go wsServer.Serve(context.Background())
+	defer wsServer.Shutdown(context.Background())
+
+	closeReason := func(wsConn *network.WSConn) network.CloseReason {
+		select {
+		case <-wsConn.Context().Done():
+		case <-time.After(5 * time.Second):
+			t.Fatal("conn is not closed")
+		}
+		return wsConn.CloseReason()
+	}
+
+	client := dialWS(t, wsServer)
+	wsConn := <-conns
+	client.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, "bye"))
+	if reason := closeReason(wsConn); reason != network.CloseClientClosed {
+		t.Fatalf("client close: %v", reason)
+	}
+	client.Close()
+
+	client = dialWS(t, wsServer)
+	defer client.Close()
+	wsConn = <-conns
+	wsConn.CloseWithCode(4001, "kicked")
+	if reason := closeReason(wsConn); reason != network.CloseKicked {
+		t.Fatalf("kick: %v", reason)
+	}
+}
+
+func TestWSServerClose(t *testing.T) {
+	wsServer := &network.WSServer{Addr: "127.0.0.1:0"}
+	wsServer.Init()
+	done := make(chan error, 1)
+	go func() {
+		done <- wsServer.Serve(context.Background())
+	}()
+	client := dialWS(t, wsServer)
+	defer client.Close()
+
+	//Close是Shutdown的包装
+	wsServer.Close()
+	if err := <-done; err != nil {
+		t.Fatalf("serve: %v", err)
+	}
+	_, _, err := client.ReadMessage()
+	if !websocket.IsCloseError(err, websocket.CloseGoingAway) {
+		t.Fatalf("expect going away close, got %v", err)
+	}
 }
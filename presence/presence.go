@@ -0,0 +1,226 @@
+/*
+ * @Author: yujiaxun
+ * @Date: 2026-10-20 09:35:10
+ * @LastEditTime: 2026-10-20 09:35:10
+ * @Description: 用户的在线状态, 心跳超时后自动离线
+ */
+
+package presence
+
+import (
+	"sync"
+	"time"
+
+	"test/logger"
+)
+
+// Status 用户的在线状态
+type Status struct {
+	UserID   string    `json:"user_id"`
+	Online   bool      `json:"online"`
+	Node     string    `json:"node"`      //在线时所在的网关节点
+	LastSeen time.Time `json:"last_seen"` //最后一次写入的时间, 心跳最多每TTL/2写入一次
+}
+
+// Service 记录在线状态, 状态变化时通知订阅者
+// Online/Offline由网关在用户的第一个会话登录和最后一个会话关闭时调用, Heartbeat在收到pong时调用
+type Service struct {
+	Store Store
+	TTL   time.Duration //超过TTL没有心跳视为离线, 默认90秒, 网关启动时至少设为PongWait的两倍
+	Node  string        //本节点的id
+
+	mutex     sync.Mutex
+	lastSub   int
+	subs      map[int]func(st Status)
+	refreshed map[string]time.Time //本节点最后一次写入在线状态的时间, Heartbeat据此决定是否刷新
+	closeChan chan bool
+	wg        sync.WaitGroup
+}
+
+// NewService store为nil时使用MemoryStore
+func NewService(store Store, ttl time.Duration) *Service {
+	if store == nil {
+		store = NewMemoryStore()
+	}
+	if ttl <= 0 {
+		ttl = 90 * time.Second
+	}
+	s := new(Service)
+	s.Store = store
+	s.TTL = ttl
+	s.subs = make(map[int]func(st Status))
+	s.refreshed = make(map[string]time.Time)
+	return s
+}
+
+// Start 开始检查心跳超时
+func (s *Service) Start() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.closeChan != nil {
+		return
+	}
+	s.closeChan = make(chan bool)
+	s.wg.Add(1)
+	go s.expireLoop(s.closeChan)
+}
+
+func (s *Service) Close() {
+	s.mutex.Lock()
+	closeChan := s.closeChan
+	s.closeChan = nil
+	s.mutex.Unlock()
+	if closeChan != nil {
+		close(closeChan)
+		s.wg.Wait()
+	}
+	if err := s.Store.Close(); err != nil {
+		logger.Error("close presence store error: %v", err)
+	}
+}
+
+// Subscribe 订阅上下线事件, 在改变状态的协程里调用, 不要阻塞; 返回取消订阅的函数
+func (s *Service) Subscribe(fn func(st Status)) (cancel func()) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.lastSub++
+	id := s.lastSub
+	s.subs[id] = fn
+	return func() {
+		s.mutex.Lock()
+		delete(s.subs, id)
+		s.mutex.Unlock()
+	}
+}
+
+func (s *Service) Online(userID string) {
+	s.update(userID, func(st *Status) {
+		st.Online = true
+		st.Node = s.Node
+	})
+}
+
+// Offline 只有用户在本节点上线时才改成离线, 避免覆盖其他节点上的登录
+func (s *Service) Offline(userID string) {
+	s.update(userID, func(st *Status) {
+		if st.Node == s.Node {
+			st.Online = false
+		}
+	})
+}
+
+// Heartbeat 距离上次写入超过TTL的一半, 快要超时的时候才刷新最后活跃时间, 避免每个pong都写一次存储
+// 已经超时离线的用户重新上线
+func (s *Service) Heartbeat(userID string) {
+	s.mutex.Lock()
+	last, ok := s.refreshed[userID]
+	s.mutex.Unlock()
+	if ok && time.Since(last) < s.TTL/2 {
+		return
+	}
+	s.Online(userID)
+}
+
+// Get 查询在线状态, 没有记录时返回Online为false的Status
+func (s *Service) Get(userID string) Status {
+	st, ok, err := s.Store.Get(userID)
+	if err != nil {
+		logger.Error("get presence of %v error: %v", userID, err)
+	}
+	if !ok {
+		return Status{UserID: userID}
+	}
+	if st.Online && time.Since(st.LastSeen) > s.TTL {
+		st.Online = false
+	}
+	return st
+}
+
+func (s *Service) IsOnline(userID string) bool {
+	return s.Get(userID).Online
+}
+
+func (s *Service) update(userID string, change func(st *Status)) {
+	s.mutex.Lock()
+	//和存储里的状态比较, 超时但还没被expire改成离线的用户仍然算在线
+	old, _, err := s.Store.Get(userID)
+	if err != nil {
+		s.mutex.Unlock()
+		logger.Error("get presence of %v error: %v", userID, err)
+		return
+	}
+	old.UserID = userID
+	st := old
+	st.LastSeen = time.Now()
+	change(&st)
+	err = s.Store.Put(st)
+	if err == nil && st.Online && st.Node == s.Node {
+		s.refreshed[userID] = st.LastSeen
+	} else {
+		delete(s.refreshed, userID)
+	}
+	var subs []func(st Status)
+	if err == nil && st.Online != old.Online {
+		subs = s.subscribers()
+	}
+	s.mutex.Unlock()
+
+	if err != nil {
+		logger.Error("put presence of %v error: %v", userID, err)
+		return
+	}
+	for _, fn := range subs {
+		fn(st)
+	}
+}
+
+func (s *Service) subscribers() []func(st Status) {
+	subs := make([]func(st Status), 0, len(s.subs))
+	for _, fn := range s.subs {
+		subs = append(subs, fn)
+	}
+	return subs
+}
+
+func (s *Service) expireLoop(closeChan chan bool) {
+	defer s.wg.Done()
+	ticker := time.NewTicker(s.TTL / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.expire()
+		case <-closeChan:
+			return
+		}
+	}
+}
+
+// expire 心跳超时的用户改成离线并通知订阅者
+func (s *Service) expire() {
+	all, err := s.Store.All()
+	if err != nil {
+		logger.Error("list presence error: %v", err)
+		return
+	}
+	for _, st := range all {
+		if !st.Online || time.Since(st.LastSeen) <= s.TTL {
+			continue
+		}
+		s.mutex.Lock()
+		cur, ok, _ := s.Store.Get(st.UserID)
+		expired := ok && cur.Online && time.Since(cur.LastSeen) > s.TTL
+		var subs []func(st Status)
+		if expired {
+			cur.Online = false
+			if err := s.Store.Put(cur); err == nil {
+				subs = s.subscribers()
+			}
+			delete(s.refreshed, st.UserID)
+		}
+		s.mutex.Unlock()
+		for _, fn := range subs {
+			fn(cur)
+		}
+	}
+}
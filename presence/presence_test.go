@@ -0,0 +1,123 @@
+/*
+ * @Author: yujiaxun
+ * @Date: 2026-10-20 10:02:51
+ * @LastEditTime: 2026-10-20 10:02:51
+ * @Description: xxx
+ */
+
+package presence_test
+
+import (
+	"path/filepath"
+	"sync/atomic"
+	"test/presence"
+	"testing"
+	"time"
+)
+
+func TestPresence(t *testing.T) {
+	s := presence.NewService(nil, 60*time.Millisecond)
+	s.Node = "g1"
+	events := make(chan presence.Status, 10)
+	cancel := s.Subscribe(func(st presence.Status) { events <- st })
+	s.Start()
+	defer s.Close()
+
+	s.Online("u1")
+	if st := <-events; st.UserID != "u1" || !st.Online || st.Node != "g1" {
+		t.Fatalf("got %+v, want u1 online", st)
+	}
+	s.Heartbeat("u1")
+	if !s.IsOnline("u1") || s.IsOnline("u2") {
+		t.Fatal("want u1 online and u2 offline")
+	}
+
+	//没有心跳, 超时后离线
+	select {
+	case st := <-events:
+		if st.Online {
+			t.Fatalf("got %+v, want offline", st)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("wait offline timeout")
+	}
+	if s.IsOnline("u1") || s.Get("u1").LastSeen.IsZero() {
+		t.Fatalf("got %+v, want offline with last seen", s.Get("u1"))
+	}
+
+	cancel()
+	s.Online("u1")
+	select {
+	case st := <-events:
+		t.Fatalf("got %+v after cancel", st)
+	case <-time.After(10 * time.Millisecond):
+	}
+}
+
+// countStore 记录写入次数
+type countStore struct {
+	*presence.MemoryStore
+	puts int32
+}
+
+func (s *countStore) Put(st presence.Status) error {
+	atomic.AddInt32(&s.puts, 1)
+	return s.MemoryStore.Put(st)
+}
+
+func TestHeartbeatRefresh(t *testing.T) {
+	store := &countStore{MemoryStore: presence.NewMemoryStore()}
+	s := presence.NewService(store, 100*time.Millisecond)
+	s.Node = "g1"
+	defer s.Close()
+
+	s.Online("u1")
+	first := s.Get("u1").LastSeen
+	for i := 0; i < 10; i++ {
+		s.Heartbeat("u1")
+	}
+	if n := atomic.LoadInt32(&store.puts); n != 1 {
+		t.Fatalf("%v puts, want heartbeats skipped while far from expiring", n)
+	}
+
+	//超过TTL的一半才刷新
+	time.Sleep(60 * time.Millisecond)
+	s.Heartbeat("u1")
+	s.Heartbeat("u1")
+	if n := atomic.LoadInt32(&store.puts); n != 2 {
+		t.Fatalf("%v puts, want one refresh", n)
+	}
+	if !s.Get("u1").LastSeen.After(first) {
+		t.Fatal("last seen not refreshed")
+	}
+
+	//离线之后心跳重新上线
+	s.Offline("u1")
+	s.Heartbeat("u1")
+	if !s.IsOnline("u1") {
+		t.Fatal("heartbeat after offline, want online")
+	}
+}
+
+func TestFileStore(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "presence.json")
+	store, err := presence.NewFileStore(file, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := presence.NewService(store, time.Minute)
+	s.Online("u1")
+	s.Online("u2")
+	s.Offline("u2")
+	s.Close()
+
+	store, err = presence.NewFileStore(file, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	s = presence.NewService(store, time.Minute)
+	if !s.IsOnline("u1") || s.IsOnline("u2") || s.Get("u2").LastSeen.IsZero() {
+		t.Fatalf("got %+v %+v after reload", s.Get("u1"), s.Get("u2"))
+	}
+}
@@ -0,0 +1,175 @@
+/*
+ * @Author: yujiaxun
+ * @Date: 2026-10-20 09:12:33
+ * @LastEditTime: 2026-10-20 09:12:33
+ * @Description: 在线状态的存储
+ */
+
+package presence
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"test/logger"
+)
+
+// Store 在线状态的存储接口, 以后可以接入redis让多个网关节点共享
+type Store interface {
+	Get(userID string) (Status, bool, error)
+	Put(st Status) error
+	// All 所有记录, 用来检查心跳超时
+	All() ([]Status, error)
+	Close() error
+}
+
+// MemoryStore 进程内的存储, 重启后丢失
+type MemoryStore struct {
+	mutex sync.RWMutex
+	users map[string]Status
+	dirty bool //上次快照之后有修改
+}
+
+func NewMemoryStore() *MemoryStore {
+	s := new(MemoryStore)
+	s.users = make(map[string]Status)
+	return s
+}
+
+func (s *MemoryStore) Get(userID string) (Status, bool, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	st, ok := s.users[userID]
+	return st, ok, nil
+}
+
+func (s *MemoryStore) Put(st Status) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.users[st.UserID] = st
+	s.dirty = true
+	return nil
+}
+
+// All 按用户id排序
+func (s *MemoryStore) All() ([]Status, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	all := make([]Status, 0, len(s.users))
+	for _, st := range s.users {
+		all = append(all, st)
+	}
+	sort.Slice(all, func(i, j int) bool {
+		return all[i].UserID < all[j].UserID
+	})
+	return all, nil
+}
+
+func (s *MemoryStore) Close() error {
+	return nil
+}
+
+// FileStore 在内存里读写, 定时把快照写到文件, 启动时从快照恢复
+type FileStore struct {
+	*MemoryStore
+	File string
+
+	closeChan chan bool
+	wg        sync.WaitGroup
+}
+
+// NewFileStore 读取快照, interval大于0时定时保存, Close时总会保存一次
+func NewFileStore(file string, interval time.Duration) (*FileStore, error) {
+	s := new(FileStore)
+	s.MemoryStore = NewMemoryStore()
+	s.File = file
+	s.closeChan = make(chan bool)
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	if interval > 0 {
+		s.wg.Add(1)
+		go s.loop(interval)
+	}
+	return s, nil
+}
+
+func (s *FileStore) load() error {
+	data, err := os.ReadFile(s.File)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var all []Status
+	if err := json.Unmarshal(data, &all); err != nil {
+		return err
+	}
+	for _, st := range all {
+		s.users[st.UserID] = st
+	}
+	return nil
+}
+
+func (s *FileStore) loop(interval time.Duration) {
+	defer s.wg.Done()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := s.Save(); err != nil {
+				logger.Error("save presence snapshot error: %v", err)
+			}
+		case <-s.closeChan:
+			return
+		}
+	}
+}
+
+// Save 有修改时写快照, 先写临时文件再改名, 避免写到一半时崩溃
+func (s *FileStore) Save() error {
+	s.mutex.Lock()
+	if !s.dirty {
+		s.mutex.Unlock()
+		return nil
+	}
+	s.dirty = false
+	s.mutex.Unlock()
+
+	all, _ := s.All()
+	data, err := json.Marshal(all)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(s.File), filepath.Base(s.File)+".tmp")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), s.File)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		s.mutex.Lock()
+		s.dirty = true
+		s.mutex.Unlock()
+	}
+	return err
+}
+
+func (s *FileStore) Close() error {
+	close(s.closeChan)
+	s.wg.Wait()
+	return s.Save()
+}
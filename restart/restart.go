@@ -0,0 +1,70 @@
+/*
+ * @Author: yujiaxun
+ * @Date: 2026-10-20 21:30:15
+ * @LastEditTime: 2026-10-20 21:30:15
+ * @Description: 热重启, 把监听交给新启动的进程, 已有的连接留在旧进程里排空
+ */
+
+package restart
+
+import (
+	"errors"
+	"net"
+	"sync"
+)
+
+// 用法:
+//
+//	ln, err := restart.Listen("tcp", addr) //热重启启动时继承父进程的监听
+//	... 开始服务 ...
+//	restart.Ready()                        //通知父进程可以停止接受新连接了
+//	restart.Notify(c)                      //收到SIGUSR2后调用restart.Restart, 成功后关闭监听并排空
+//
+// 本地测试时先启动一个进程, 然后 kill -USR2 <pid>, 新进程会用同样的参数启动
+
+var ErrNotSupported = errors.New("hot restart is not supported on this platform")
+
+type listener struct {
+	addr string
+	ln   net.Listener
+}
+
+var (
+	mutex     sync.Mutex
+	listeners []listener //Listen创建或者继承的监听, 重启时按顺序传给子进程
+)
+
+// Listen 优先使用父进程传过来的addr的监听, 没有时新建, 返回的监听在重启时会传给子进程, 关闭之后不再传
+func Listen(network, addr string) (net.Listener, error) {
+	ln, err := inherit(addr)
+	if err != nil {
+		return nil, err
+	}
+	if ln == nil {
+		ln, err = net.Listen(network, addr)
+		if err != nil {
+			return nil, err
+		}
+	}
+	mutex.Lock()
+	listeners = append(listeners, listener{addr: addr, ln: ln})
+	mutex.Unlock()
+	return &trackedListener{Listener: ln}, nil
+}
+
+// trackedListener 关闭时从listeners里删掉, 停止的服务或者启动失败留下的监听不会再传给子进程
+type trackedListener struct {
+	net.Listener
+}
+
+func (l *trackedListener) Close() error {
+	mutex.Lock()
+	for i := range listeners {
+		if listeners[i].ln == l.Listener {
+			listeners = append(listeners[:i], listeners[i+1:]...)
+			break
+		}
+	}
+	mutex.Unlock()
+	return l.Listener.Close()
+}
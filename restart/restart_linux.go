@@ -0,0 +1,208 @@
+//go:build linux
+
+/*
+ * @Author: yujiaxun
+ * @Date: 2026-10-20 21:30:15
+ * @LastEditTime: 2026-10-20 21:30:15
+ * @Description: linux下通过ExtraFiles把监听的fd传给子进程
+ */
+
+package restart
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"test/logger"
+)
+
+const (
+	envListeners = "GATE_RESTART_LISTENERS" //继承的监听地址, 逗号分隔, 依次对应fd 3, 4, ...
+	envReady     = "GATE_RESTART_READY"     //就绪管道的fd, 子进程准备好之后写入一个字节
+)
+
+var (
+	inheritOnce sync.Once
+	inherited   map[string]*os.File //addr -> 父进程传过来的监听, 还没有被Listen取走的
+	inheritErr  error
+	restarting  bool
+)
+
+func parseInherited() {
+	inherited = make(map[string]*os.File)
+	value := os.Getenv(envListeners)
+	os.Unsetenv(envListeners)
+	if value == "" {
+		return
+	}
+	for i, addr := range strings.Split(value, ",") {
+		f := os.NewFile(uintptr(3+i), "listener:"+addr)
+		if f == nil {
+			inheritErr = fmt.Errorf("inherited listener %v is invalid", addr)
+			return
+		}
+		inherited[addr] = f
+	}
+}
+
+func inherit(addr string) (net.Listener, error) {
+	inheritOnce.Do(parseInherited)
+	if inheritErr != nil {
+		return nil, inheritErr
+	}
+	mutex.Lock()
+	f := inherited[addr]
+	delete(inherited, addr)
+	mutex.Unlock()
+	if f == nil {
+		return nil, nil
+	}
+	defer f.Close()
+	ln, err := net.FileListener(f)
+	if err != nil {
+		return nil, fmt.Errorf("inherit listener %v: %v", addr, err)
+	}
+	logger.Release("inherit listener %v from parent", addr)
+	return ln, nil
+}
+
+// Inherited 是否由热重启启动
+func Inherited() bool {
+	return os.Getenv(envReady) != ""
+}
+
+// Ready 子进程开始服务之后调用, 父进程收到通知后停止接受新连接, 不是热重启启动时什么都不做
+func Ready() error {
+	inheritOnce.Do(parseInherited)
+	mutex.Lock()
+	//新的配置里没有用到的监听直接关闭
+	for addr, f := range inherited {
+		logger.Release("close unused inherited listener %v", addr)
+		f.Close()
+		delete(inherited, addr)
+	}
+	mutex.Unlock()
+
+	value := os.Getenv(envReady)
+	if value == "" {
+		return nil
+	}
+	os.Unsetenv(envReady)
+	fd, err := strconv.Atoi(value)
+	if err != nil {
+		return fmt.Errorf("bad ready fd %v", value)
+	}
+	f := os.NewFile(uintptr(fd), "ready")
+	defer f.Close()
+	_, err = f.Write([]byte{1})
+	return err
+}
+
+// Notify 收到SIGUSR2时发送到c
+func Notify(c chan<- os.Signal) {
+	signal.Notify(c, syscall.SIGUSR2)
+}
+
+// Restart 用同样的参数启动新进程, 并把Listen得到的监听传给它, 新进程调用Ready之后返回
+// 返回错误时新进程已经退出, 当前进程继续服务
+func Restart(timeout time.Duration) (*os.Process, error) {
+	mutex.Lock()
+	if restarting {
+		mutex.Unlock()
+		return nil, errors.New("restart in progress")
+	}
+	restarting = true
+	lns := append([]listener(nil), listeners...)
+	mutex.Unlock()
+	defer func() {
+		mutex.Lock()
+		restarting = false
+		mutex.Unlock()
+	}()
+
+	addrs := make([]string, 0, len(lns))
+	files := make([]*os.File, 0, len(lns)+1)
+	defer func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}()
+	for _, l := range lns {
+		filer, ok := l.ln.(interface{ File() (*os.File, error) })
+		if !ok {
+			return nil, fmt.Errorf("listener %v can not be passed", l.addr)
+		}
+		f, err := filer.File()
+		if err != nil {
+			return nil, fmt.Errorf("listener %v: %v", l.addr, err)
+		}
+		addrs = append(addrs, l.addr)
+		files = append(files, f)
+	}
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	files = append(files, w)
+
+	path, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+	cmd := exec.Command(path, os.Args[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.ExtraFiles = files
+	cmd.Env = append(environ(),
+		envListeners+"="+strings.Join(addrs, ","),
+		envReady+"="+strconv.Itoa(3+len(addrs)),
+	)
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	//子进程已经拿到了写端, 父进程关掉自己的才能在子进程退出时读到EOF
+	w.Close()
+	files = files[:len(files)-1]
+
+	ready := make(chan error, 1)
+	go func() {
+		buf := make([]byte, 1)
+		_, err := r.Read(buf)
+		ready <- err
+	}()
+	select {
+	case err = <-ready:
+	case <-time.After(timeout):
+		err = errors.New("timeout")
+	}
+	if err != nil {
+		cmd.Process.Kill()
+		cmd.Wait()
+		return nil, fmt.Errorf("child %v not ready: %v", cmd.Process.Pid, err)
+	}
+	logger.Release("child %v is ready, listeners %v", cmd.Process.Pid, addrs)
+	return cmd.Process, nil
+}
+
+// environ 去掉上一次热重启留下的环境变量
+func environ() []string {
+	env := make([]string, 0, len(os.Environ()))
+	for _, kv := range os.Environ() {
+		if strings.HasPrefix(kv, envListeners+"=") || strings.HasPrefix(kv, envReady+"=") {
+			continue
+		}
+		env = append(env, kv)
+	}
+	return env
+}
@@ -0,0 +1,82 @@
+/*
+ * @Author: yujiaxun
+ * @Date: 2026-10-20 22:40:51
+ * @LastEditTime: 2026-10-20 22:40:51
+ * @Description: xxx
+ */
+
+package restart_test
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"test/restart"
+	"testing"
+	"time"
+)
+
+const testAddr = "127.0.0.1:0"
+
+func serve(t *testing.T, name string) net.Listener {
+	ln, err := restart.Listen("tcp", testAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(name))
+	})}
+	server.SetKeepAlivesEnabled(false)
+	go server.Serve(ln)
+	return ln
+}
+
+func get(t *testing.T, addr string) string {
+	resp, err := http.Get("http://" + addr + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	return string(body)
+}
+
+// 测试进程会用同样的参数再启动一次, 子进程里继承监听并一直服务, 直到被父进程杀掉
+func TestRestart(t *testing.T) {
+	if restart.Inherited() {
+		serve(t, "child")
+		if err := restart.Ready(); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(time.Minute)
+		return
+	}
+
+	//已经关闭的监听不再传给子进程
+	closed, err := restart.Listen("tcp", testAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	closed.Close()
+
+	ln := serve(t, "parent")
+	addr := ln.Addr().String()
+	if body := get(t, addr); body != "parent" {
+		t.Fatalf("got %q from parent", body)
+	}
+	proc, err := restart.Restart(10 * time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		proc.Kill()
+		proc.Wait()
+	}()
+	//父进程停止接受之后, 同一个地址由子进程服务
+	ln.Close()
+	for i := 0; i < 5; i++ {
+		if body := get(t, addr); body != "child" {
+			t.Fatalf("got %q after restart", body)
+		}
+	}
+}
@@ -0,0 +1,34 @@
+//go:build !linux
+
+/*
+ * @Author: yujiaxun
+ * @Date: 2026-10-20 21:30:15
+ * @LastEditTime: 2026-10-20 21:30:15
+ * @Description: 其他平台不支持热重启
+ */
+
+package restart
+
+import (
+	"net"
+	"os"
+	"time"
+)
+
+func inherit(addr string) (net.Listener, error) {
+	return nil, nil
+}
+
+func Inherited() bool {
+	return false
+}
+
+func Ready() error {
+	return nil
+}
+
+func Notify(c chan<- os.Signal) {}
+
+func Restart(timeout time.Duration) (*os.Process, error) {
+	return nil, ErrNotSupported
+}
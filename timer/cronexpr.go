@@ -0,0 +1,171 @@
+/*
+ * @Author: yujiaxun
+ * @Date: 2026-10-22 14:40:17
+ * @LastEditTime: 2026-10-22 14:40:17
+ * @Description: cron表达式
+ */
+
+package timer
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CronExpr 5个或者6个字段, 6个时第一个是秒, 5个时秒为0
+//
+//	秒 分 时 日 月 星期
+//	0  0  5  *  *  *      每天5点
+//	*/30 * * * * *        每30秒
+//	0  0  0  1  *  *      每月1号0点
+//	0  30 9  *  *  1-5    工作日9点半
+//
+// 每个字段支持 *, ?, a, a-b, */n, a-b/n, 以及用逗号分隔的组合, 星期0和7都表示周日
+// 日和星期都不是*时, 满足其中一个就执行, 和crontab一样
+type CronExpr struct {
+	sec    uint64
+	min    uint64
+	hour   uint64
+	dom    uint64
+	month  uint64
+	dow    uint64
+	anyDom bool
+	anyDow bool
+}
+
+type cronField struct {
+	name     string
+	min, max int
+}
+
+var cronFields = []cronField{
+	{"second", 0, 59},
+	{"minute", 0, 59},
+	{"hour", 0, 23},
+	{"day of month", 1, 31},
+	{"month", 1, 12},
+	{"day of week", 0, 7},
+}
+
+func NewCronExpr(expr string) (*CronExpr, error) {
+	fields := strings.Fields(expr)
+	switch len(fields) {
+	case 5:
+		fields = append([]string{"0"}, fields...)
+	case 6:
+	default:
+		return nil, fmt.Errorf("cron expr %q: need 5 or 6 fields", expr)
+	}
+	var bits [6]uint64
+	for i, field := range fields {
+		b, err := parseCronField(field, cronFields[i])
+		if err != nil {
+			return nil, fmt.Errorf("cron expr %q: %v", expr, err)
+		}
+		bits[i] = b
+	}
+	e := new(CronExpr)
+	e.sec, e.min, e.hour, e.dom, e.month, e.dow = bits[0], bits[1], bits[2], bits[3], bits[4], bits[5]
+	if e.dow&(1<<7) != 0 {
+		e.dow |= 1
+	}
+	e.anyDom = fields[3] == "*" || fields[3] == "?"
+	e.anyDow = fields[5] == "*" || fields[5] == "?"
+	return e, nil
+}
+
+func parseCronField(field string, f cronField) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		if i := strings.IndexByte(part, '/'); i >= 0 {
+			n, err := strconv.Atoi(part[i+1:])
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("bad step in %v field %q", f.name, part)
+			}
+			step = n
+			part = part[:i]
+		}
+		lo, hi := f.min, f.max
+		switch {
+		case part == "*" || part == "?":
+		case strings.IndexByte(part, '-') > 0:
+			i := strings.IndexByte(part, '-')
+			var err1, err2 error
+			lo, err1 = strconv.Atoi(part[:i])
+			hi, err2 = strconv.Atoi(part[i+1:])
+			if err1 != nil || err2 != nil {
+				return 0, fmt.Errorf("bad range in %v field %q", f.name, part)
+			}
+		default:
+			n, err := strconv.Atoi(part)
+			if err != nil {
+				return 0, fmt.Errorf("bad value in %v field %q", f.name, part)
+			}
+			lo = n
+			hi = n
+			if step > 1 {
+				//a/n 表示从a开始到最大值
+				hi = f.max
+			}
+		}
+		if lo < f.min || hi > f.max || lo > hi {
+			return 0, fmt.Errorf("%v field %q out of range %v-%v", f.name, part, f.min, f.max)
+		}
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+func (e *CronExpr) matchDay(t time.Time) bool {
+	dom := e.dom&(1<<uint(t.Day())) != 0
+	dow := e.dow&(1<<uint(t.Weekday())) != 0
+	switch {
+	case e.anyDom && e.anyDow:
+		return true
+	case e.anyDom:
+		return dow
+	case e.anyDow:
+		return dom
+	}
+	return dom || dow
+}
+
+// Next t之后的下一个执行时间, 使用t的时区, 5年内都没有时返回零值, 例如2月30号
+func (e *CronExpr) Next(t time.Time) time.Time {
+	t = t.Add(time.Second - time.Duration(t.Nanosecond()))
+	loc := t.Location()
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		y, mo, d := t.Date()
+		h, mi, s := t.Clock()
+		if e.month&(1<<uint(mo)) == 0 {
+			t = time.Date(y, mo+1, 1, 0, 0, 0, 0, loc)
+			continue
+		}
+		if !e.matchDay(t) {
+			t = time.Date(y, mo, d+1, 0, 0, 0, 0, loc)
+			continue
+		}
+		//时分秒用绝对时间前进, 夏令时回拨的那一个小时里time.Date会回到之前的时间
+		sec := time.Duration(s) * time.Second
+		if e.hour&(1<<uint(h)) == 0 {
+			t = t.Add(time.Hour - time.Duration(mi)*time.Minute - sec)
+			continue
+		}
+		if e.min&(1<<uint(mi)) == 0 {
+			t = t.Add(time.Minute - sec)
+			continue
+		}
+		if e.sec&(1<<uint(s)) == 0 {
+			t = t.Add(time.Second)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
@@ -0,0 +1,135 @@
+/*
+ * @Author: yujiaxun
+ * @Date: 2026-10-22 14:02:50
+ * @LastEditTime: 2026-10-22 14:02:50
+ * @Description: 定时器, 到期后通过Dispatcher交给模块的协程执行回调
+ */
+
+package timer
+
+import (
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"test/logger"
+)
+
+// Dispatcher 到期的定时器放进ChanTimer, 模块的协程从里面取出来调用Cb
+//
+//	case t := <-disp.ChanTimer:
+//		t.Cb()
+type Dispatcher struct {
+	ChanTimer chan *Timer
+}
+
+func NewDispatcher(l int) *Dispatcher {
+	disp := new(Dispatcher)
+	disp.ChanTimer = make(chan *Timer, l)
+	return disp
+}
+
+// Timer 一次性的定时器, Stop可以在任意协程调用
+type Timer struct {
+	sync.Mutex
+	t  *time.Timer
+	cb func()
+}
+
+// Stop 取消定时器, 已经放进ChanTimer但还没执行的回调也不会再执行
+func (t *Timer) Stop() {
+	t.Lock()
+	t.cb = nil
+	t.Unlock()
+	t.t.Stop()
+}
+
+// Cb 在模块的协程里调用, 回调panic时打印堆栈, 不影响模块继续运行
+func (t *Timer) Cb() {
+	defer func() {
+		if r := recover(); r != nil {
+			logger.Error("timer callback panic: %v\n%s", r, debug.Stack())
+		}
+	}()
+	t.Lock()
+	cb := t.cb
+	t.cb = nil
+	t.Unlock()
+	if cb != nil {
+		cb()
+	}
+}
+
+// AfterFunc d之后在模块的协程里执行cb, 可以在任意协程调用
+func (disp *Dispatcher) AfterFunc(d time.Duration, cb func()) *Timer {
+	t := new(Timer)
+	t.cb = cb
+	t.t = time.AfterFunc(d, func() {
+		disp.ChanTimer <- t
+	})
+	return t
+}
+
+// Cron 重复执行的定时器, 由CronFunc和TickFunc创建
+type Cron struct {
+	sync.Mutex
+	t       *Timer
+	stopped bool
+}
+
+func (c *Cron) Stop() {
+	c.Lock()
+	defer c.Unlock()
+	c.stopped = true
+	if c.t != nil {
+		c.t.Stop()
+	}
+}
+
+// repeat next返回下一次执行的等待时间, 返回false时不再执行
+func (disp *Dispatcher) repeat(next func() (time.Duration, bool), cb func()) *Cron {
+	c := new(Cron)
+	var schedule func()
+	schedule = func() {
+		d, ok := next()
+		if !ok {
+			return
+		}
+		c.Lock()
+		defer c.Unlock()
+		if c.stopped {
+			return
+		}
+		c.t = disp.AfterFunc(d, func() {
+			//先安排下一次, cb里调用Stop时不会再执行
+			schedule()
+			cb()
+		})
+	}
+	schedule()
+	return c
+}
+
+// CronFunc 按cron表达式在模块的协程里执行cb
+func (disp *Dispatcher) CronFunc(expr *CronExpr, cb func()) *Cron {
+	return disp.repeat(func() (time.Duration, bool) {
+		now := time.Now()
+		next := expr.Next(now)
+		if next.IsZero() {
+			return 0, false
+		}
+		return next.Sub(now), true
+	}, cb)
+}
+
+// TickFunc 每隔d在模块的协程里执行cb, 第一次在d之后, 按开始的时间对齐, 不会因为回调耗时漂移
+func (disp *Dispatcher) TickFunc(d time.Duration, cb func()) *Cron {
+	if d <= 0 {
+		panic("non-positive interval for TickFunc")
+	}
+	next := time.Now()
+	return disp.repeat(func() (time.Duration, bool) {
+		next = next.Add(d)
+		return time.Until(next), true
+	}, cb)
+}
@@ -0,0 +1,80 @@
+/*
+ * @Author: yujiaxun
+ * @Date: 2026-10-22 15:48:21
+ * @LastEditTime: 2026-10-22 15:48:21
+ * @Description: xxx
+ */
+
+package timer_test
+
+import (
+	"test/timer"
+	"testing"
+	"time"
+)
+
+func TestCronExpr(t *testing.T) {
+	now := time.Date(2026, 10, 22, 15, 48, 21, 500, time.Local)
+	cases := []struct {
+		expr string
+		next time.Time
+	}{
+		{"0 0 5 * * *", time.Date(2026, 10, 23, 5, 0, 0, 0, time.Local)},
+		{"*/30 * * * * *", time.Date(2026, 10, 22, 15, 48, 30, 0, time.Local)},
+		{"0 0 1 * *", time.Date(2026, 11, 1, 0, 0, 0, 0, time.Local)},
+		{"0 30 9 * * 1-5", time.Date(2026, 10, 23, 9, 30, 0, 0, time.Local)},
+		{"0 0 0 * * 0", time.Date(2026, 10, 25, 0, 0, 0, 0, time.Local)},
+		{"0 0 0 * * 7", time.Date(2026, 10, 25, 0, 0, 0, 0, time.Local)},
+		{"0 0 12 1 * 0", time.Date(2026, 10, 25, 12, 0, 0, 0, time.Local)}, //日和星期满足一个就行
+		{"0 0 0 29 2 *", time.Date(2028, 2, 29, 0, 0, 0, 0, time.Local)},
+		{"0 0 0 30 2 *", time.Time{}},
+	}
+	for _, c := range cases {
+		expr, err := timer.NewCronExpr(c.expr)
+		if err != nil {
+			t.Fatalf("%v: %v", c.expr, err)
+		}
+		if next := expr.Next(now); !next.Equal(c.next) {
+			t.Fatalf("%v: next %v, want %v", c.expr, next, c.next)
+		}
+	}
+
+	for _, bad := range []string{"* * *", "60 * * * * *", "* * * * 13", "*/0 * * * *", "5-1 * * * *", "a * * * *"} {
+		if _, err := timer.NewCronExpr(bad); err == nil {
+			t.Fatalf("%q should be invalid", bad)
+		}
+	}
+}
+
+func TestDispatcher(t *testing.T) {
+	disp := timer.NewDispatcher(10)
+	fired := make(map[string]int)
+	disp.AfterFunc(10*time.Millisecond, func() {
+		fired["after"]++
+	})
+	disp.AfterFunc(10*time.Millisecond, func() {
+		fired["stopped"]++
+	}).Stop()
+	var tick *timer.Cron
+	tick = disp.TickFunc(5*time.Millisecond, func() {
+		fired["tick"]++
+		if fired["tick"] == 3 {
+			tick.Stop()
+		}
+	})
+
+	//回调只在这个协程里执行
+	deadline := time.After(200 * time.Millisecond)
+	for {
+		select {
+		case tm := <-disp.ChanTimer:
+			tm.Cb()
+			continue
+		case <-deadline:
+		}
+		break
+	}
+	if fired["after"] != 1 || fired["stopped"] != 0 || fired["tick"] != 3 {
+		t.Fatalf("fired %v", fired)
+	}
+}